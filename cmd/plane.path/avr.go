@@ -42,7 +42,11 @@ var lastSeenMap sync.Map
 
 // Handle ensures we have enough time between messages for a plane to have travelled the distance it says it did
 // this is because we do not have the timestamp for when it was collected when processing AVR frames
-func (fm *timeFiddler) Handle(f tracker.Frame) tracker.Frame {
+func (fm *timeFiddler) Handle(fe *tracker.FrameEvent) *tracker.FrameEvent {
+	if nil == fe {
+		return nil
+	}
+	f := fe.Frame()
 	switch f.(type) {
 	case *mode_s.Frame:
 		lastSeen, _ := lastSeenMap.LoadOrStore(f.Icao(), time.Now().Add(-24*time.Hour))
@@ -63,5 +67,5 @@ func (fm *timeFiddler) Handle(f tracker.Frame) tracker.Frame {
 		lastSeenMap.Store(f.Icao(), t)
 	}
 
-	return f
+	return fe
 }
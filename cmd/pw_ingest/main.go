@@ -9,9 +9,11 @@ import (
 	"plane.watch/lib/dedupe"
 	"plane.watch/lib/example_finder"
 	"plane.watch/lib/logging"
+	"plane.watch/lib/mlat"
 	"plane.watch/lib/monitoring"
 	"plane.watch/lib/setup"
 	"plane.watch/lib/tracker"
+	"time"
 )
 
 var (
@@ -28,6 +30,58 @@ var (
 		Name: "pw_ingest_output_frame_dedupe_total",
 		Help: "The total number of deduped frames not output.",
 	})
+	prometheusCounterMlatSynced = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pw_ingest_mlat_sync_messages_total",
+		Help: "The total number of ADS-B position messages used to synchronise receiver clocks.",
+	})
+	prometheusCounterMlatSolved = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pw_ingest_mlat_positions_total",
+		Help: "The total number of positions worked out by multilateration.",
+	})
+	prometheusCoverage = tracker.CoverageMetrics{
+		Messages: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "pw_ingest_source_messages_total",
+			Help: "The total number of messages from each source, by downlink format.",
+		}, []string{"source", "df"}),
+		Aircraft: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "pw_ingest_source_aircraft",
+			Help: "The number of different aircraft each source has heard in the last hour",
+		}, []string{"source"}),
+		SectorRange: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "pw_ingest_source_sector_range_metres",
+			Help: "The furthest position each source has heard, for each 10 degree bearing",
+		}, []string{"source", "bearing"}),
+		Range: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "pw_ingest_source_range_metres",
+			Help:    "How far from each source the positions it heard were",
+			Buckets: prometheus.LinearBuckets(25_000, 25_000, 20),
+		}, []string{"source"}),
+		Rssi: promauto.NewSummaryVec(prometheus.SummaryOpts{
+			Name:       "pw_ingest_source_rssi_dbfs",
+			Help:       "The signal level of the messages from each source",
+			Objectives: map[float64]float64{0.1: 0.01, 0.5: 0.01, 0.9: 0.01, 0.99: 0.001},
+		}, []string{"source"}),
+	}
+	prometheusGaugeDecodeQueue = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "pw_ingest_decode_queue_frames",
+		Help: "The number of frames waiting to be processed by the tracker",
+	})
+	prometheusCounterDecodeQueueDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pw_ingest_decode_queue_dropped_total",
+		Help: "The total number of frames dropped because the decode queue was full.",
+	})
+	prometheusGaugeSinkQueue = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pw_ingest_sink_queue_events",
+		Help: "The number of events waiting to be sent to each sink",
+	}, []string{"sink"})
+	prometheusGaugeSinkLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pw_ingest_sink_lag_seconds",
+		Help: "How long the last event sent to each sink was waiting in its queue",
+	}, []string{"sink"})
+	prometheusCounterSinkDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pw_ingest_sink_dropped_total",
+		Help: "The total number of events dropped because a sink fell behind.",
+	}, []string{"sink"})
 )
 
 func main() {
@@ -84,6 +138,66 @@ func main() {
 		Name:    "dedupe-filter",
 		Usage:   "Include the usage of the ADSB Message Deduplication Filter. Useful for combo feeds",
 		EnvVars: []string{"DEDUPE"},
+	}, &cli.BoolFlag{
+		Name:    "mlat",
+		Usage:   "Work out positions for planes without ADS-B by multilateration. Needs beast sources with a ref lat/lon",
+		EnvVars: []string{"MLAT"},
+	}, &cli.BoolFlag{
+		Name:    "coverage",
+		Usage:   "Keep coverage and range statistics for each source. Served as metrics, and at /coverage on the monitoring port (?format=geojson for an outline)",
+		EnvVars: []string{"COVERAGE"},
+	}, &cli.StringFlag{
+		Name:    "snapshot",
+		Usage:   "Save the tracked planes to this file and load them on start, so that restarts do not lose track of planes",
+		EnvVars: []string{"SNAPSHOT"},
+	}, &cli.DurationFlag{
+		Name:    "snapshot-interval",
+		Usage:   "How often to save the tracked planes snapshot. 0 only saves it when we stop",
+		Value:   time.Minute,
+		EnvVars: []string{"SNAPSHOT_INTERVAL"},
+	}, &cli.BoolFlag{
+		Name:    "track-filter",
+		Usage:   "Smooth plane positions with a track filter and export predicted positions. Positions that do not fit the track are discarded",
+		EnvVars: []string{"TRACK_FILTER"},
+	}, &cli.BoolFlag{
+		Name:    "range-checks",
+		Usage:   "Learn how far each source can hear and discard positions beyond it (or beyond a sources maxRange=). A planes first position waits for a second to confirm it",
+		EnvVars: []string{"RANGE_CHECKS"},
+	}, &cli.BoolFlag{
+		Name:    "anomalies",
+		Usage:   "Flag aircraft whose ICAO looks to be shared by more than one aircraft, or spoofed. Flagged aircraft are marked in location updates and sent to the anomaly queue",
+		EnvVars: []string{"ANOMALIES"},
+	}, &cli.IntFlag{
+		Name:    "history-max-points",
+		Usage:   "The most positions we keep in each planes history. 0 for no limit",
+		Value:   tracker.MaxLocationHistory,
+		EnvVars: []string{"HISTORY_MAX_POINTS"},
+	}, &cli.DurationFlag{
+		Name:    "history-max-age",
+		Usage:   "How long we keep positions in each planes history. 0 for no limit",
+		EnvVars: []string{"HISTORY_MAX_AGE"},
+	}, &cli.Float64Flag{
+		Name:    "history-tolerance",
+		Usage:   "Drop positions from each planes history that are within this many metres of the line between their neighbours. Turns, climbs and descents are kept. 0 keeps every position",
+		EnvVars: []string{"HISTORY_TOLERANCE"},
+	}, &cli.StringFlag{
+		Name:    "field-max-ages",
+		Usage:   "Mark a planes values as stale in location updates once they go this long without an update, e.g. location=60s,squawk=5m. default uses our defaults, and can be combined with overrides",
+		EnvVars: []string{"FIELD_MAX_AGES"},
+	}, &cli.StringFlag{
+		Name:    "performance-overrides",
+		Usage:   "A JSON file of how fast aircraft can go, by ICAO or emitter category, e.g. {\"7CF9C1\": {\"MaxSpeed\": 900, \"MaxVerticalRate\": 50000}}. MaxSpeed is in metres/second and MaxVerticalRate in feet/minute",
+		EnvVars: []string{"PERFORMANCE_OVERRIDES"},
+	}, &cli.IntFlag{
+		Name:    "decode-queue-size",
+		Usage:   "How many frames can be waiting to be processed by the tracker",
+		Value:   1000,
+		EnvVars: []string{"DECODE_QUEUE_SIZE"},
+	}, &cli.StringFlag{
+		Name:    "decode-queue-overflow",
+		Usage:   "What to do with frames when the decode queue is full. block, drop-oldest or drop-newest",
+		Value:   "block",
+		EnvVars: []string{"DECODE_QUEUE_OVERFLOW"},
 	})
 
 	app.Before = func(c *cli.Context) error {
@@ -104,8 +218,58 @@ func commonSetup(c *cli.Context) (*tracker.Tracker, error) {
 
 	trackerOpts := make([]tracker.Option, 0)
 	trackerOpts = append(trackerOpts, tracker.WithPrometheusCounters(prometheusGaugeCurrentPlanes, prometheusCounterFramesDecoded))
+	overflowPolicy, err := tracker.ParseOverflowPolicy(c.String("decode-queue-overflow"))
+	if nil != err {
+		return nil, err
+	}
+	trackerOpts = append(trackerOpts,
+		tracker.WithDecodeQueue(c.Int("decode-queue-size"), overflowPolicy),
+		tracker.WithDecodeQueueCounters(prometheusGaugeDecodeQueue, prometheusCounterDecodeQueueDropped),
+		tracker.WithSinkCounters(prometheusGaugeSinkQueue, prometheusGaugeSinkLag, prometheusCounterSinkDropped),
+	)
+	if "" != c.String("snapshot") {
+		trackerOpts = append(trackerOpts, tracker.WithSnapshot(c.String("snapshot"), c.Duration("snapshot-interval")))
+	}
+	if c.Bool("track-filter") {
+		trackerOpts = append(trackerOpts, tracker.WithTrackFilter())
+	}
+	if c.Bool("range-checks") {
+		trackerOpts = append(trackerOpts, tracker.WithRangeChecks())
+	}
+	if c.Bool("anomalies") {
+		trackerOpts = append(trackerOpts, tracker.WithAnomalyDetection())
+	}
+	trackerOpts = append(trackerOpts, tracker.WithLocationHistory(c.Int("history-max-points"), c.Duration("history-max-age")))
+	if c.Float64("history-tolerance") > 0 {
+		trackerOpts = append(trackerOpts, tracker.WithHistorySimplification(c.Float64("history-tolerance")))
+	}
+	if "" != c.String("field-max-ages") {
+		maxAges, err := tracker.ParseFieldMaxAges(c.String("field-max-ages"))
+		if nil != err {
+			return nil, err
+		}
+		trackerOpts = append(trackerOpts, tracker.WithFieldMaxAges(maxAges))
+	}
+	if "" != c.String("performance-overrides") {
+		overrides, err := tracker.LoadPerformanceOverrides(c.String("performance-overrides"))
+		if nil != err {
+			return nil, err
+		}
+		trackerOpts = append(trackerOpts, tracker.WithPerformanceOverrides(overrides))
+	}
+	if c.Bool("coverage") {
+		trackerOpts = append(trackerOpts, tracker.WithCoverageMetrics(prometheusCoverage))
+	}
 	trk := tracker.NewTracker(trackerOpts...)
+	monitoring.AddHandler("/receivers", trk.ReceiverLocationsHandler())
+	if c.Bool("coverage") {
+		monitoring.AddHandler("/coverage", trk.CoverageHandler())
+	}
 
+	if c.Bool("mlat") {
+		// MLAT needs to see every receivers copy of a message, so it goes before our dedupe
+		trk.AddMiddleware(mlat.NewSolver(trk, mlat.WithCounters(prometheusCounterMlatSynced, prometheusCounterMlatSolved)))
+	}
 	if c.Bool("dedupe-filter") {
 		trk.AddMiddleware(dedupe.NewFilter(dedupe.WithDedupeCounter(prometheusOutputFrameDedupe)))
 		//trk.AddMiddleware(dedupe.NewFilterBTree(dedupe.WithDedupeCounterBTree(prometheusOutputFrameDedupe), dedupe.WithBtreeDegree(16)))
@@ -115,7 +279,7 @@ func commonSetup(c *cli.Context) (*tracker.Tracker, error) {
 		return nil, err
 	}
 	for _, s := range sinks {
-		trk.AddSink(s)
+		trk.AddSink(s.Sink, s.Options...)
 	}
 
 	producers, err := setup.HandleSourceFlags(c)
@@ -184,7 +348,8 @@ func run(c *cli.Context) error {
 	if nil != err {
 		return err
 	}
-	trk.AddSink(app)
+	// the screen has no use for frames
+	trk.AddSink(app, tracker.WithoutSinkEventTypes(tracker.FrameEventType))
 
 	err = app.Run()
 	trk.Stop()
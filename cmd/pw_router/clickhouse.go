@@ -40,6 +40,7 @@ type (
 		Squawk          uint32
 		Special         string
 		TrackedSince    string
+		FlightId        string
 		LastMsg         string
 		FlagCode        string
 		Operator        string
@@ -128,6 +129,7 @@ func (ds *DataStream) handleQueue(q chan *export.PlaneLocation, table string) {
 				Squawk:          uint32(squawk),
 				Special:         loc.Special,
 				TrackedSince:    loc.TrackedSince.UTC().Format("2006-01-02 15:04:05.999999999"),
+				FlightId:        loc.FlightId,
 				LastMsg:         loc.LastMsg.UTC().Format("2006-01-02 15:04:05.999999999"),
 				FlagCode:        unPtr(loc.FlagCode),
 				Operator:        unPtr(loc.Operator),
@@ -6,6 +6,7 @@ import (
 	"github.com/rs/zerolog/log"
 	"math"
 	"plane.watch/lib/export"
+	"strings"
 )
 
 type (
@@ -32,12 +33,15 @@ func (w *worker) isSignificant(last, candidate export.PlaneLocation) bool {
 		Dur("diff_time", candidate.LastMsg.Sub(last.LastMsg)).
 		Logger()
 
-	if candidate.HasOnGround && candidate.OnGround {
-		if log.Debug().Enabled() {
-			sigLog.Debug().
-				Msg("Aircraft is on ground")
+	// small movements on the ground matter, a plane sitting still on the ground does not
+	if candidate.HasOnGround && candidate.OnGround && (candidate.Lat != last.Lat || candidate.Lon != last.Lon) {
+		if candidate.Updates.Location.After(last.Updates.Location) {
+			if log.Debug().Enabled() {
+				sigLog.Debug().
+					Msg("Aircraft is moving on ground")
+			}
+			return true
 		}
-		return true
 	}
 
 	// if any of these fields differ, indicate this update is significant
@@ -141,6 +145,17 @@ func (w *worker) isSignificant(last, candidate export.PlaneLocation) bool {
 		}
 	}
 
+	// a value going stale (or coming back) is worth telling people about, so they stop using it
+	if strings.Join(candidate.Stale, ",") != strings.Join(last.Stale, ",") {
+		if log.Debug().Enabled() {
+			sigLog.Debug().
+				Strs("last", last.Stale).
+				Strs("current", candidate.Stale).
+				Msg("Significant Stale change.")
+		}
+		return true
+	}
+
 	if candidate.TileLocation != last.TileLocation {
 		if candidate.Updates.Location.After(last.Updates.Location) {
 			if log.Debug().Enabled() {
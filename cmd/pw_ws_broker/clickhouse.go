@@ -14,6 +14,9 @@ type (
 	}
 )
 
+// maxHistoryPoints is the most points we send for a planes path, more than this and we simplify it
+const maxHistoryPoints = 500
+
 var (
 	GlobalClickHouseData *ClickHouseData
 )
@@ -28,12 +31,18 @@ func NewClickHouseData(url string) (*ClickHouseData, error) {
 	}, nil
 }
 
-func (chd *ClickHouseData) PlaneLocationHistory(icao, callSign string) []ws_protocol.LocationHistory {
+// PlaneLocationHistory gets the path of the requested flight. Without a flightId we fall back to the planes callsign
+func (chd *ClickHouseData) PlaneLocationHistory(icao, callSign, flightId string) []ws_protocol.LocationHistory {
 	history := make([]ws_protocol.LocationHistory, 0, 2200) // if we increase from 6 hours, increase our initial allocation
+	// the flight we want is either its flightId or (without one) its callsign
+	flight, args := `CallSign = ?`, []any{icao, callSign}
+	if "" != flightId {
+		flight, args = `FlightId = ?`, []any{icao, flightId}
+	}
 	query := `WITH t AS (
 SELECT *
 FROM location_updates_low
-WHERE Icao = '` + icao + `' AND CallSign = '` + callSign + `' AND HasLocation = 1 AND TileLocation != 'tileUnknown'
+WHERE Icao = ? AND ` + flight + ` AND HasLocation = 1 AND TileLocation != 'tileUnknown'
   AND LastMsg > timestamp_sub(hour, 12, now())
 ), t_over AS (
     SELECT *, ROW_NUMBER() OVER(PARTITION BY toInt64(toInt64(LastMsg)/10) ORDER BY LastMsg) AS N FROM t
@@ -43,11 +52,11 @@ SELECT Lat, Lon, Velocity, Altitude, Heading FROM t_over where N=1 ORDER BY Last
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
-	if err := chd.server.Select(ctx, &history, query, icao, callSign); nil != err {
+	if err := chd.server.Select(ctx, &history, query, args...); nil != err {
 		log.Error().Err(err).Str("query", query).Msg("Failed to get aircraft location history")
 		return history
 	}
 	log.Debug().Int("num items", len(history)).Str("query", query).Send()
 
-	return history
+	return ws_protocol.SimplifyHistory(history, maxHistoryPoints)
 }
@@ -73,11 +73,12 @@
                 gridTile: tile
             })
         },
-        planeHistory(icao, callSign) {
+        planeHistory(icao, callSign, flightId) {
             this.send({
                 type: 'plane-location-history',
                 icao: icao,
                 callSign: callSign,
+                flightId: flightId,
             })
         },
         send: function(msg) {
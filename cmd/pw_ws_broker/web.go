@@ -76,6 +76,8 @@ type (
 		conn    *websocket.Conn
 		outChan chan loadedResponse
 		cmdChan chan WsCmd
+		// done is closed once the client has gone, so that nothing waits on it forever
+		done chan struct{}
 
 		parent     *ClientList
 		identifier string
@@ -85,6 +87,7 @@ type (
 		action     string
 		what       string
 		extra      string
+		flightId   string
 		locHistory []ws_protocol.LocationHistory
 	}
 	ClientList struct {
@@ -271,6 +274,7 @@ func NewWsClient(conn *websocket.Conn, identifier string) *WsClient {
 		conn:       conn,
 		cmdChan:    make(chan WsCmd),
 		outChan:    make(chan loadedResponse, 500),
+		done:       make(chan struct{}),
 		identifier: identifier,
 		log:        log.With().Str("client", identifier).Logger(),
 	}
@@ -289,52 +293,62 @@ func (c *WsClient) Handle(ctx context.Context, sendTickDuration time.Duration) {
 		return
 	}
 }
+
+// command sends our command to the clients main loop, unless the client has gone
+func (c *WsClient) command(cmd WsCmd) {
+	select {
+	case c.cmdChan <- cmd:
+	case <-c.done:
+	}
+}
+
 func (c *WsClient) AddSub(tileName string) {
 	log.Debug().Msg("Add Sub")
-	c.cmdChan <- WsCmd{
+	c.command(WsCmd{
 		action: ws_protocol.RequestTypeSubscribe,
 		what:   tileName,
-	}
+	})
 	log.Debug().Msg("Add Sub Done")
 }
 func (c *WsClient) UnSub(tileName string) {
 	log.Debug().Msg("Unsub")
-	c.cmdChan <- WsCmd{
+	c.command(WsCmd{
 		action: ws_protocol.RequestTypeUnsubscribe,
 		what:   tileName,
-	}
+	})
 	log.Debug().Msg("Unsub done")
 }
 
 // SendSubscribedTiles sends the list of tiles that we are currently subscribed to
 func (c *WsClient) SendSubscribedTiles() {
 	log.Debug().Msg("Unsub")
-	c.cmdChan <- WsCmd{
+	c.command(WsCmd{
 		action: ws_protocol.RequestTypeSubscribeList,
 		what:   "",
-	}
+	})
 	log.Debug().Msg("Unsub done")
 }
 
 // SendTilePlanes sends to the client the list of planes on the requested tile
 func (c *WsClient) SendTilePlanes(tileName string) {
 	c.log.Debug().Str("tile", tileName).Msg("Planes on Tile")
-	c.cmdChan <- WsCmd{
+	c.command(WsCmd{
 		action: ws_protocol.RequestTypeGridPlanes,
 		what:   tileName,
-	}
+	})
 }
 
 // SendPlaneLocationHistory sends the location history (from clickhouse) of the requested flight
-func (c *WsClient) SendPlaneLocationHistory(icao, callSign string) {
-	c.log.Debug().Str("icao", icao).Str("callSign", callSign).Msg("Request Flight Path")
+func (c *WsClient) SendPlaneLocationHistory(icao, callSign, flightId string) {
+	c.log.Debug().Str("icao", icao).Str("callSign", callSign).Str("flightId", flightId).Msg("Request Flight Path")
 	go func() {
-		c.cmdChan <- WsCmd{
+		c.command(WsCmd{
 			action:     ws_protocol.RequestTypePlaneLocHistory,
 			what:       icao,
 			extra:      callSign,
-			locHistory: GlobalClickHouseData.PlaneLocationHistory(icao, callSign),
-		}
+			flightId:   flightId,
+			locHistory: GlobalClickHouseData.PlaneLocationHistory(icao, callSign, flightId),
+		})
 	}()
 }
 
@@ -349,7 +363,7 @@ func (c *WsClient) planeProtocolHandler(ctx context.Context, conn *websocket.Con
 				if !(errors.Is(err, io.EOF) || websocket.CloseStatus(err) >= 0) {
 					log.Debug().Err(err).Int("Close Status", int(websocket.CloseStatus(err))).Msg("Error from reading")
 				}
-				c.cmdChan <- WsCmd{action: "exit"}
+				c.command(WsCmd{action: "exit"})
 				return
 			}
 			switch mt {
@@ -369,7 +383,7 @@ func (c *WsClient) planeProtocolHandler(ctx context.Context, conn *websocket.Con
 				case ws_protocol.RequestTypeGridPlanes:
 					c.SendTilePlanes(rq.GridTile)
 				case ws_protocol.RequestTypePlaneLocHistory:
-					c.SendPlaneLocationHistory(rq.Icao, rq.CallSign)
+					c.SendPlaneLocationHistory(rq.Icao, rq.CallSign, rq.FlightId)
 				default:
 					_ = c.sendError(ctx, "Unknown request type")
 				}
@@ -472,6 +486,7 @@ func (c *WsClient) planeProtocolHandler(ctx context.Context, conn *websocket.Con
 					History:  cmdMsg.locHistory,
 					Icao:     cmdMsg.what,
 					CallSign: cmdMsg.extra,
+					FlightId: cmdMsg.flightId,
 				})
 			default:
 				err = c.sendError(ctx, "Unknown Command")
@@ -620,8 +635,8 @@ func (cl *ClientList) addClient(c *WsClient) {
 
 func (cl *ClientList) removeClient(c *WsClient) {
 	c.log.Debug().Msg("Remove Client")
-	close(c.outChan)
 	cl.clients.Delete(c)
+	close(c.done)
 	prometheusNumClients.Dec()
 	//log.Debug().Msg("Remove Client Done")
 }
@@ -641,19 +656,17 @@ func (cl *ClientList) SendLocationUpdate(highLow, tile string, loc *export.Plane
 
 	// send the update to each of our clients
 	cl.clients.Range(func(key, value interface{}) bool {
-		defer func() {
-			if r := recover(); nil != r {
-				log.Error().Msgf("Panic: %v", r)
-			}
-		}()
 		client := key.(*WsClient)
-		client.outChan <- loadedResponse{
+		select {
+		case client.outChan <- loadedResponse{
 			out: ws_protocol.WsResponse{
 				Type:     ws_protocol.ResponseTypePlaneLocation,
 				Location: loc,
 			},
 			highLow: highLow,
 			tile:    tile,
+		}:
+		case <-client.done:
 		}
 		return true
 	})
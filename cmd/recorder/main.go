@@ -122,10 +122,11 @@ func (fp *frameProcessor) String() string {
 func (fp *frameProcessor) Listen() chan tracker.Event {
 	return fp.events
 }
-func (fp *frameProcessor) Handle(frame tracker.Frame) tracker.Frame {
-	if nil == frame {
+func (fp *frameProcessor) Handle(fe *tracker.FrameEvent) *tracker.FrameEvent {
+	if nil == fe || nil == fe.Frame() {
 		return nil
 	}
+	frame := fe.Frame()
 	if len(fp.filterIcaos) > 0 {
 		found := false
 		for _, icao := range fp.filterIcaos {
@@ -135,7 +136,7 @@ func (fp *frameProcessor) Handle(frame tracker.Frame) tracker.Frame {
 			}
 		}
 		if !found {
-			return frame
+			return fe
 		}
 	}
 
@@ -168,5 +169,5 @@ func (fp *frameProcessor) Handle(frame tracker.Frame) tracker.Frame {
 	default:
 	}
 
-	return frame
+	return fe
 }
@@ -78,29 +78,33 @@ func NewFilterBTree(opts ...OptionBTree) *FilterBTree {
 		return bytes.Compare(a.frame, b.frame) < 0
 	})
 
-	// btree sweeping
-	if f.sweepInterval > 0 {
-		f.sweeperControlChan = make(chan int)
-		f.sweeperTimerChan = time.NewTicker(f.sweepInterval)
-		go func() {
-			for {
-				select {
-				case <-f.sweeperControlChan:
-					return
-				case <-f.sweeperTimerChan.C:
-					f.sweep()
-				}
-			}
-		}()
-	}
-
 	return &f
 }
 
-func (f *FilterBTree) Handle(frame tracker.Frame) tracker.Frame {
-	if nil == frame {
+// Start begins sweeping old frames out of our btree
+func (f *FilterBTree) Start() {
+	if f.sweepInterval <= 0 || nil != f.sweeperControlChan {
+		return
+	}
+	f.sweeperControlChan = make(chan int)
+	f.sweeperTimerChan = time.NewTicker(f.sweepInterval)
+	go func() {
+		for {
+			select {
+			case <-f.sweeperControlChan:
+				return
+			case <-f.sweeperTimerChan.C:
+				f.sweep()
+			}
+		}
+	}()
+}
+
+func (f *FilterBTree) Handle(fe *tracker.FrameEvent) *tracker.FrameEvent {
+	if nil == fe || nil == fe.Frame() {
 		return nil
 	}
+	frame := fe.Frame()
 	var key []byte
 	switch (frame).(type) {
 	case *beast.Frame:
@@ -131,7 +135,7 @@ func (f *FilterBTree) Handle(frame tracker.Frame) tracker.Frame {
 	if nil != f.dedupeCounter {
 		f.dedupeCounter.Inc()
 	}
-	return frame
+	return fe
 }
 
 func (f *FilterBTree) sweep() {
@@ -151,9 +155,12 @@ func (f *FilterBTree) sweep() {
 	}
 }
 
+// Stop stops our sweeper
 func (f *FilterBTree) Stop() {
 	if nil != f.sweeperControlChan {
 		f.sweeperControlChan <- 1
+		f.sweeperTimerChan.Stop()
+		f.sweeperControlChan = nil
 	}
 }
 
@@ -1,6 +1,9 @@
 package dedupe
 
-import "plane.watch/lib/tracker/beast"
+import (
+	"plane.watch/lib/tracker"
+	"plane.watch/lib/tracker/beast"
+)
 
 func makeBeastMessages(iterMax int) []*beast.Frame {
 	//max := 0x00FFFFFF
@@ -28,3 +31,7 @@ func makeBeastMessages(iterMax int) []*beast.Frame {
 	}
 	return messages
 }
+
+func frameEvent(frame *beast.Frame) *tracker.FrameEvent {
+	return tracker.NewFrameEvent(frame, &tracker.FrameSource{Tag: "test"})
+}
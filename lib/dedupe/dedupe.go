@@ -43,10 +43,11 @@ func NewFilter(opts ...Option) *Filter {
 	return &f
 }
 
-func (f *Filter) Handle(frame tracker.Frame) tracker.Frame {
-	if nil == frame {
+func (f *Filter) Handle(fe *tracker.FrameEvent) *tracker.FrameEvent {
+	if nil == fe || nil == fe.Frame() {
 		return nil
 	}
+	frame := fe.Frame()
 	var key string
 	switch (frame).(type) {
 	case *beast.Frame:
@@ -67,7 +68,7 @@ func (f *Filter) Handle(frame tracker.Frame) tracker.Frame {
 	if nil != f.dedupeCounter {
 		f.dedupeCounter.Inc()
 	}
-	return frame
+	return fe
 }
 func (f *Filter) String() string {
 	return "Dedupe"
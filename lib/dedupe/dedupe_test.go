@@ -18,13 +18,13 @@ func TestFilter_Handle(t *testing.T) {
 		t.Error(err)
 	}
 
-	resp := filter.Handle(&frame)
+	resp := filter.Handle(frameEvent(&frame))
 
 	if resp == nil {
 		t.Errorf("Expected the same frame back")
 	}
 
-	if nil != filter.Handle(&frame) {
+	if nil != filter.Handle(frameEvent(&frame)) {
 		t.Errorf("Got a duplicated frame back")
 	}
 }
@@ -33,10 +33,10 @@ func BenchmarkFilter_HandleDuplicates(b *testing.B) {
 	filter := NewFilter()
 
 	frame, _ := beast.NewFrame(beastModeSShort, false)
-	filter.Handle(&frame)
+	filter.Handle(frameEvent(&frame))
 
 	for n := 0; n < b.N; n++ {
-		if nil != filter.Handle(&frame) {
+		if nil != filter.Handle(frameEvent(&frame)) {
 			b.Error("Should not have gotten a non empty response - duplicate handled incorrectly!?")
 		}
 	}
@@ -50,10 +50,10 @@ func BenchmarkFilter_HandleUnique(b *testing.B) {
 		beastModeSTest := []byte{0x1a, 0x32, 0x22, 0x1b, 0x54, 0xf0, 0x81, 0x2b, 0x26, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n), 0, 0, 0}
 		msg, _ := beast.NewFrame(beastModeSTest, false)
 
-		if nil == filter.Handle(&msg) {
+		if nil == filter.Handle(frameEvent(&msg)) {
 			b.Fatal("Expected to insert new message")
 		}
-		if nil != filter.Handle(&msg) {
+		if nil != filter.Handle(frameEvent(&msg)) {
 			b.Fatal("Failed duplicate insert")
 		}
 	}
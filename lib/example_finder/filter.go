@@ -80,10 +80,11 @@ func (f *Filter) String() string {
 	return "Example Finder/Filter"
 }
 
-func (f *Filter) Handle(frame tracker.Frame) tracker.Frame {
-	if nil == frame {
+func (f *Filter) Handle(fe *tracker.FrameEvent) *tracker.FrameEvent {
+	if nil == fe || nil == fe.Frame() {
 		return nil
 	}
+	frame := fe.Frame()
 
 	// if we are filtering for one or more planes, then exclude anything that is not
 	if len(f.listIcaos) > 0 {
@@ -104,12 +105,12 @@ func (f *Filter) Handle(frame tracker.Frame) tracker.Frame {
 		switch (frame).(type) {
 		case *beast.Frame:
 			b := frame.(*beast.Frame)
-			if f.IsOk(b.AvrFrame()) {
-				return frame
+			if f.IsOk(b.AvrFrame(), fe.Source()) {
+				return fe
 			}
 		case *mode_s.Frame:
-			if f.IsOk(frame.(*mode_s.Frame)) {
-				return frame
+			if f.IsOk(frame.(*mode_s.Frame), fe.Source()) {
+				return fe
 			}
 		case *sbs1.Frame:
 			// no SBS1 support
@@ -119,18 +120,24 @@ func (f *Filter) Handle(frame tracker.Frame) tracker.Frame {
 		}
 		return nil
 	}
-	return frame
+	return fe
 }
 
-func (f *Filter) IsOk(avr *mode_s.Frame) bool {
+// IsOk tells us if this is a frame we are looking for, and logs it (and where it came from) if it is
+func (f *Filter) IsOk(avr *mode_s.Frame, source *tracker.FrameSource) bool {
 	if len(f.listDfType) > 0 && !bytes.Contains(f.listDfType, []byte{avr.DownLinkType()}) {
 		return false
 	}
 	if len(f.listDfMeType) > 0 && !bytes.Contains(f.listDfMeType, []byte{avr.MessageType()}) {
 		return false
 	}
+	tag := ""
+	if nil != source {
+		tag = source.Tag
+	}
 	f.log.Info().
 		Str("AVR", avr.RawString()).
+		Str("Tag", tag).
 		Int("DF", int(avr.DownLinkType())).
 		Int("DF17MT", int(avr.MessageType())).
 		Int("DF17MT Sub", int(avr.MessageSubType())).
@@ -0,0 +1,73 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"plane.watch/lib/tracker"
+)
+
+// LifecycleEvent is something that happened to a plane, such as a takeoff or a squawk change. it encodes to JSON
+type LifecycleEvent struct {
+	Type        string
+	Icao        string
+	FlightId    string `json:",omitempty"`
+	CallSign    string `json:",omitempty"`
+	At          time.Time
+	Lat         float64
+	Lon         float64
+	HasLocation bool
+	Altitude    int
+	HasAltitude bool
+	SourceTag   string
+
+	// From and To are set when something changed, e.g. the old and new squawk
+	From string `json:",omitempty"`
+	To   string `json:",omitempty"`
+	// Emergency describes the emergency that was declared or cleared
+	Emergency string `json:",omitempty"`
+	// SilentFor is how many seconds we did not hear from the plane
+	SilentFor float64 `json:",omitempty"`
+	// Anomaly is what we think is wrong with the plane and Detail is what we saw
+	Anomaly string `json:",omitempty"`
+	Detail  string `json:",omitempty"`
+}
+
+func NewLifecycleEvent(e tracker.LifecycleEvent, source string) LifecycleEvent {
+	plane := e.Plane()
+	le := LifecycleEvent{
+		Type:        e.Type(),
+		Icao:        plane.IcaoIdentifierStr(),
+		FlightId:    plane.FlightId(),
+		CallSign:    strings.TrimSpace(plane.FlightNumber()),
+		At:          e.At().UTC(),
+		Lat:         plane.Lat(),
+		Lon:         plane.Lon(),
+		HasLocation: plane.HasLocation() && !plane.IsStale(tracker.FieldLocation),
+		Altitude:    int(plane.Altitude()),
+		HasAltitude: plane.HasAltitude() && !plane.IsStale(tracker.FieldAltitude),
+		SourceTag:   source,
+	}
+	switch ev := e.(type) {
+	case *tracker.SquawkChangedEvent:
+		le.From = fmt.Sprintf("%04d", ev.From())
+		le.To = fmt.Sprintf("%04d", ev.To())
+	case *tracker.CallsignChangedEvent:
+		le.From = ev.From()
+		le.To = ev.To()
+	case *tracker.EmergencyEvent:
+		le.Emergency = ev.Emergency()
+	case *tracker.SignalEvent:
+		le.SilentFor = ev.SilentFor().Seconds()
+	case *tracker.AnomalyEvent:
+		le.Anomaly = ev.Anomaly()
+		le.Detail = ev.Detail()
+	}
+	return le
+}
+
+func (le *LifecycleEvent) ToJsonBytes() ([]byte, error) {
+	return jsoniter.ConfigFastest.Marshal(le)
+}
@@ -11,39 +11,58 @@ import (
 
 func NewPlaneLocation(plane *tracker.Plane, isNew, isRemoved bool, source string) PlaneLocation {
 	callSign := strings.TrimSpace(plane.FlightNumber())
-	return PlaneLocation{
-		New:             isNew,
-		Removed:         isRemoved,
-		Icao:            plane.IcaoIdentifierStr(),
-		Lat:             plane.Lat(),
-		Lon:             plane.Lon(),
-		Heading:         plane.Heading(),
-		Altitude:        int(plane.Altitude()),
-		VerticalRate:    plane.VerticalRate(),
-		AltitudeUnits:   plane.AltitudeUnits(),
-		Velocity:        plane.Velocity(),
-		CallSign:        &callSign,
-		FlightStatus:    plane.FlightStatus(),
-		OnGround:        plane.OnGround(),
-		Airframe:        plane.AirFrame(),
-		AirframeType:    plane.AirFrameType(),
-		Squawk:          plane.SquawkIdentityStr(),
-		Special:         plane.Special(),
-		AircraftWidth:   plane.AirFrameWidth(),
-		AircraftLength:  plane.AirFrameLength(),
-		Registration:    plane.Registration(),
-		HasAltitude:     plane.HasAltitude(),
-		HasLocation:     plane.HasLocation(),
-		HasHeading:      plane.HasHeading(),
-		HasVerticalRate: plane.HasVerticalRate(),
-		HasVelocity:     plane.HasVelocity(),
-		HasFlightStatus: plane.HasFlightStatus(),
-		HasOnGround:     plane.HasOnGround(),
-		SourceTag:       source,
-		TileLocation:    plane.GridTileLocation(),
-		LastMsg:         plane.LastSeen().UTC(),
-		TrackedSince:    plane.TrackedSince().UTC(),
-		SignalRssi:      plane.SignalLevel(),
+	var predicted *Prediction
+	if prediction, ok := plane.PredictPosition(plane.LastSeen()); ok {
+		predicted = &Prediction{
+			Lat:               prediction.Lat,
+			Lon:               prediction.Lon,
+			Altitude:          int(prediction.Altitude),
+			UncertaintyMetres: prediction.UncertaintyMetres,
+			VelocityNorth:     prediction.VelocityNorth,
+			VelocityEast:      prediction.VelocityEast,
+			At:                prediction.At.UTC(),
+		}
+	}
+	location := PlaneLocation{
+		New:                isNew,
+		Removed:            isRemoved,
+		Icao:               plane.IcaoIdentifierStr(),
+		Lat:                plane.Lat(),
+		Lon:                plane.Lon(),
+		Heading:            plane.Heading(),
+		Altitude:           int(plane.Altitude()),
+		VerticalRate:       plane.VerticalRate(),
+		AltitudeUnits:      plane.AltitudeUnits(),
+		Velocity:           plane.Velocity(),
+		CallSign:           &callSign,
+		FlightStatus:       plane.FlightStatus(),
+		OnGround:           plane.OnGround(),
+		OnGroundConfidence: plane.OnGroundConfidence(),
+		Airframe:           plane.AirFrame(),
+		AirframeType:       plane.AirFrameType(),
+		Squawk:             plane.SquawkIdentityStr(),
+		Special:            plane.Special(),
+		AircraftWidth:      plane.AirFrameWidth(),
+		AircraftLength:     plane.AirFrameLength(),
+		Registration:       plane.Registration(),
+		HasAltitude:        plane.HasAltitude(),
+		HasLocation:        plane.HasLocation(),
+		Mlat:               plane.IsMlatLocation(),
+		Anomalies:          plane.Anomalies(),
+		HasHeading:         plane.HasHeading(),
+		HasVerticalRate:    plane.HasVerticalRate(),
+		HasVelocity:        plane.HasVelocity(),
+		HasFlightStatus:    plane.HasFlightStatus(),
+		HasOnGround:        plane.HasOnGround(),
+		SourceTag:          source,
+		TileLocation:       plane.GridTileLocation(),
+		LastMsg:            plane.LastSeen().UTC(),
+		TrackedSince:       plane.TrackedSince().UTC(),
+		FlightId:           plane.FlightId(),
+		FlightStarted:      plane.FlightStartedAt().UTC(),
+		FlightStartSeen:    plane.FlightStartSeen(),
+		SignalRssi:         plane.SignalLevel(),
+		Predicted:          predicted,
 		Updates: Updates{
 			Location:     plane.LocationUpdatedAt().UTC(),
 			Altitude:     plane.AltitudeUpdatedAt().UTC(),
@@ -57,6 +76,10 @@ func NewPlaneLocation(plane *tracker.Plane, isNew, isRemoved bool, source string
 		},
 		sourceTagsMutex: &sync.Mutex{},
 	}
+	for _, field := range plane.StaleFields() {
+		location.expire(field)
+	}
+	return location
 }
 
 func (pl *PlaneLocation) ToJsonBytes() ([]byte, error) {
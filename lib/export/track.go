@@ -0,0 +1,37 @@
+package export
+
+import (
+	"time"
+
+	"plane.watch/lib/tracker"
+)
+
+// TrackPoint is a point on the compact path a plane has taken
+type TrackPoint struct {
+	Lat, Lon          float64
+	Altitude          *int32 `json:",omitempty"`
+	Heading, Velocity float64
+	At                time.Time
+	// TrackFinished is set on the last point before a gap in the path
+	TrackFinished bool `json:",omitempty"`
+}
+
+// NewTrack is where the plane has been, simplified down to no more than maxPoints points (<= 0 for no limit)
+func NewTrack(plane *tracker.Plane, maxPoints int) []TrackPoint {
+	compact := plane.CompactTrack(maxPoints)
+	track := make([]TrackPoint, len(compact))
+	for i, point := range compact {
+		track[i] = TrackPoint{
+			Lat:           point.Lat,
+			Lon:           point.Lon,
+			Heading:       point.Heading,
+			Velocity:      point.Velocity,
+			At:            point.At.UTC(),
+			TrackFinished: point.TrackFinished,
+		}
+		if point.HasAltitude {
+			track[i].Altitude = ptr(point.Altitude)
+		}
+	}
+	return track
+}
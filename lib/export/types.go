@@ -4,10 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
+	"plane.watch/lib/tracker"
 )
 
 type (
@@ -53,12 +55,31 @@ type (
 		Special         string
 		TileLocation    string
 
+		// OnGroundConfidence is how sure we are (0 to 1) of OnGround, from how many of the planes recent frames agree with it
+		OnGroundConfidence float64 `json:",omitempty"`
+
+		// Mlat is set when our location was worked out by multilateration, rather than reported by the aircraft
+		Mlat bool
+
+		// Anomalies are the reasons we doubt this aircraft is what it says, e.g. its ICAO is being used by two aircraft
+		Anomalies []string `json:",omitempty"`
+
+		// Stale are the fields (tracker.Field*) whose values have not been updated for too long to be trusted. Their
+		// Has* flag is cleared, as are a stale Squawk and Special
+		Stale []string `json:",omitempty"`
+
 		SourceTags      map[string]uint `json:",omitempty"`
 		sourceTagsMutex *sync.Mutex
 
 		// TrackedSince is when we first started tracking this aircraft *this time*
 		TrackedSince time.Time
 
+		// FlightId identifies the flight this aircraft is on, FlightStarted is when that flight started.
+		// FlightStartSeen is set when the source saw the flight start, rather than picking it up part way through
+		FlightId        string `json:",omitempty"`
+		FlightStarted   time.Time
+		FlightStartSeen bool
+
 		// LastMsg is the last time we heard from this aircraft
 		LastMsg time.Time
 
@@ -67,6 +88,9 @@ type (
 
 		SignalRssi *float64
 
+		// Predicted is where our track filter puts the plane at LastMsg, so that maps can move it between updates
+		Predicted *Prediction `json:",omitempty"`
+
 		AircraftWidth  *float32 `json:",omitempty"`
 		AircraftLength *float32 `json:",omitempty"`
 
@@ -88,6 +112,18 @@ type (
 		Segments  []Segment `json:",omitempty"`
 	}
 
+	// Prediction is a smoothed position, its uncertainty and velocity, from which a plane can be moved along its track
+	Prediction struct {
+		Lat               float64
+		Lon               float64
+		Altitude          int `json:",omitempty"`
+		UncertaintyMetres float64
+		// VelocityNorth and VelocityEast are in metres/second
+		VelocityNorth float64
+		VelocityEast  float64
+		At            time.Time
+	}
+
 	Segment struct {
 		Name     string
 		ICAOCode string
@@ -123,6 +159,22 @@ func ptr[t any](what t) *t {
 	return &what
 }
 
+// mergeAnomalies keeps the anomalies any of our sources flagged, a source that is not looking for them does not clear them
+func mergeAnomalies(prev, next []string) []string {
+	if 0 == len(next) {
+		return prev
+	}
+	merged := make([]string, 0, len(prev)+len(next))
+	merged = append(merged, prev...)
+	for _, anomaly := range next {
+		if !contains(merged, anomaly) {
+			merged = append(merged, anomaly)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
 func MergePlaneLocations(prev, next PlaneLocation) (PlaneLocation, error) {
 	if !IsLocationPossible(prev, next) {
 		return prev, ErrImpossible
@@ -131,6 +183,7 @@ func MergePlaneLocations(prev, next PlaneLocation) (PlaneLocation, error) {
 	merged.New = false
 	merged.Removed = false
 	merged.LastMsg = next.LastMsg
+	merged.Anomalies = mergeAnomalies(prev.Anomalies, next.Anomalies)
 	merged.SignalRssi = nil // makes no sense to merge this value as it is for the individual receiver
 	if nil == merged.sourceTagsMutex {
 		merged.sourceTagsMutex = &sync.Mutex{}
@@ -146,9 +199,18 @@ func MergePlaneLocations(prev, next PlaneLocation) (PlaneLocation, error) {
 		merged.TrackedSince = next.TrackedSince
 	}
 
+	// each source names a flight from when it started hearing it, so we keep the flight we have until a source sees a new one
+	// start. Sources that saw the same takeoff will not agree to the second on when it happened
+	if "" != next.FlightId && ("" == prev.FlightId || (next.FlightStartSeen && next.FlightStarted.After(prev.FlightStarted.Add(time.Minute)))) {
+		merged.FlightId = next.FlightId
+		merged.FlightStarted = next.FlightStarted
+		merged.FlightStartSeen = next.FlightStartSeen
+	}
+
 	if next.HasLocation && next.Updates.Location.After(prev.Updates.Location) {
 		merged.Lat = next.Lat
 		merged.Lon = next.Lon
+		merged.Mlat = next.Mlat
 		merged.Updates.Location = next.Updates.Location
 		merged.HasLocation = true
 	}
@@ -176,10 +238,13 @@ func MergePlaneLocations(prev, next PlaneLocation) (PlaneLocation, error) {
 	if next.HasFlightStatus && next.Updates.FlightStatus.After(prev.Updates.FlightStatus) {
 		merged.FlightStatus = next.FlightStatus
 		merged.Updates.FlightStatus = next.Updates.FlightStatus
+		merged.HasFlightStatus = true
 	}
 	if next.HasOnGround && next.Updates.OnGround.After(prev.Updates.OnGround) {
 		merged.OnGround = next.OnGround
+		merged.OnGroundConfidence = next.OnGroundConfidence
 		merged.Updates.OnGround = next.Updates.OnGround
+		merged.HasOnGround = true
 	}
 	if "" == merged.Airframe {
 		merged.Airframe = next.Airframe
@@ -215,6 +280,11 @@ func MergePlaneLocations(prev, next PlaneLocation) (PlaneLocation, error) {
 		merged.Updates.Special = next.Updates.Special
 	}
 
+	if nil != next.Predicted && (nil == prev.Predicted || next.Predicted.At.After(prev.Predicted.At)) {
+		predicted := *next.Predicted
+		merged.Predicted = &predicted
+	}
+
 	if "" != next.TileLocation {
 		merged.TileLocation = next.TileLocation
 	}
@@ -226,9 +296,81 @@ func MergePlaneLocations(prev, next PlaneLocation) (PlaneLocation, error) {
 		merged.AircraftLength = ptr(unPtr(next.AircraftLength))
 	}
 
+	// a field stays stale until a source gives us something newer than the value that went stale
+	merged.Stale = nil
+	for _, field := range tracker.Fields {
+		stale := (contains(prev.Stale, field) && !merged.Updates.at(field).After(prev.Updates.at(field))) ||
+			(contains(next.Stale, field) && !merged.Updates.at(field).After(next.Updates.at(field)))
+		if stale {
+			merged.expire(field)
+		}
+	}
+
 	return merged, nil
 }
 
+// expire marks a field as stale, so that nobody acts on its value
+func (pl *PlaneLocation) expire(field string) {
+	switch field {
+	case tracker.FieldLocation:
+		pl.HasLocation = false
+		pl.Predicted = nil
+	case tracker.FieldAltitude:
+		pl.HasAltitude = false
+	case tracker.FieldVelocity:
+		pl.HasVelocity = false
+	case tracker.FieldHeading:
+		pl.HasHeading = false
+	case tracker.FieldVerticalRate:
+		pl.HasVerticalRate = false
+	case tracker.FieldOnGround:
+		pl.HasOnGround = false
+	case tracker.FieldFlightStatus:
+		pl.HasFlightStatus = false
+	case tracker.FieldSquawk:
+		pl.Squawk = ""
+	case tracker.FieldSpecial:
+		pl.Special = ""
+	}
+	if !contains(pl.Stale, field) {
+		pl.Stale = append(pl.Stale, field)
+	}
+}
+
+// at is when the given field (tracker.Field*) was last updated
+func (u Updates) at(field string) time.Time {
+	switch field {
+	case tracker.FieldLocation:
+		return u.Location
+	case tracker.FieldAltitude:
+		return u.Altitude
+	case tracker.FieldVelocity:
+		return u.Velocity
+	case tracker.FieldHeading:
+		return u.Heading
+	case tracker.FieldVerticalRate:
+		return u.VerticalRate
+	case tracker.FieldOnGround:
+		return u.OnGround
+	case tracker.FieldFlightStatus:
+		return u.FlightStatus
+	case tracker.FieldSquawk:
+		return u.Squawk
+	case tracker.FieldSpecial:
+		return u.Special
+	}
+	return time.Time{}
+}
+
+func contains(list []string, what string) bool {
+	for _, item := range list {
+		if item == what {
+			return true
+		}
+	}
+	return false
+}
+
 func IsLocationPossible(prev, next PlaneLocation) bool {
 	// simple check, if bearing of prev -> next is more than +-90 degrees of reported value, it is invalid
 	if !(prev.HasLocation && next.HasLocation && prev.HasHeading && next.HasHeading) {
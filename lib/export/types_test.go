@@ -3,6 +3,8 @@ package export
 import (
 	"testing"
 	"time"
+
+	"plane.watch/lib/tracker"
 )
 
 func TestIsLocationPossible(t *testing.T) {
@@ -24,3 +26,88 @@ func TestIsLocationPossible(t *testing.T) {
 		t.Error("Pos2 -> Pos1 is not possible")
 	}
 }
+
+func TestMergePlaneLocations_FlightId(t *testing.T) {
+	takeoff := time.Date(2023, time.January, 9, 19, 0, 0, 0, time.UTC)
+	first := PlaneLocation{Icao: "7C1234", FlightId: "7C1234-20230109T190000Z", FlightStarted: takeoff, FlightStartSeen: true, LastMsg: takeoff}
+
+	// another receiver that picked the plane up part way through the flight
+	later := takeoff.Add(10 * time.Minute)
+	pickedUp := PlaneLocation{Icao: "7C1234", FlightId: "7C1234-20230109T191000Z", FlightStarted: later, LastMsg: later}
+	merged, err := MergePlaneLocations(first, pickedUp)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if first.FlightId != merged.FlightId {
+		t.Errorf("Expected to stay on flight %s, got %s", first.FlightId, merged.FlightId)
+	}
+
+	// another receiver that saw the same takeoff, a second later
+	sameTakeoff := PlaneLocation{Icao: "7C1234", FlightId: "7C1234-20230109T190001Z", FlightStarted: takeoff.Add(time.Second), FlightStartSeen: true, LastMsg: later}
+	merged, _ = MergePlaneLocations(merged, sameTakeoff)
+	if first.FlightId != merged.FlightId {
+		t.Errorf("Expected to stay on flight %s, got %s", first.FlightId, merged.FlightId)
+	}
+
+	nextTakeoff := takeoff.Add(2 * time.Hour)
+	nextFlight := PlaneLocation{Icao: "7C1234", FlightId: "7C1234-20230109T210000Z", FlightStarted: nextTakeoff, FlightStartSeen: true, LastMsg: nextTakeoff}
+	merged, _ = MergePlaneLocations(merged, nextFlight)
+	if nextFlight.FlightId != merged.FlightId || !nextTakeoff.Equal(merged.FlightStarted) {
+		t.Errorf("Expected to move to flight %s, got %s", nextFlight.FlightId, merged.FlightId)
+	}
+}
+
+func TestMergePlaneLocations_Stale(t *testing.T) {
+	heard := time.Date(2023, time.January, 9, 19, 0, 0, 0, time.UTC)
+	first := PlaneLocation{Icao: "7C1234", Squawk: "7700", HasAltitude: true, Altitude: 10000, LastMsg: heard,
+		Updates: Updates{Squawk: heard, Altitude: heard}}
+
+	// the same source, 10 minutes later and without a new squawk
+	later := heard.Add(10 * time.Minute)
+	stale := PlaneLocation{Icao: "7C1234", Squawk: "7700", HasAltitude: true, Altitude: 11000, LastMsg: later,
+		Updates: Updates{Squawk: heard, Altitude: later}}
+	stale.expire(tracker.FieldSquawk)
+	if "" != stale.Squawk || 1 != len(stale.Stale) {
+		t.Fatalf("expected our stale squawk to be cleared, got {%s} %v", stale.Squawk, stale.Stale)
+	}
+
+	merged, err := MergePlaneLocations(first, stale)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "" != merged.Squawk || 1 != len(merged.Stale) || tracker.FieldSquawk != merged.Stale[0] {
+		t.Errorf("expected our merged squawk to be stale, got {%s} %v", merged.Squawk, merged.Stale)
+	}
+	if !merged.HasAltitude || 11000 != merged.Altitude {
+		t.Errorf("expected our altitude to be updated, got %d", merged.Altitude)
+	}
+
+	// another source with a newer squawk
+	fresh := PlaneLocation{Icao: "7C1234", Squawk: "1200", LastMsg: later, Updates: Updates{Squawk: later}}
+	merged, _ = MergePlaneLocations(merged, fresh)
+	if "1200" != merged.Squawk || 0 != len(merged.Stale) {
+		t.Errorf("expected a newer squawk to no longer be stale, got {%s} %v", merged.Squawk, merged.Stale)
+	}
+}
+
+func TestMergePlaneLocations_Anomalies(t *testing.T) {
+	at := time.Date(2023, time.January, 9, 19, 0, 0, 0, time.UTC)
+	flagged := PlaneLocation{Icao: "7C1234", Anomalies: []string{"out-of-range"}, LastMsg: at}
+	unchecked := PlaneLocation{Icao: "7C1234", LastMsg: at.Add(time.Second)}
+	spoofed := PlaneLocation{Icao: "7C1234", Anomalies: []string{"duplicate-icao", "out-of-range"}, LastMsg: at.Add(2 * time.Second)}
+
+	merged, err := MergePlaneLocations(flagged, unchecked)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(merged.Anomalies) || "out-of-range" != merged.Anomalies[0] {
+		t.Errorf("expected a source without anomalies to not clear ours, got %v", merged.Anomalies)
+	}
+	merged, err = MergePlaneLocations(merged, spoofed)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != len(merged.Anomalies) || "duplicate-icao" != merged.Anomalies[0] || "out-of-range" != merged.Anomalies[1] {
+		t.Errorf("expected the anomalies from both sources, got %v", merged.Anomalies)
+	}
+}
@@ -0,0 +1,102 @@
+package mlat
+
+import (
+	"math"
+	"sort"
+)
+
+// maxDrift is how far apart (as a ratio) two receivers clocks can run before we think something is wrong, 500ppm
+const maxDrift = 500e-6
+
+type (
+	// syncPoint is when an ADS-B position message left its aircraft, in the ticks of each of a pair of receivers
+	syncPoint struct {
+		a, b float64
+	}
+
+	// clockPair tracks how the clock of receiver b runs against the clock of receiver a, so that we can turn a time
+	// from one receiver into the time on the other
+	clockPair struct {
+		points []syncPoint
+
+		// our clocks are related by a = meanA + drift * (b - meanB)
+		meanA, meanB float64
+		drift        float64
+	}
+)
+
+// add gives us a new sync point. It returns false when the point does not fit the clocks we know about (a receiver
+// restarted, or the clocks jumped), in which case we start again from it.
+// maxAge and maxError are in ticks
+func (cp *clockPair) add(pt syncPoint, maxPoints int, maxAge, maxError float64) bool {
+	fits := true
+	if len(cp.points) >= 2 && math.Abs(cp.toA(pt.b)-pt.a) > maxError {
+		fits = false
+	}
+	if n := len(cp.points); n > 0 && math.Abs(pt.b-cp.points[n-1].b) > maxAge {
+		fits = false
+	}
+	if !fits {
+		cp.points = cp.points[:0]
+	}
+
+	i := sort.Search(len(cp.points), func(i int) bool { return cp.points[i].b > pt.b })
+	cp.points = append(cp.points, syncPoint{})
+	copy(cp.points[i+1:], cp.points[i:])
+	cp.points[i] = pt
+
+	newest := cp.points[len(cp.points)-1].b
+	for len(cp.points) > 1 && (len(cp.points) > maxPoints || newest-cp.points[0].b > maxAge) {
+		cp.points = cp.points[1:]
+	}
+	cp.fit()
+	return fits
+}
+
+// fit works out how our clocks relate from our sync points with a least squares line
+func (cp *clockPair) fit() {
+	n := len(cp.points)
+	if n < 2 {
+		return
+	}
+	// work relative to our newest point so that we keep our precision, our ticks are big numbers
+	ref := cp.points[n-1]
+	var sumA, sumB float64
+	for _, pt := range cp.points {
+		sumA += pt.a - ref.a
+		sumB += pt.b - ref.b
+	}
+	meanA := sumA / float64(n)
+	meanB := sumB / float64(n)
+	var sumAB, sumBB float64
+	for _, pt := range cp.points {
+		db := pt.b - ref.b - meanB
+		sumAB += db * (pt.a - ref.a - meanA)
+		sumBB += db * db
+	}
+	if 0 == sumBB {
+		return
+	}
+	cp.drift = sumAB / sumBB
+	cp.meanA = ref.a + meanA
+	cp.meanB = ref.b + meanB
+}
+
+// valid tells us if we can trust our clocks at the given time on b (within maxAge ticks of our sync points)
+func (cp *clockPair) valid(b, maxAge float64) bool {
+	n := len(cp.points)
+	if n < 2 || math.Abs(cp.drift-1) > maxDrift {
+		return false
+	}
+	return b >= cp.points[0].b-maxAge && b <= cp.points[n-1].b+maxAge
+}
+
+// toA turns a time on the b clock into a time on the a clock
+func (cp *clockPair) toA(b float64) float64 {
+	return cp.meanA + cp.drift*(b-cp.meanB)
+}
+
+// toB turns a time on the a clock into a time on the b clock
+func (cp *clockPair) toB(a float64) float64 {
+	return cp.meanB + (a-cp.meanA)/cp.drift
+}
@@ -0,0 +1,91 @@
+package mlat
+
+import "math"
+
+// cprMax is 2^17, airborne CPR positions are 17 bits
+const cprMax = 131072.0
+
+// cprNL is the number of longitude zones at the given latitude
+func cprNL(lat float64) float64 {
+	lat = math.Abs(lat)
+	if lat < 1e-9 {
+		return 59
+	}
+	if lat > 87 {
+		return 1
+	}
+	a := 1 - math.Cos(math.Pi/(2*15))
+	cosLat := math.Cos(degToRad(lat))
+	return math.Floor(2 * math.Pi / math.Acos(math.Max(-1, 1-a/(cosLat*cosLat))))
+}
+
+// positiveMod is a modulus that is never negative
+func positiveMod(a, b float64) float64 {
+	res := math.Mod(a, b)
+	if res < 0 {
+		res += b
+	}
+	return res
+}
+
+// localAirborne decodes a single airborne CPR position using a reference that is within half a zone (~300km) of it.
+// We decode against our receiver to check a global decode puts the aircraft where our receiver can hear it
+func localAirborne(cprLat, cprLon int, odd bool, ref Position) (lat, lon float64) {
+	i := 0.0
+	if odd {
+		i = 1
+	}
+	dLat := 360 / (60 - i)
+	yz := float64(cprLat) / cprMax
+	j := math.Floor(ref.Lat/dLat) + math.Floor(0.5+positiveMod(ref.Lat, dLat)/dLat-yz)
+	lat = dLat * (j + yz)
+
+	nl := cprNL(lat) - i
+	if nl < 1 {
+		nl = 1
+	}
+	dLon := 360 / nl
+	xz := float64(cprLon) / cprMax
+	m := math.Floor(ref.Lon/dLon) + math.Floor(0.5+positiveMod(ref.Lon, dLon)/dLon-xz)
+	lon = dLon * (m + xz)
+	return lat, lon
+}
+
+// globalAirborne decodes an airborne position from an even and an odd CPR frame, without needing a reference.
+// The frames have to be close together in time (10 seconds) for this to work, oddLatest says which one is newest
+// and so which one we give the position of
+func globalAirborne(evenLat, evenLon, oddLat, oddLon int, oddLatest bool) (lat, lon float64, ok bool) {
+	const dLatEven, dLatOdd = 360.0 / 60, 360.0 / 59
+	latE, lonE := float64(evenLat)/cprMax, float64(evenLon)/cprMax
+	latO, lonO := float64(oddLat)/cprMax, float64(oddLon)/cprMax
+
+	j := math.Floor(59*latE - 60*latO + 0.5)
+	rLatEven := dLatEven * (positiveMod(j, 60) + latE)
+	rLatOdd := dLatOdd * (positiveMod(j, 59) + latO)
+	if rLatEven >= 270 {
+		rLatEven -= 360
+	}
+	if rLatOdd >= 270 {
+		rLatOdd -= 360
+	}
+	if rLatEven < -90 || rLatEven > 90 || rLatOdd < -90 || rLatOdd > 90 {
+		return 0, 0, false
+	}
+	// the frames are either side of a longitude zone boundary, we cannot use them together
+	if cprNL(rLatEven) != cprNL(rLatOdd) {
+		return 0, 0, false
+	}
+
+	lat, xz, i := rLatEven, lonE, 0.0
+	if oddLatest {
+		lat, xz, i = rLatOdd, lonO, 1
+	}
+	nl := cprNL(lat)
+	ni := math.Max(nl-i, 1)
+	m := math.Floor(lonE*(nl-1) - lonO*nl + 0.5)
+	lon = (360 / ni) * (positiveMod(m, ni) + xz)
+	if lon >= 180 {
+		lon -= 360
+	}
+	return lat, lon, true
+}
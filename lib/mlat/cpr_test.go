@@ -0,0 +1,86 @@
+package mlat
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"plane.watch/lib/tracker/mode_s"
+)
+
+func TestLocalAirborne(t *testing.T) {
+	// the worked example from "The 1090MHz Riddle"
+	frame, err := mode_s.DecodeString("*8D40621D58C382D690C8AC2863A7;", time.Now())
+	if nil != err {
+		t.Fatalf("failed to decode our frame: %s", err)
+	}
+	if !isAirbornePosition(frame) {
+		t.Fatalf("expected an airborne position frame, got %s", frame.MessageTypeString())
+	}
+	lat, lon := localAirborne(frame.Latitude(), frame.Longitude(), !frame.IsEven(), Position{Lat: 52.258, Lon: 3.918})
+	if math.Abs(lat-52.25720) > 0.00001 || math.Abs(lon-3.91937) > 0.00001 {
+		t.Errorf("expected {52.25720, 3.91937}, got {%0.5f, %0.5f}", lat, lon)
+	}
+}
+
+func TestCprNL(t *testing.T) {
+	tests := map[float64]float64{
+		0:     59,
+		10.46: 59,
+		10.48: 58,
+		-52.2: 36,
+		86.6:  2,
+		87.1:  1,
+	}
+	for lat, want := range tests {
+		if got := cprNL(lat); want != got {
+			t.Errorf("NL(%0.2f) expected %0.0f, got %0.0f", lat, want, got)
+		}
+	}
+}
+
+func TestGlobalAirborne(t *testing.T) {
+	// the worked example from "The 1090MHz Riddle"
+	even, err := mode_s.DecodeString("*8D40621D58C382D690C8AC2863A7;", time.Now())
+	if nil != err {
+		t.Fatalf("failed to decode our even frame: %s", err)
+	}
+	odd, err := mode_s.DecodeString("*8D40621D58C386435CC412692AD6;", time.Now())
+	if nil != err {
+		t.Fatalf("failed to decode our odd frame: %s", err)
+	}
+	if !even.IsEven() || odd.IsEven() {
+		t.Fatalf("expected an even and an odd frame")
+	}
+	lat, lon, ok := globalAirborne(even.Latitude(), even.Longitude(), odd.Latitude(), odd.Longitude(), false)
+	if !ok {
+		t.Fatalf("expected our frames to decode")
+	}
+	if math.Abs(lat-52.25720) > 0.00001 || math.Abs(lon-3.91937) > 0.00001 {
+		t.Errorf("expected {52.25720, 3.91937}, got {%0.5f, %0.5f}", lat, lon)
+	}
+
+	// with the odd frame newest, we get where the odd frame was sent from
+	lat, lon, ok = globalAirborne(even.Latitude(), even.Longitude(), odd.Latitude(), odd.Longitude(), true)
+	if !ok || math.Abs(lat-52.26578) > 0.00001 || math.Abs(lon-3.93891) > 0.00001 {
+		t.Errorf("expected our odd frame at {52.26578, 3.93891}, got {%0.5f, %0.5f}", lat, lon)
+	}
+}
+
+func TestSolver_DecodeCpr(t *testing.T) {
+	s := NewSolver(nil)
+	now := time.Now()
+	even, _ := mode_s.DecodeString("*8D40621D58C382D690C8AC2863A7;", now)
+	odd, _ := mode_s.DecodeString("*8D40621D58C386435CC412692AD6;", now)
+
+	if _, _, ok := s.decodeCpr(now, now, even); ok {
+		t.Errorf("expected a single position message to not be trusted")
+	}
+	if _, _, ok := s.decodeCpr(now, now.Add(cprPairAge+time.Second), odd); ok {
+		t.Errorf("expected messages too far apart to not be decoded together")
+	}
+	lat, lon, ok := s.decodeCpr(now, now.Add(time.Second), even)
+	if !ok || math.Abs(lat-52.25720) > 0.00001 || math.Abs(lon-3.91937) > 0.00001 {
+		t.Errorf("expected our pair to decode to {52.25720, 3.91937}, got {%0.5f, %0.5f}", lat, lon)
+	}
+}
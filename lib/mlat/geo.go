@@ -0,0 +1,82 @@
+package mlat
+
+import "math"
+
+const (
+	// WGS84 ellipsoid
+	wgs84A  = 6378137.0
+	wgs84F  = 1 / 298.257223563
+	wgs84E2 = wgs84F * (2 - wgs84F)
+
+	// speedOfLight in metres/second, which is how fast our messages travel
+	speedOfLight = 299792458.0
+
+	feetToMetres = 0.3048
+)
+
+type (
+	// Position is a WGS84 location, Alt is in metres above the ellipsoid
+	Position struct {
+		Lat, Lon, Alt float64
+	}
+
+	// vec3 is an earth centred, earth fixed (ECEF) coordinate in metres
+	vec3 [3]float64
+)
+
+func degToRad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func radToDeg(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+// ecef gives us our position in earth centred, earth fixed coordinates
+func (p Position) ecef() vec3 {
+	lat := degToRad(p.Lat)
+	lon := degToRad(p.Lon)
+	sinLat := math.Sin(lat)
+	n := wgs84A / math.Sqrt(1-wgs84E2*sinLat*sinLat)
+	return vec3{
+		(n + p.Alt) * math.Cos(lat) * math.Cos(lon),
+		(n + p.Alt) * math.Cos(lat) * math.Sin(lon),
+		(n*(1-wgs84E2) + p.Alt) * sinLat,
+	}
+}
+
+// position turns our ECEF coordinate back into a WGS84 location
+func (v vec3) position() Position {
+	p := math.Hypot(v[0], v[1])
+	lon := math.Atan2(v[1], v[0])
+	lat := math.Atan2(v[2], p*(1-wgs84E2))
+	var alt float64
+	for i := 0; i < 6; i++ {
+		sinLat := math.Sin(lat)
+		n := wgs84A / math.Sqrt(1-wgs84E2*sinLat*sinLat)
+		alt = p/math.Cos(lat) - n
+		lat = math.Atan2(v[2], p*(1-wgs84E2*n/(n+alt)))
+	}
+	return Position{Lat: radToDeg(lat), Lon: radToDeg(lon), Alt: alt}
+}
+
+func (v vec3) sub(o vec3) vec3 {
+	return vec3{v[0] - o[0], v[1] - o[1], v[2] - o[2]}
+}
+
+func (v vec3) add(o vec3) vec3 {
+	return vec3{v[0] + o[0], v[1] + o[1], v[2] + o[2]}
+}
+
+func (v vec3) scale(s float64) vec3 {
+	return vec3{v[0] * s, v[1] * s, v[2] * s}
+}
+
+func (v vec3) length() float64 {
+	return math.Sqrt(v[0]*v[0] + v[1]*v[1] + v[2]*v[2])
+}
+
+// distance is the straight line distance in metres between two ECEF coordinates
+func (v vec3) distance(o vec3) float64 {
+	return v.sub(o).length()
+}
@@ -0,0 +1,580 @@
+package mlat
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"plane.watch/lib/tracker"
+	"plane.watch/lib/tracker/beast"
+	"plane.watch/lib/tracker/mode_s"
+)
+
+/**
+This package works out where aircraft are from when several receivers heard the same Mode S message (multilateration).
+
+The beast 12MHz counters each receiver stamps its messages with are not synchronised, so we use the ADS-B position
+messages, where we know where the aircraft was, to learn how each pair of receivers clocks relate. With those we can
+turn the times that other messages were heard into time differences, and solve for where they were sent from.
+*/
+
+const (
+	defaultClockHz = 12e6
+	// defaultGroupWindow is how long we wait for all of our receivers to give us a message
+	defaultGroupWindow = time.Second
+	// defaultTimingError is how precise we expect our receivers timestamps to be
+	defaultTimingError = 100 * time.Nanosecond
+	// defaultSyncAge is how long our clock sync is good for without a new ADS-B position message
+	defaultSyncAge = 30 * time.Second
+	// defaultSyncError is how far a sync point can be from where we expected it, before we start our clock sync again
+	defaultSyncError = 5 * time.Microsecond
+	// defaultMaxRange in metres, is how far from a receiver we expect to hear an aircraft
+	defaultMaxRange = 300_000.0
+	// defaultMaxResidual is how far our solution can be from fitting our times, in multiples of our timing error
+	defaultMaxResidual = 5.0
+	syncPoints         = 16
+	// cprPairAge is how far apart an even and odd CPR position can be for us to decode them together
+	cprPairAge = 10 * time.Second
+	// guessAltitude in metres, is where we start looking for aircraft when we do not know their altitude
+	guessAltitude = 5000.0
+	// minAltitude and maxAltitude in metres, are where we expect to find aircraft
+	minAltitude = -500.0
+	maxAltitude = 25000.0
+)
+
+type (
+	Option func(*Solver)
+
+	// Locator takes the positions we work out, the tracker is one
+	Locator interface {
+		AddMlatLocation(icao uint32, lat, lon float64, ts time.Time) error
+	}
+
+	// Result is a position we worked out for an aircraft
+	Result struct {
+		Icao      uint32
+		Position  Position
+		Receivers []string
+		At        time.Time
+		// Residual is how well our position fits the times, in multiples of our timing error
+		Residual float64
+	}
+
+	receiver struct {
+		id   string
+		pos  Position
+		ecef vec3
+	}
+
+	reception struct {
+		receiver *receiver
+		ticks    float64
+	}
+
+	// group is every reception of one Mode S message
+	group struct {
+		icao uint32
+		// first is when our first reception arrived, at is when it was heard
+		first      time.Time
+		at         time.Time
+		receptions []reception
+		// known is where the aircraft said it was, if the message is an ADS-B airborne position
+		known *vec3
+		// altitude in metres, if the message had one
+		altitude *float64
+	}
+
+	pairKey struct {
+		a, b string
+	}
+
+	// cprFrame is the CPR position from an aircrafts latest even or odd airborne position message
+	cprFrame struct {
+		lat, lon int
+		at       time.Time
+	}
+
+	// cprPair is the latest even and odd CPR positions from an aircraft, so we can decode where it is
+	cprPair struct {
+		even, odd *cprFrame
+		// seen is when we last had a position message from our aircraft
+		seen time.Time
+	}
+
+	// Solver is a tracker.Middleware that multilaterates the frames going through it and gives the positions it
+	// works out to its Locator. It needs to come before anything that drops duplicate frames
+	Solver struct {
+		locator Locator
+
+		clockHz     float64
+		window      time.Duration
+		timingError time.Duration
+		syncAge     time.Duration
+		syncError   time.Duration
+		maxRange    float64
+		maxResidual float64
+
+		lock      sync.Mutex
+		receivers map[string]*receiver
+		fixed     map[string]bool
+		// groups are keyed by message, one message can be sent more than once inside our window
+		groups map[string][]*group
+		clocks map[pairKey]*clockPair
+		cpr    map[uint32]*cprPair
+
+		done    chan struct{}
+		running sync.WaitGroup
+
+		syncCounter   prometheus.Counter
+		solvedCounter prometheus.Counter
+
+		log zerolog.Logger
+	}
+)
+
+// WithReceiver sets where a receiver is, instead of using its sources RefLat/RefLon. alt is metres above the
+// WGS84 ellipsoid
+func WithReceiver(id string, lat, lon, alt float64) Option {
+	return func(s *Solver) {
+		s.receivers[id] = newReceiver(id, Position{Lat: lat, Lon: lon, Alt: alt})
+		s.fixed[id] = true
+	}
+}
+
+// WithGroupWindow sets how long we wait for all of our receivers to give us a message
+func WithGroupWindow(window time.Duration) Option {
+	return func(s *Solver) {
+		s.window = window
+	}
+}
+
+// WithClockFrequency sets how fast our receivers timestamp counters tick
+func WithClockFrequency(hz float64) Option {
+	return func(s *Solver) {
+		s.clockHz = hz
+	}
+}
+
+// WithTimingError sets how precise we expect our receivers timestamps to be
+func WithTimingError(timingError time.Duration) Option {
+	return func(s *Solver) {
+		s.timingError = timingError
+	}
+}
+
+// WithMaxRange sets how far (in metres) from a receiver we expect to hear an aircraft
+func WithMaxRange(metres float64) Option {
+	return func(s *Solver) {
+		s.maxRange = metres
+	}
+}
+
+// WithCounters counts the ADS-B messages we synchronised our clocks with, and the positions we worked out
+func WithCounters(synced, solved prometheus.Counter) Option {
+	return func(s *Solver) {
+		s.syncCounter = synced
+		s.solvedCounter = solved
+	}
+}
+
+func NewSolver(locator Locator, opts ...Option) *Solver {
+	s := Solver{
+		locator:     locator,
+		clockHz:     defaultClockHz,
+		window:      defaultGroupWindow,
+		timingError: defaultTimingError,
+		syncAge:     defaultSyncAge,
+		syncError:   defaultSyncError,
+		maxRange:    defaultMaxRange,
+		maxResidual: defaultMaxResidual,
+		receivers:   map[string]*receiver{},
+		fixed:       map[string]bool{},
+		groups:      map[string][]*group{},
+		clocks:      map[pairKey]*clockPair{},
+		cpr:         map[uint32]*cprPair{},
+		log:         log.With().Str("Section", "MLAT").Logger(),
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return &s
+}
+
+func newReceiver(id string, pos Position) *receiver {
+	return &receiver{id: id, pos: pos, ecef: pos.ecef()}
+}
+
+func (s *Solver) String() string {
+	return "MLAT"
+}
+
+// Handle takes note of when our receiver heard this frame, and passes it on untouched
+func (s *Solver) Handle(fe *tracker.FrameEvent) *tracker.FrameEvent {
+	if nil == fe || nil == fe.Frame() {
+		return fe
+	}
+	var frame *mode_s.Frame
+	var ticks uint64
+	switch f := fe.Frame().(type) {
+	case *beast.Frame:
+		if f.IsMlat() {
+			return fe
+		}
+		frame = f.AvrFrame()
+		ticks = f.BeastTicks()
+	case *mode_s.Frame:
+		if f.IsMlat() {
+			return fe
+		}
+		frame = f
+		ticks = f.BeastTicks()
+	default:
+		return fe
+	}
+	if 0 == ticks || nil == frame || 0 == frame.Icao() {
+		return fe
+	}
+	s.receive(time.Now(), fe.Frame().TimeStamp(), fe.Source(), frame, ticks)
+	return fe
+}
+
+// receiverFor finds our receiver for the given source, must be called with our lock held
+func (s *Solver) receiverFor(source *tracker.FrameSource) *receiver {
+	if nil == source {
+		return nil
+	}
+	id := source.Id()
+	r, ok := s.receivers[id]
+	if s.fixed[id] {
+		return r
+	}
+	if nil == source.RefLat || nil == source.RefLon {
+		return nil
+	}
+	if !ok || r.pos.Lat != *source.RefLat || r.pos.Lon != *source.RefLon {
+		r = newReceiver(id, Position{Lat: *source.RefLat, Lon: *source.RefLon})
+		s.receivers[id] = r
+	}
+	return r
+}
+
+// receive adds the frame (heard at) to the group of receptions of its message
+func (s *Solver) receive(now, at time.Time, source *tracker.FrameSource, frame *mode_s.Frame, ticks uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r := s.receiverFor(source)
+	if nil == r {
+		return
+	}
+	var altitude *float64
+	if frame.AltitudeValid() {
+		alt := float64(frame.MustAltitude())
+		if "feet" == frame.AltitudeUnits() {
+			alt *= feetToMetres
+		}
+		altitude = &alt
+	}
+	var known *Position
+	if isAirbornePosition(frame) && nil != altitude {
+		if lat, lon, ok := s.decodeCpr(now, at, frame); ok {
+			// a pair that decodes somewhere else than our receiver would put it is not to be trusted
+			localLat, localLon := localAirborne(frame.Latitude(), frame.Longitude(), !frame.IsEven(), r.pos)
+			if math.Abs(lat-localLat) < 1e-6 && math.Abs(lon-localLon) < 1e-6 {
+				known = &Position{Lat: lat, Lon: lon, Alt: *altitude}
+			}
+		}
+	}
+	s.addReception(now, at, r, string(frame.Raw()), frame.Icao(), altitude, known, float64(ticks))
+}
+
+// decodeCpr works out where an airborne position message was sent from. We only trust a global decode of an even and
+// odd pair for syncing our clocks, a single message decoded against our receiver can be a whole zone out.
+// Must be called with our lock held
+func (s *Solver) decodeCpr(now, at time.Time, frame *mode_s.Frame) (lat, lon float64, ok bool) {
+	pair, exists := s.cpr[frame.Icao()]
+	if !exists {
+		pair = &cprPair{}
+		s.cpr[frame.Icao()] = pair
+	}
+	pair.seen = now
+	cpr := &cprFrame{lat: frame.Latitude(), lon: frame.Longitude(), at: at}
+	odd := !frame.IsEven()
+	if odd {
+		pair.odd = cpr
+	} else {
+		pair.even = cpr
+	}
+	if nil == pair.even || nil == pair.odd || pair.even.at.Sub(pair.odd.at).Abs() > cprPairAge {
+		return 0, 0, false
+	}
+	return globalAirborne(pair.even.lat, pair.even.lon, pair.odd.lat, pair.odd.lon, odd)
+}
+
+// addReception adds when a receiver heard a message to the group of receptions of that message,
+// must be called with our lock held
+func (s *Solver) addReception(now, at time.Time, r *receiver, key string, icao uint32, altitude *float64, known *Position, ticks float64) {
+	var g *group
+	for _, candidate := range s.groups[key] {
+		if s.fits(candidate, r, ticks) {
+			g = candidate
+			break
+		}
+	}
+	if nil == g {
+		g = &group{icao: icao, first: now, at: at, altitude: altitude}
+		s.groups[key] = append(s.groups[key], g)
+	}
+	if nil == g.known && nil != known {
+		if k := known.ecef(); k.distance(r.ecef) <= s.maxRange {
+			g.known = &k
+		}
+	}
+	g.receptions = append(g.receptions, reception{receiver: r, ticks: ticks})
+}
+
+// fits tells us if a receiver hearing a message at ticks could have heard the same transmission as our group.
+// Replies like DF11 are the same every time they are sent, so a receiver hearing one again, or a synced receiver
+// hearing it further apart than the signal could have travelled, heard another transmission.
+// Must be called with our lock held
+func (s *Solver) fits(g *group, r *receiver, ticks float64) bool {
+	slack := s.syncError.Seconds() * s.clockHz
+	for _, rec := range g.receptions {
+		if rec.receiver == r {
+			return false
+		}
+		theirTicks, synced := s.toBase(rec.receiver, r, ticks)
+		if !synced {
+			continue
+		}
+		travel := rec.receiver.ecef.distance(r.ecef) / speedOfLight * s.clockHz
+		if math.Abs(theirTicks-rec.ticks) > travel+slack {
+			return false
+		}
+	}
+	return true
+}
+
+func isAirbornePosition(frame *mode_s.Frame) bool {
+	switch frame.DownLinkType() {
+	case 17, 18:
+		switch frame.MessageTypeString() {
+		case mode_s.DF17FrameAirPositionBarometric, mode_s.DF17FrameAirPositionGnss:
+			return true
+		}
+	}
+	return false
+}
+
+// Start looks at our groups of messages as they finish arriving
+func (s *Solver) Start() {
+	s.done = make(chan struct{})
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		ticker := time.NewTicker(s.window / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			case now := <-ticker.C:
+				s.deliver(s.resolve(now))
+			}
+		}
+	}()
+}
+
+// Stop works out what it can from the messages we have left
+func (s *Solver) Stop() {
+	if nil != s.done {
+		close(s.done)
+		s.running.Wait()
+		s.done = nil
+	}
+	s.deliver(s.resolve(time.Now().Add(s.window)))
+}
+
+func (s *Solver) deliver(results []Result) {
+	if nil == s.locator {
+		return
+	}
+	for _, result := range results {
+		if err := s.locator.AddMlatLocation(result.Icao, result.Position.Lat, result.Position.Lon, result.At); nil != err {
+			s.log.Debug().Err(err).Uint32("icao", result.Icao).Send()
+		}
+	}
+}
+
+// resolve syncs our clocks and works out positions from the groups that have finished arriving
+func (s *Solver) resolve(now time.Time) []Result {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	due := make([]*group, 0)
+	for key, groups := range s.groups {
+		waiting := groups[:0]
+		for _, g := range groups {
+			if now.Sub(g.first) >= s.window {
+				due = append(due, g)
+			} else {
+				waiting = append(waiting, g)
+			}
+		}
+		if 0 == len(waiting) {
+			delete(s.groups, key)
+		} else {
+			s.groups[key] = waiting
+		}
+	}
+	for icao, pair := range s.cpr {
+		if now.Sub(pair.seen) > cprPairAge {
+			delete(s.cpr, icao)
+		}
+	}
+	// our clock sync wants its messages in order
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].first.Before(due[j].first)
+	})
+
+	results := make([]Result, 0)
+	for _, g := range due {
+		if len(g.receptions) < 2 {
+			continue
+		}
+		if nil != g.known {
+			s.sync(g)
+			continue
+		}
+		if result, ok := s.solve(g); ok {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+func keyFor(a, b *receiver) (pairKey, bool) {
+	if a.id < b.id {
+		return pairKey{a: a.id, b: b.id}, false
+	}
+	return pairKey{a: b.id, b: a.id}, true
+}
+
+// sync uses a message from a known position to learn how each pair of our receivers clocks relate,
+// must be called with our lock held
+func (s *Solver) sync(g *group) {
+	// when the message left the aircraft, by each receivers clock
+	sent := make([]float64, len(g.receptions))
+	for i, rec := range g.receptions {
+		sent[i] = rec.ticks - rec.receiver.ecef.distance(*g.known)/speedOfLight*s.clockHz
+	}
+	maxAge := s.syncAge.Seconds() * s.clockHz
+	maxError := s.syncError.Seconds() * s.clockHz
+	for i := range g.receptions {
+		for j := i + 1; j < len(g.receptions); j++ {
+			key, swapped := keyFor(g.receptions[i].receiver, g.receptions[j].receiver)
+			pt := syncPoint{a: sent[i], b: sent[j]}
+			if swapped {
+				pt = syncPoint{a: sent[j], b: sent[i]}
+			}
+			cp, ok := s.clocks[key]
+			if !ok {
+				cp = &clockPair{}
+				s.clocks[key] = cp
+			}
+			if !cp.add(pt, syncPoints, maxAge, maxError) {
+				s.log.Debug().Str("a", key.a).Str("b", key.b).Msg("receiver clocks jumped, restarting sync")
+			}
+		}
+	}
+	if nil != s.syncCounter {
+		s.syncCounter.Inc()
+	}
+}
+
+// toBase turns a time on the given receivers clock into a time on the base receivers clock
+func (s *Solver) toBase(base, r *receiver, ticks float64) (float64, bool) {
+	key, swapped := keyFor(base, r)
+	cp, ok := s.clocks[key]
+	if !ok {
+		return 0, false
+	}
+	maxAge := s.syncAge.Seconds() * s.clockHz
+	if swapped {
+		// our base is b
+		return cp.toB(ticks), cp.valid(cp.toB(ticks), maxAge)
+	}
+	return cp.toA(ticks), cp.valid(ticks, maxAge)
+}
+
+// solve works out where the message in our group came from, must be called with our lock held
+func (s *Solver) solve(g *group) (Result, bool) {
+	// our base receiver is the one that is synced with the most of the others
+	var best []tdoa
+	var bestBase *reception
+	var used []string
+	for i := range g.receptions {
+		base := &g.receptions[i]
+		others := make([]tdoa, 0, len(g.receptions)-1)
+		ids := []string{base.receiver.id}
+		for j, rec := range g.receptions {
+			if i == j {
+				continue
+			}
+			if ticks, ok := s.toBase(base.receiver, rec.receiver, rec.ticks); ok {
+				others = append(others, tdoa{pos: rec.receiver.ecef, dt: (ticks - base.ticks) / s.clockHz})
+				ids = append(ids, rec.receiver.id)
+			}
+		}
+		if len(others) > len(best) {
+			best, bestBase, used = others, base, ids
+		}
+	}
+	equations := len(best)
+	if nil != g.altitude {
+		equations++
+	}
+	if nil == bestBase || equations < 3 {
+		return Result{}, false
+	}
+
+	// start looking in the middle of our receivers
+	var centre vec3
+	centre = centre.add(bestBase.receiver.ecef)
+	for _, o := range best {
+		centre = centre.add(o.pos)
+	}
+	guess := centre.scale(1 / float64(len(best)+1)).position()
+	guess.Alt = guessAltitude
+	if nil != g.altitude {
+		guess.Alt = *g.altitude
+	}
+
+	rangeError := s.timingError.Seconds() * speedOfLight
+	x, residual, err := solve(bestBase.receiver.ecef, best, g.altitude, guess.ecef(), rangeError)
+	if nil != err || residual > s.maxResidual {
+		return Result{}, false
+	}
+	nearest := math.MaxFloat64
+	nearest = math.Min(nearest, x.distance(bestBase.receiver.ecef))
+	for _, o := range best {
+		nearest = math.Min(nearest, x.distance(o.pos))
+	}
+	position := x.position()
+	if nearest > s.maxRange || position.Alt < minAltitude || position.Alt > maxAltitude {
+		return Result{}, false
+	}
+
+	if nil != s.solvedCounter {
+		s.solvedCounter.Inc()
+	}
+	return Result{
+		Icao:      g.icao,
+		Position:  position,
+		Receivers: used,
+		At:        g.at,
+		Residual:  residual,
+	}, true
+}
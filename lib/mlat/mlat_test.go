@@ -0,0 +1,240 @@
+package mlat
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+type (
+	// testClock is a receivers free running clock, it started at some point and runs a little fast or slow
+	testClock struct {
+		offset float64
+		drift  float64
+	}
+
+	testLocator struct {
+		sync.Mutex
+		results map[uint32][]Position
+	}
+
+	// testNetwork hears messages sent from known positions, with each receivers clock and a little timing noise
+	testNetwork struct {
+		s      *Solver
+		ids    []string
+		clocks map[string]testClock
+		noise  *rand.Rand
+		start  time.Time
+		sent   int
+	}
+)
+
+func (tl *testLocator) AddMlatLocation(icao uint32, lat, lon float64, ts time.Time) error {
+	tl.Lock()
+	defer tl.Unlock()
+	tl.results[icao] = append(tl.results[icao], Position{Lat: lat, Lon: lon})
+	return nil
+}
+
+func newTestNetwork(locator Locator) *testNetwork {
+	receivers := map[string]Position{
+		"perth":     {Lat: -31.95, Lon: 115.86, Alt: 20},
+		"mandurah":  {Lat: -32.53, Lon: 115.74, Alt: 10},
+		"northam":   {Lat: -31.65, Lon: 116.67, Alt: 170},
+		"pinjarra":  {Lat: -32.63, Lon: 115.87, Alt: 15},
+		"lancelin":  {Lat: -31.02, Lon: 115.33, Alt: 5},
+		"york":      {Lat: -31.89, Lon: 116.77, Alt: 180},
+		"bindoon":   {Lat: -31.38, Lon: 116.10, Alt: 200},
+		"rottnest":  {Lat: -32.00, Lon: 115.52, Alt: 30},
+		"armadale":  {Lat: -32.15, Lon: 116.01, Alt: 60},
+		"toodyay":   {Lat: -31.55, Lon: 116.47, Alt: 140},
+		"wundowie":  {Lat: -31.76, Lon: 116.38, Alt: 290},
+		"jarrahdal": {Lat: -32.34, Lon: 116.06, Alt: 280},
+	}
+	tn := testNetwork{
+		clocks: map[string]testClock{},
+		noise:  rand.New(rand.NewSource(1)),
+		start:  time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC),
+	}
+	opts := []Option{WithGroupWindow(time.Second)}
+	for id, pos := range receivers {
+		opts = append(opts, WithReceiver(id, pos.Lat, pos.Lon, pos.Alt))
+		tn.ids = append(tn.ids, id)
+	}
+	sort.Strings(tn.ids)
+	for i, id := range tn.ids {
+		tn.clocks[id] = testClock{offset: 1e9 * float64(i+1) * 7.3, drift: float64(i*7-30) * 1e-6}
+	}
+	tn.s = NewSolver(locator, opts...)
+	return &tn
+}
+
+// send has the given receivers hear a message sent from pos, at seconds into our test
+func (tn *testNetwork) send(seconds float64, icao uint32, pos Position, known bool, altitude *float64, receivers []string) {
+	tn.sent++
+	tn.sendMessage(fmt.Sprintf("%06X-%d", icao, tn.sent), seconds, icao, pos, known, altitude, receivers)
+}
+
+// sendMessage has the given receivers hear the given message, the same message can be sent more than once
+func (tn *testNetwork) sendMessage(key string, seconds float64, icao uint32, pos Position, known bool, altitude *float64, receivers []string) {
+	now := tn.start.Add(time.Duration(seconds * float64(time.Second)))
+	from := pos.ecef()
+	var knownPos *Position
+	if known {
+		knownPos = &pos
+	}
+	tn.s.lock.Lock()
+	defer tn.s.lock.Unlock()
+	for _, id := range receivers {
+		r := tn.s.receivers[id]
+		clock := tn.clocks[id]
+		heard := seconds + r.ecef.distance(from)/speedOfLight + tn.noise.NormFloat64()*20e-9
+		ticks := clock.offset + (1+clock.drift)*heard*tn.s.clockHz
+		tn.s.addReception(now, now, r, key, icao, altitude, knownPos, ticks)
+	}
+}
+
+// resolve works out everything that has arrived by seconds into our test
+func (tn *testNetwork) resolve(seconds float64) {
+	tn.s.deliver(tn.s.resolve(tn.start.Add(time.Duration(seconds * float64(time.Second)))))
+}
+
+// fly moves a position along at a constant rate, in degrees/second
+func fly(from Position, dLat, dLon, seconds float64) Position {
+	return Position{Lat: from.Lat + dLat*seconds, Lon: from.Lon + dLon*seconds, Alt: from.Alt}
+}
+
+func TestSolver_SyntheticGeometry(t *testing.T) {
+	locator := &testLocator{results: map[uint32][]Position{}}
+	tn := newTestNetwork(locator)
+
+	// two ADS-B aircraft keep our clocks in sync, our Mode S only aircraft is the one we want to find
+	adsb1 := Position{Lat: -31.70, Lon: 115.70, Alt: 9000}
+	adsb2 := Position{Lat: -32.30, Lon: 116.40, Alt: 6000}
+	target := Position{Lat: -32.05, Lon: 115.95, Alt: 3000}
+	targetAlt := target.Alt
+
+	var targets []Position
+	for i := 0; i < 60; i++ {
+		seconds := float64(i) * 0.5
+		tn.send(seconds, 0x7C0001, fly(adsb1, 0.001, 0.002, seconds), true, &adsb1.Alt, tn.ids)
+		tn.send(seconds+0.1, 0x7C0002, fly(adsb2, -0.002, 0.001, seconds+0.1), true, &adsb2.Alt, tn.ids[:8])
+		if i >= 10 {
+			at := fly(target, 0.0015, -0.001, seconds+0.25)
+			targets = append(targets, at)
+			if i%2 == 0 {
+				// with a Mode S altitude reply, we can use it to help
+				tn.send(seconds+0.25, 0x7C0003, at, false, &targetAlt, tn.ids[:4])
+			} else {
+				tn.send(seconds+0.25, 0x7C0003, at, false, nil, tn.ids)
+			}
+		}
+		tn.resolve(seconds - 1)
+	}
+	tn.resolve(60)
+
+	got := locator.results[0x7C0003]
+	if len(got) != len(targets) {
+		t.Fatalf("expected %d positions for our Mode S aircraft, got %d", len(targets), len(got))
+	}
+	for i, pos := range got {
+		want := targets[i]
+		want.Alt = 0
+		pos.Alt = 0
+		if miss := pos.ecef().distance(want.ecef()); miss > 100 {
+			t.Errorf("position %d {%0.4f, %0.4f} is %0.0fm from where our aircraft was {%0.4f, %0.4f}",
+				i, pos.Lat, pos.Lon, miss, want.Lat, want.Lon)
+		}
+	}
+	if _, ok := locator.results[0x7C0001]; ok {
+		t.Errorf("our ADS-B aircraft are for syncing our clocks, not for finding")
+	}
+}
+
+func TestSolver_RepeatedReplies(t *testing.T) {
+	locator := &testLocator{results: map[uint32][]Position{}}
+	tn := newTestNetwork(locator)
+
+	adsb1 := Position{Lat: -31.70, Lon: 115.70, Alt: 9000}
+	adsb2 := Position{Lat: -32.30, Lon: 116.40, Alt: 6000}
+	target := Position{Lat: -32.05, Lon: 115.95, Alt: 3000}
+	targetAlt := target.Alt
+
+	// our Mode S aircraft keeps sending the same reply, a few tenths of a second apart, heard by different receivers
+	const reply = "5D7C0003ABCDEF"
+	var targets []Position
+	for i := 0; i < 60; i++ {
+		seconds := float64(i) * 0.5
+		tn.send(seconds, 0x7C0001, fly(adsb1, 0.001, 0.002, seconds), true, &adsb1.Alt, tn.ids)
+		tn.send(seconds+0.1, 0x7C0002, fly(adsb2, -0.002, 0.001, seconds+0.1), true, &adsb2.Alt, tn.ids)
+		if i >= 10 {
+			first := fly(target, 0.01, -0.01, seconds+0.2)
+			second := fly(target, 0.01, -0.01, seconds+0.4)
+			targets = append(targets, first, second)
+			tn.sendMessage(reply, seconds+0.2, 0x7C0003, first, false, &targetAlt, tn.ids[:8])
+			tn.sendMessage(reply, seconds+0.4, 0x7C0003, second, false, &targetAlt, tn.ids[4:])
+		}
+		tn.resolve(seconds - 1)
+	}
+	tn.resolve(60)
+
+	got := locator.results[0x7C0003]
+	if len(got) != len(targets) {
+		t.Fatalf("expected %d positions for our Mode S aircraft, got %d", len(targets), len(got))
+	}
+	// each transmission has to be solved on its own, in any order
+	for _, pos := range got {
+		pos.Alt = 0
+		nearest := math.MaxFloat64
+		for _, want := range targets {
+			want.Alt = 0
+			nearest = math.Min(nearest, pos.ecef().distance(want.ecef()))
+		}
+		if nearest > 100 {
+			t.Errorf("position {%0.4f, %0.4f} is %0.0fm from where our aircraft sent anything", pos.Lat, pos.Lon, nearest)
+		}
+	}
+}
+
+func TestSolver_NeedsSyncedClocks(t *testing.T) {
+	locator := &testLocator{results: map[uint32][]Position{}}
+	tn := newTestNetwork(locator)
+	target := Position{Lat: -32.05, Lon: 115.95, Alt: 3000}
+
+	// nothing has told us how our receivers clocks relate
+	for i := 0; i < 10; i++ {
+		tn.send(float64(i), 0x7C0003, target, false, nil, tn.ids)
+	}
+	tn.resolve(20)
+	if 0 != len(locator.results) {
+		t.Errorf("expected no positions without our clocks being in sync, got %v", locator.results)
+	}
+}
+
+func TestClockPair_Jump(t *testing.T) {
+	cp := clockPair{}
+	const hz = 12e6
+	for i := 0; i < 5; i++ {
+		b := float64(i) * hz
+		if !cp.add(syncPoint{a: 1e9 + b*(1+10e-6), b: b}, syncPoints, 30*hz, 60) {
+			t.Fatalf("sync point %d should fit our clock", i)
+		}
+	}
+	if !cp.valid(5*hz, 30*hz) {
+		t.Fatalf("expected our clocks to be in sync")
+	}
+	if got := cp.toA(cp.toB(2e9)); got < 2e9-0.01 || got > 2e9+0.01 {
+		t.Errorf("expected toA(toB()) to give us our time back, got %0.3f", got)
+	}
+	// a receiver restarted
+	if cp.add(syncPoint{a: 5e6, b: 5 * hz}, syncPoints, 30*hz, 60) {
+		t.Errorf("expected a clock that jumped to not fit")
+	}
+	if cp.valid(5*hz, 30*hz) {
+		t.Errorf("expected a single sync point after the jump to not be enough")
+	}
+}
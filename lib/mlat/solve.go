@@ -0,0 +1,145 @@
+package mlat
+
+import (
+	"errors"
+	"math"
+)
+
+const (
+	solveMaxIterations = 50
+	// solveConverged is how small a step (in metres) needs to be for us to stop looking
+	solveConverged = 0.01
+	// jacobianStep is how far (in metres) we move to see how our residuals change
+	jacobianStep = 1.0
+	// altitudeError is how far (in metres) a reported altitude is likely to be out, barometric is not geometric
+	altitudeError = 150.0
+)
+
+var ErrNoSolution = errors.New("unable to find a position for these times")
+
+type (
+	// tdoa is a receiver and how long after our base receiver it heard a message, in seconds
+	tdoa struct {
+		pos vec3
+		dt  float64
+	}
+)
+
+// solve finds where a message was sent from, given when each receiver heard it relative to our base receiver.
+// altitude (in metres) is optional and pins our height when we have too few receivers to work it out.
+// rangeError is how far out (in metres) we expect each time difference to be.
+// It gives back the position and the RMS of the residuals, in multiples of their expected error
+func solve(base vec3, others []tdoa, altitude *float64, guess vec3, rangeError float64) (vec3, float64, error) {
+	residuals := func(x vec3) []float64 {
+		r := make([]float64, 0, len(others)+1)
+		baseRange := x.distance(base)
+		for _, o := range others {
+			r = append(r, (x.distance(o.pos)-baseRange-speedOfLight*o.dt)/rangeError)
+		}
+		if nil != altitude {
+			r = append(r, (x.position().Alt-*altitude)/altitudeError)
+		}
+		return r
+	}
+	sumSquares := func(r []float64) float64 {
+		var sum float64
+		for _, v := range r {
+			sum += v * v
+		}
+		return sum
+	}
+
+	x := guess
+	r := residuals(x)
+	if len(r) < 3 {
+		return x, 0, ErrNoSolution
+	}
+	cost := sumSquares(r)
+	lambda := 1e-3
+
+	// Levenberg-Marquardt, Gauss-Newton that backs off when a step makes things worse
+	for iteration := 0; iteration < solveMaxIterations; iteration++ {
+		jacobian := make([]vec3, len(r))
+		for axis := 0; axis < 3; axis++ {
+			stepped := x
+			stepped[axis] += jacobianStep
+			sr := residuals(stepped)
+			for i := range r {
+				jacobian[i][axis] = (sr[i] - r[i]) / jacobianStep
+			}
+		}
+		var jtj [3][3]float64
+		var jtr vec3
+		for i := range r {
+			for a := 0; a < 3; a++ {
+				jtr[a] += jacobian[i][a] * r[i]
+				for b := 0; b < 3; b++ {
+					jtj[a][b] += jacobian[i][a] * jacobian[i][b]
+				}
+			}
+		}
+
+		accepted := false
+		var step vec3
+		for lambda < 1e12 {
+			damped := jtj
+			for a := 0; a < 3; a++ {
+				damped[a][a] += lambda * jtj[a][a]
+			}
+			var ok bool
+			step, ok = solve3(damped, jtr.scale(-1))
+			if !ok {
+				return x, 0, ErrNoSolution
+			}
+			next := x.add(step)
+			nr := residuals(next)
+			if nextCost := sumSquares(nr); nextCost < cost {
+				x, r, cost = next, nr, nextCost
+				lambda /= 10
+				accepted = true
+				break
+			}
+			lambda *= 10
+		}
+		if !accepted || step.length() < solveConverged {
+			break
+		}
+	}
+	if math.IsNaN(cost) {
+		return x, 0, ErrNoSolution
+	}
+	return x, math.Sqrt(cost / float64(len(r))), nil
+}
+
+// solve3 solves m.x = v with gaussian elimination, false if m is singular
+func solve3(m [3][3]float64, v vec3) (vec3, bool) {
+	for col := 0; col < 3; col++ {
+		pivot := col
+		for row := col + 1; row < 3; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return vec3{}, false
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		v[col], v[pivot] = v[pivot], v[col]
+		for row := col + 1; row < 3; row++ {
+			factor := m[row][col] / m[col][col]
+			for c := col; c < 3; c++ {
+				m[row][c] -= factor * m[col][c]
+			}
+			v[row] -= factor * v[col]
+		}
+	}
+	var x vec3
+	for row := 2; row >= 0; row-- {
+		sum := v[row]
+		for c := row + 1; c < 3; c++ {
+			sum -= m[row][c] * x[c]
+		}
+		x[row] = sum / m[row][row]
+	}
+	return x, true
+}
@@ -19,6 +19,9 @@ type (
 var (
 	healthChecks     []HealthCheck
 	healthChecksLock sync.RWMutex
+
+	// mux is our monitoring web servers routes, other parts of our app can add their own to it
+	mux = http.NewServeMux()
 )
 
 func IncludeMonitoringFlags(app *cli.App, defaultPort int) {
@@ -37,8 +40,6 @@ func RunWebServer(c *cli.Context) {
 		monitoringPort := c.Int("monitoring-port")
 		log.Info().Int("Port", monitoringPort).Msgf("Monitoring listener Listener")
 
-		mux := http.NewServeMux()
-
 		mux.Handle("/metrics", promhttp.Handler())
 		mux.HandleFunc("/status", healthCheck)
 
@@ -46,6 +47,12 @@ func RunWebServer(c *cli.Context) {
 	}()
 }
 
+// AddHandler serves something else on our monitoring web server
+func AddHandler(pattern string, handler http.Handler) {
+	log.Debug().Str("pattern", pattern).Msg("Adding Monitoring Handler")
+	mux.Handle(pattern, handler)
+}
+
 func AddHealthCheck(f HealthCheck) {
 	log.Debug().Str("name", f.HealthCheckName()).Msg("Adding Health Check")
 	healthChecksLock.Lock()
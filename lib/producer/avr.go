@@ -8,7 +8,15 @@ import (
 
 func (p *Producer) avrScanner(scan *bufio.Scanner) error {
 	for scan.Scan() {
+		if p.isStopping() {
+			return nil
+		}
 		line := scan.Text()
+		if ts, ok := mode_s.AvrTimeStamp(line); ok {
+			if !p.pace(ts) {
+				continue
+			}
+		}
 		p.addFrame(mode_s.NewFrame(line, time.Now()), &p.FrameSource)
 		p.addDebug("AVR Frame: %s", line)
 		if nil != p.stats.avr {
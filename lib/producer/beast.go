@@ -4,15 +4,16 @@ import (
 	"bufio"
 	"bytes"
 	"plane.watch/lib/tracker/beast"
-	"time"
 )
 
 const tokenBufSize = 1000
 const tokenBufLen = 50
 
 func (p *Producer) beastScanner(scan *bufio.Scanner) error {
-	lastTimeStamp := time.Duration(0)
 	for scan.Scan() {
+		if p.isStopping() {
+			return nil
+		}
 		msg := scan.Bytes()
 		frame, err := beast.NewFrame(msg, false)
 		if nil != err {
@@ -22,12 +23,8 @@ func (p *Producer) beastScanner(scan *bufio.Scanner) error {
 		//if nil == frame {
 		//	continue
 		//}
-		if p.beastDelay {
-			currentTs := frame.BeastTicksNs()
-			if lastTimeStamp > 0 && lastTimeStamp < currentTs {
-				time.Sleep(currentTs - lastTimeStamp)
-			}
-			lastTimeStamp = currentTs
+		if !p.pace(frame.BeastTicksNs()) {
+			continue
 		}
 		p.addFrame(&frame, &p.FrameSource)
 
@@ -2,8 +2,7 @@ package producer
 
 import (
 	"bufio"
-	"compress/bzip2"
-	"compress/gzip"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
@@ -13,38 +12,67 @@ import (
 	"net"
 	"os"
 	"plane.watch/lib/tracker"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	cmdExit = 1
-
-	Avr = iota
+	// noType is what our producer has until it is given one, Avr, Beast and Sbs1 keep the values they had when cmdExit
+	// came before them
+	noType = iota
+	Avr
 	Beast
 	Sbs1
+	// Auto works out the type of frames from the input, only for files and readers
+	Auto
 )
 
 type (
 	Producer struct {
 		tracker.FrameSource
 		producerType int
+		// autoDetect works out our producerType from each input we read
+		autoDetect bool
 
 		out chan tracker.Event
+		// outLock guards closing out, so that we never send on it once it is closed
+		outLock   sync.RWMutex
+		outClosed bool
+		// done is closed once we have finished reading and closed out
+		done chan struct{}
+
+		startOnce, stopOnce sync.Once
 
-		cmdChan chan int
+		splitter bufio.SplitFunc
 
-		splitter   bufio.SplitFunc
-		beastDelay bool
+		// replay controls the pacing of frames read from files
+		replay replayConfig
+		pacer  *replayPacer
+		// stopReading is closed when we are asked to stop reading
+		stopReading chan struct{}
 
 		run func()
 
 		stats struct {
 			avr, beast, sbs1 prometheus.Counter
+			// feedRate and lastFrame are labelled with our source, once we know what it is
+			feedRateVec, lastFrameVec *prometheus.GaugeVec
+			feedRate, lastFrame       prometheus.Gauge
 		}
 
-		hasFetcher, fetcherConnected bool
+		hasFetcher bool
+		// fetcherConnected is written by our fetcher and idle watcher, and read by HealthCheck
+		fetcherConnected atomic.Bool
+		// reportedIdle is set once we have said our source has gone quiet, so that we only say it once
+		reportedIdle atomic.Bool
+
+		// feed keeps track of when we last heard from our source and how busy it is
+		feed feedStats
+		// idleTimeout is how long we wait without a frame before we consider our source stale and reconnect
+		idleTimeout time.Duration
+		// backoffMin and backoffMax control how quickly we retry a failed connection
+		backoffMin, backoffMax time.Duration
 	}
 
 	Option func(*Producer)
@@ -59,8 +87,11 @@ func New(opts ...Option) *Producer {
 			RefLat:           nil,
 			RefLon:           nil,
 		},
-		out:     make(chan tracker.Event, 100),
-		cmdChan: make(chan int),
+		out:         make(chan tracker.Event, 100),
+		done:        make(chan struct{}),
+		stopReading: make(chan struct{}),
+		backoffMin:  defaultBackoffMin,
+		backoffMax:  defaultBackoffMax,
 		run: func() {
 			println("You did not specify any sources")
 			os.Exit(1)
@@ -92,6 +123,8 @@ func producerType(in int) string {
 		return "Beast"
 	case Sbs1:
 		return "SBS1"
+	case Auto:
+		return "Auto"
 	default:
 		return "Unknown"
 	}
@@ -107,23 +140,44 @@ func WithListener(host, port string) Option {
 			if err != nil {
 				// handle error
 				log.Error().Err(err).Str("host:port", addr).Msg("Failed to listen")
+				p.Cleanup()
+				return
 			}
+			go func() {
+				<-p.stopReading
+				_ = ln.Close()
+			}()
+
+			// each connection sends us frames, we only close our output once they have all finished
+			var readers sync.WaitGroup
 			for {
 				conn, errConn := ln.Accept()
 				if errConn != nil {
+					if p.isStopping() {
+						break
+					}
 					// handle error
 					log.Error().Err(errConn).Msg("Failed to accept a connection")
+					continue
 				}
 
+				readers.Add(1)
 				go func(c net.Conn) {
+					defer readers.Done()
+					go func() {
+						<-p.stopReading
+						_ = c.Close()
+					}()
 					scan := bufio.NewScanner(c)
 					scan.Split(p.splitter)
 					errRead := p.readFromScanner(scan)
-					if nil != errRead {
+					if nil != errRead && !p.isStopping() {
 						log.Error().Err(errRead).Msg("No more reading")
 					}
 				}(conn)
 			}
+			readers.Wait()
+			p.Cleanup()
 		}
 	}
 }
@@ -150,6 +204,31 @@ func WithFetcher(host, port string) Option {
 	}
 }
 
+// WithFetcherIdleTimeout forces a reconnect of our fetcher if we have not received a frame in the given time.
+// The source is also reported as unhealthy while it is quiet. A value of 0 disables the idle check.
+func WithFetcherIdleTimeout(idleTimeout time.Duration) Option {
+	return func(p *Producer) {
+		if idleTimeout >= 0 {
+			p.idleTimeout = idleTimeout
+		}
+	}
+}
+
+// WithFetcherBackoff sets how long we wait between connection attempts, starting at min and doubling up to max
+func WithFetcherBackoff(min, max time.Duration) Option {
+	return func(p *Producer) {
+		if min > 0 {
+			p.backoffMin = min
+		}
+		if max > 0 {
+			p.backoffMax = max
+		}
+		if p.backoffMax < p.backoffMin {
+			p.backoffMax = p.backoffMin
+		}
+	}
+}
+
 func WithOriginName(name string) Option {
 	return func(p *Producer) {
 		p.FrameSource.Name = name
@@ -160,32 +239,39 @@ func WithFiles(filePaths []string) Option {
 	return func(p *Producer) {
 		p.run = func() {
 			p.readFiles(filePaths, func(reader io.Reader, fileName string) error {
-				scanner := bufio.NewScanner(reader)
 				p.FrameSource.OriginIdentifier = "file://" + fileName
-				return p.readFromScanner(scanner)
+				return p.readFromReader(reader)
 			})
 		}
 	}
 }
 
+// WithBeastDelay replays files in real time. Deprecated: use WithReplay, which works for all file types
 func WithBeastDelay(beastDelay bool) Option {
 	return func(p *Producer) {
-		p.beastDelay = beastDelay
+		if beastDelay {
+			WithReplay(1)(p)
+		}
 	}
 }
 
 func WithType(producerType int) Option {
 	return func(p *Producer) {
-		switch producerType {
-		case Avr, Sbs1:
-			p.producerType = producerType
-			p.splitter = bufio.ScanLines
-		case Beast:
-			p.producerType = producerType
-			p.splitter = ScanBeast()
-		default:
-			log.Error().Msgf("Unknown Producer Type")
-		}
+		p.autoDetect = Auto == producerType
+		p.setType(producerType)
+	}
+}
+
+func (p *Producer) setType(producerType int) {
+	switch producerType {
+	case Avr, Sbs1, Auto:
+		p.producerType = producerType
+		p.splitter = bufio.ScanLines
+	case Beast:
+		p.producerType = producerType
+		p.splitter = ScanBeast()
+	default:
+		log.Error().Msgf("Unknown Producer Type")
 	}
 }
 
@@ -197,6 +283,27 @@ func WithPrometheusCounters(avr, beast, sbs1 prometheus.Counter) Option {
 	}
 }
 
+// WithFeedMetrics lets us see how many frames a second each source is sending us, and when (unix time) it last sent
+// us one, so that a source that has gone quiet can be spotted. Each is labelled with the sources tag
+func WithFeedMetrics(framesPerSecond, lastFrame *prometheus.GaugeVec) Option {
+	return func(p *Producer) {
+		p.stats.feedRateVec = framesPerSecond
+		p.stats.lastFrameVec = lastFrame
+	}
+}
+
+// updateFeedMetrics tells prometheus how lively our source is
+func (p *Producer) updateFeedMetrics(now time.Time) {
+	if nil != p.stats.feedRate {
+		p.stats.feedRate.Set(p.feed.FramesPerSecond(now))
+	}
+	if nil != p.stats.lastFrame {
+		if last := p.feed.LastFrame(); !last.IsZero() {
+			p.stats.lastFrame.Set(float64(last.UnixNano()) / 1e9)
+		}
+	}
+}
+
 func (p *Producer) readFromScanner(scan *bufio.Scanner) error {
 	scan.Split(p.splitter)
 
@@ -221,16 +328,50 @@ func WithReferenceLatLon(lat, lon float64) Option {
 	}
 }
 
+// WithMaxRange sets how far (in metres) our source can hear, positions further away than this are rejected
+func WithMaxRange(metres float64) Option {
+	return func(p *Producer) {
+		p.MaxRange = metres
+	}
+}
+
 func (p *Producer) String() string {
 	return p.Name
 }
 
+// Listen starts reading from our source (if we have not already started) and gives us the events we produce.
+// The channel is closed once we have stopped reading
 func (p *Producer) Listen() chan tracker.Event {
-	go p.run()
+	p.startOnce.Do(func() {
+		if nil != p.stats.feedRateVec {
+			p.stats.feedRate = p.stats.feedRateVec.WithLabelValues(p.FrameSource.Id())
+		}
+		if nil != p.stats.lastFrameVec {
+			p.stats.lastFrame = p.stats.lastFrameVec.WithLabelValues(p.FrameSource.Id())
+		}
+		go p.run()
+	})
 	return p.out
 }
 
+// Run reads from our source until it runs out or ctx is cancelled. Once cancelled we stop reading and wait until
+// everything we have read has been handed to whoever is listening to us. Our events still need to be read from Listen()
+func (p *Producer) Run(ctx context.Context) error {
+	p.Listen()
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		p.Stop()
+		<-p.done
+		return ctx.Err()
+	}
+}
+
 func (p *Producer) addFrame(f tracker.Frame, s *tracker.FrameSource) {
+	now := time.Now()
+	p.feed.frameReceived(now)
+	p.updateFeedMetrics(now)
 	p.AddEvent(tracker.NewFrameEvent(f, s))
 }
 
@@ -247,89 +388,110 @@ func (p *Producer) addError(err error) {
 }
 
 func (p *Producer) HealthCheck() bool {
+	// our rate drops off when our source goes quiet, even though no frames come in to update it
+	p.updateFeedMetrics(time.Now())
 	if p.hasFetcher {
-		return p.fetcherConnected
+		if !p.fetcherConnected.Load() {
+			return false
+		}
+		if p.idleTimeout > 0 && p.feed.idleFor(time.Now()) > p.idleTimeout {
+			if !p.reportedIdle.Swap(true) {
+				log.Warn().
+					Str("section", p.Name).
+					Time("last frame", p.LastFrameReceived()).
+					Msg("Source has gone quiet")
+			}
+			return false
+		}
+		if p.reportedIdle.Swap(false) {
+			log.Info().Str("section", p.Name).Msg("Source is sending frames again")
+		}
 	}
 	return true
 }
 
+// LastFrameReceived is when we last received a frame from our source
+func (p *Producer) LastFrameReceived() time.Time {
+	return p.feed.LastFrame()
+}
+
+// FramesPerSecond is the rate at which our source is currently sending us frames
+func (p *Producer) FramesPerSecond() float64 {
+	return p.feed.FramesPerSecond(time.Now())
+}
+
 func (p *Producer) HealthCheckName() string {
 	return p.Name
 }
 
+// Stop asks us to stop reading from our source, it does not wait for us to finish. It is safe to call more than once
 func (p *Producer) Stop() {
-	p.cmdChan <- cmdExit
+	p.stopOnce.Do(func() {
+		close(p.stopReading)
+	})
 }
 
+// AddEvent sends our event to whoever is listening to us. Stopping us only stops us reading, anything we have already
+// read is still sent, and once we have finished the event is dropped
 func (p *Producer) AddEvent(e tracker.Event) {
-	defer func() {
-		if r := recover(); nil != r {
-			log.Error().Interface("recover", r).Msg("Failed to add event")
-		}
-	}()
+	p.outLock.RLock()
+	defer p.outLock.RUnlock()
+	if p.outClosed {
+		return
+	}
 	p.out <- e
 }
 
+// Cleanup closes our output once we are done reading. It is safe to call more than once
 func (p *Producer) Cleanup() {
-	defer func() { recover() }()
+	p.outLock.Lock()
+	defer p.outLock.Unlock()
+	if p.outClosed {
+		return
+	}
+	p.outClosed = true
 	close(p.out)
+	close(p.done)
 }
 
 func (p *Producer) readFiles(dataFiles []string, read func(io.Reader, string) error) {
-	var err error
-	var inFile *os.File
-	var gzipFile *gzip.Reader
-	go func() {
-		for _, inFileName := range dataFiles {
-			log.Debug().Str("FileName", inFileName).Msg("Loading contents...")
-			p.FrameSource.OriginIdentifier = "file://" + inFileName
-			inFile, err = os.Open(inFileName)
-			if err != nil {
-				p.addError(fmt.Errorf("failed to open file {%s}: %s", inFileName, err))
-				continue
+	p.readUntilDone(func() {
+		for {
+			if p.replay.active() {
+				p.pacer = newReplayPacer(p.replay.speed, p.replay.seek)
 			}
-
-			isGzip := strings.ToLower(inFileName[len(inFileName)-2:]) == "gz"
-			isBzip2 := strings.ToLower(inFileName[len(inFileName)-3:]) == "bz2"
-			log.Debug().
-				Str("FileName", inFileName).
-				Bool("Is Gzip", isGzip).
-				Bool("Is Bzip2", isBzip2).
-				Bool("Is Plain", !isBzip2 && !isGzip).
-				Msg("Format")
-
-			if isGzip {
-				gzipFile, err = gzip.NewReader(inFile)
-				if nil != err {
-					log.Error().Err(err).Str("file", inFileName).Msg("Failed to open file")
+			for _, inFileName := range dataFiles {
+				if p.isStopping() {
+					break
 				}
-				err = read(gzipFile, inFileName)
-			} else if isBzip2 {
-				bzip2File := bzip2.NewReader(inFile)
-				err = read(bzip2File, inFileName)
-			} else {
-				err = read(inFile, inFileName)
+				p.readFile(inFileName, read)
 			}
-			if nil != err {
-				p.addError(err)
+			if !p.replay.loop || p.isStopping() {
+				break
 			}
-			_ = inFile.Close()
-			log.Debug().
-				Str("FileName", inFileName).
-				Msg("Finished with file")
+			log.Debug().Msg("Replaying files from the start")
 		}
 		log.Debug().Msg("Done loading contents from files")
-		p.Cleanup()
-	}()
+	})
+}
 
-	go func() {
-		for cmd := range p.cmdChan {
-			switch cmd {
-			case cmdExit:
-				return
-			}
-		}
-	}()
+// readFile opens the given file and hands it to read. compression is worked out from the contents by read
+func (p *Producer) readFile(inFileName string, read func(io.Reader, string) error) {
+	log.Debug().Str("FileName", inFileName).Msg("Loading contents...")
+	p.FrameSource.OriginIdentifier = "file://" + inFileName
+	inFile, err := os.Open(inFileName)
+	if err != nil {
+		p.addError(fmt.Errorf("failed to open file {%s}: %s", inFileName, err))
+		return
+	}
+	defer func() { _ = inFile.Close() }()
+
+	if err = read(inFile, inFileName); nil != err {
+		p.addError(fmt.Errorf("failed reading file {%s}: %s", inFileName, err))
+	}
+	log.Debug().
+		Str("FileName", inFileName).
+		Msg("Finished with file")
 }
 
 func (p *Producer) fetcher(host, port string, read func(net.Conn) error) {
@@ -344,7 +506,7 @@ func (p *Producer) fetcher(host, port string, read func(net.Conn) error) {
 	}
 
 	go func() {
-		var backOff = time.Second
+		var backOff = p.backoffMin
 		var err error
 		for isWorking() {
 			p.addDebug("Connecting...")
@@ -352,40 +514,70 @@ func (p *Producer) fetcher(host, port string, read func(net.Conn) error) {
 			conn, err = net.Dial("tcp", net.JoinHostPort(host, port))
 			wLock.Unlock()
 			if nil != err {
-				p.fetcherConnected = false
+				p.fetcherConnected.Store(false)
 				p.addError(err)
-				time.Sleep(backOff)
-				backOff = backOff*2 + ((time.Duration(rand.Intn(20)) * time.Millisecond * 100) - time.Second)
-				if backOff > time.Minute {
-					backOff = time.Minute
+				select {
+				case <-time.After(backOff):
+				case <-p.stopReading:
 				}
+				jitter := (time.Duration(rand.Intn(20)) * time.Millisecond * 100) - time.Second
+				backOff = nextBackoff(backOff, p.backoffMin, p.backoffMax, jitter)
 				continue
 			}
 			p.addDebug("Connected!")
-			backOff = time.Second
-			p.fetcherConnected = true
+			backOff = p.backoffMin
+			p.fetcherConnected.Store(true)
+			p.feed.reset(time.Now())
 
+			stopWatching := p.watchIdle(conn)
 			if err = read(conn); nil != err {
 				p.addError(err)
 			}
+			close(stopWatching)
+			_ = conn.Close()
 		}
 		p.addDebug("Done with Producer %s", p)
 		p.Cleanup()
 	}()
 
 	go func() {
-		for cmd := range p.cmdChan {
-			switch cmd {
-			case cmdExit:
-				p.addDebug("Got Cmd Exit")
-				wLock.Lock()
-				working = false
-				if nil != conn {
+		<-p.stopReading
+		p.addDebug("Stopping fetcher")
+		wLock.Lock()
+		working = false
+		if nil != conn {
+			_ = conn.Close()
+		}
+		wLock.Unlock()
+	}()
+}
+
+// watchIdle closes the given connection if we have not received a frame within our idle timeout.
+// This forces our reader to error out, and the fetcher to reconnect. Close the returned channel to stop watching.
+func (p *Producer) watchIdle(conn net.Conn) chan struct{} {
+	done := make(chan struct{})
+	if p.idleTimeout <= 0 {
+		return done
+	}
+	go func() {
+		ticker := time.NewTicker(p.idleTimeout / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if idle := p.feed.idleFor(now); idle > p.idleTimeout {
+					log.Warn().
+						Str("section", p.Name).
+						Str("idle", idle.String()).
+						Msg("No frames received from source, reconnecting")
+					p.fetcherConnected.Store(false)
 					_ = conn.Close()
+					return
 				}
-				wLock.Unlock()
-				return
 			}
 		}
 	}()
+	return done
 }
@@ -1,9 +1,18 @@
 package producer
 
 import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/rs/zerolog"
+	"io"
+	"net"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func BenchmarkProducer_AddEvent(b *testing.B) {
@@ -24,3 +33,185 @@ func BenchmarkProducer_AddEvent(b *testing.B) {
 	producer.Cleanup()
 	wg.Wait()
 }
+
+func TestProducer_FetcherReconnectsWhenIdle(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	var accepted int32
+	go func() {
+		for {
+			conn, errAccept := ln.Accept()
+			if nil != errAccept {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			// hold the connection open, but never send anything
+			go func(c net.Conn) {
+				_, _ = io.Copy(io.Discard, c)
+			}(conn)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	p := New(
+		WithType(Avr),
+		WithFetcher(host, port),
+		WithFetcherIdleTimeout(100*time.Millisecond),
+		WithFetcherBackoff(10*time.Millisecond, 20*time.Millisecond),
+	)
+	go func() {
+		for range p.Listen() {
+		}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if !p.HealthCheck() {
+		t.Error("Expected a freshly connected source to be healthy")
+	}
+
+	time.Sleep(400 * time.Millisecond)
+	if n := atomic.LoadInt32(&accepted); n < 2 {
+		t.Errorf("Expected the fetcher to reconnect after going idle, only connected %d times", n)
+	}
+
+	p.Stop()
+}
+
+func TestFeedStats(t *testing.T) {
+	var fs feedStats
+	now := time.Now()
+	fs.reset(now)
+	for i := 0; i < 20; i++ {
+		fs.frameReceived(now.Add(time.Duration(i) * 100 * time.Millisecond))
+	}
+	if rate := fs.FramesPerSecond(now.Add(1900 * time.Millisecond)); rate < 9 || rate > 11 {
+		t.Errorf("Expected a rate of ~10 frames/second, got %0.2f", rate)
+	}
+	if idle := fs.idleFor(now.Add(5 * time.Second)); idle != 3100*time.Millisecond {
+		t.Errorf("Expected to be idle for 3.1s, got %s", idle)
+	}
+	if rate := fs.FramesPerSecond(now.Add(10 * time.Second)); rate > 1 {
+		t.Errorf("Expected our rate to drop off when the source is quiet, got %0.2f", rate)
+	}
+}
+
+func TestNextBackoff(t *testing.T) {
+	if b := nextBackoff(time.Second, time.Second, time.Minute, 0); b != 2*time.Second {
+		t.Errorf("Expected backoff to double, got %s", b)
+	}
+	if b := nextBackoff(time.Minute, time.Second, time.Minute, time.Second); b != time.Minute {
+		t.Errorf("Expected backoff to be capped, got %s", b)
+	}
+	if b := nextBackoff(0, time.Second, time.Minute, -time.Second); b != time.Second {
+		t.Errorf("Expected backoff to be at least our minimum, got %s", b)
+	}
+}
+
+func TestProducer_RunStopsWhenCancelled(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	// a source that never stops sending
+	go func() {
+		conn, errAccept := ln.Accept()
+		if nil != errAccept {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		for {
+			if _, errWrite := conn.Write([]byte("*8D7C7F0D581176D7BB8D48CD7714;\n")); nil != errWrite {
+				return
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	p := New(WithType(Avr), WithFetcher(host, port))
+	var received int32
+	listening := make(chan struct{})
+	go func() {
+		for range p.Listen() {
+			atomic.AddInt32(&received, 1)
+		}
+		close(listening)
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for 0 == atomic.LoadInt32(&received) {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	if err = p.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected to be cancelled, got %v", err)
+	}
+	select {
+	case <-listening:
+	case <-time.After(time.Second):
+		t.Fatal("Expected our events to be closed once we stopped")
+	}
+
+	// none of these should block or panic once we are done
+	p.Stop()
+	p.AddEvent(nil)
+	p.Cleanup()
+}
+
+func TestProducer_StopDeliversWhatWasRead(t *testing.T) {
+	r, w := io.Pipe()
+	p := New(WithReader(r, Avr))
+	go func() {
+		// one more frame than we can buffer, so the last one is waiting to be sent when we stop
+		for i := 0; i <= cap(p.out); i++ {
+			if _, err := w.Write([]byte("*8D7C7F0D581176D7BB8D48CD7714;\n")); nil != err {
+				return
+			}
+		}
+	}()
+	events := p.Listen()
+	for len(events) < cap(events) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	p.Stop()
+	_ = w.Close()
+
+	received := 0
+	for range events {
+		received++
+	}
+	if cap(p.out)+1 != received {
+		t.Errorf("Expected every frame we read before stopping to be sent, got %d of %d", received, cap(p.out)+1)
+	}
+}
+
+func TestProducer_FeedMetrics(t *testing.T) {
+	rate := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "rate"}, []string{"source"})
+	last := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "last"}, []string{"source"})
+	before := time.Now()
+	p := New(
+		WithSourceTag("perth"),
+		WithFeedMetrics(rate, last),
+		WithReader(strings.NewReader("*8D7C7F0D581176D7BB8D48CD7714;\n*8D7C7F0D581176D7BB8D48CD7714;\n"), Avr),
+	)
+	for range p.Listen() {
+	}
+	if seen := testutil.ToFloat64(last.WithLabelValues("perth")); seen < float64(before.Unix()) {
+		t.Errorf("Expected our last frame time to be recorded for our source, got %0.0f", seen)
+	}
+
+	p.feed.frameReceived(before.Add(-time.Minute))
+	p.feed.frameReceived(before.Add(-time.Minute + feedRateWindow))
+	p.HealthCheck()
+	if fps := testutil.ToFloat64(rate.WithLabelValues("perth")); fps > 1 {
+		t.Errorf("Expected our rate to drop off once our source is quiet, got %0.2f", fps)
+	}
+}
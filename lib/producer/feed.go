@@ -0,0 +1,99 @@
+package producer
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultBackoffMin = time.Second
+	defaultBackoffMax = time.Minute
+
+	// feedRateWindow is how long we collect frames for before calculating a frames/second value
+	feedRateWindow = time.Second
+)
+
+type (
+	// feedStats keeps track of how lively a source is
+	feedStats struct {
+		mu sync.RWMutex
+
+		lastFrame   time.Time
+		connectedAt time.Time
+
+		windowStart time.Time
+		windowCount uint64
+		rate        float64
+	}
+)
+
+// frameReceived records that we have received a frame from our source
+func (fs *feedStats) frameReceived(now time.Time) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.lastFrame = now
+
+	if fs.windowStart.IsZero() {
+		fs.windowStart = now
+	}
+	fs.windowCount++
+	if elapsed := now.Sub(fs.windowStart); elapsed >= feedRateWindow {
+		fs.rate = float64(fs.windowCount) / elapsed.Seconds()
+		fs.windowStart = now
+		fs.windowCount = 0
+	}
+}
+
+// reset clears the rate calculation, used when we (re)connect to a source
+func (fs *feedStats) reset(now time.Time) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.connectedAt = now
+	fs.windowStart = now
+	fs.windowCount = 0
+	fs.rate = 0
+}
+
+// LastFrame is when we last received a frame from this source
+func (fs *feedStats) LastFrame() time.Time {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.lastFrame
+}
+
+// FramesPerSecond is the rate at which we are receiving frames
+func (fs *feedStats) FramesPerSecond(now time.Time) float64 {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	if fs.windowStart.IsZero() {
+		return 0
+	}
+	// if our source has gone quiet, the rate is whatever we have managed in the current window
+	if elapsed := now.Sub(fs.windowStart); elapsed >= 2*feedRateWindow {
+		return float64(fs.windowCount) / elapsed.Seconds()
+	}
+	return fs.rate
+}
+
+// idleFor tells us how long it has been since we heard from our source, or since we connected if that is later
+func (fs *feedStats) idleFor(now time.Time) time.Duration {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	since := fs.connectedAt
+	if fs.lastFrame.After(since) {
+		since = fs.lastFrame
+	}
+	return now.Sub(since)
+}
+
+// nextBackoff doubles our backoff (with some jitter), keeping it within our min and max
+func nextBackoff(current, min, max time.Duration, jitter time.Duration) time.Duration {
+	next := current*2 + jitter
+	if next < min {
+		next = min
+	}
+	if next > max {
+		next = max
+	}
+	return next
+}
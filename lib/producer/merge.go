@@ -0,0 +1,464 @@
+package producer
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"container/heap"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"plane.watch/lib/tracker"
+	"plane.watch/lib/tracker/beast"
+	"plane.watch/lib/tracker/mode_s"
+	"plane.watch/lib/tracker/sbs1"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	// MergeSource is a set of recordings. Path can be a file, a directory, a glob or a tar archive. When it holds more
+	// than one recording each is its own receiver, tagged with Tag and the name of the recording
+	MergeSource struct {
+		Path   string
+		Format int
+		Tag    string
+		// RefLat and RefLon are where our receivers are. Leave them out for recordings from receivers in different
+		// places, and we work out where each one is from what it hears
+		RefLat *float64
+		RefLon *float64
+		// MaxRange is how far (in metres) the receiver can hear, 0 to use the producers
+		MaxRange float64
+		// Start is when the recording started. Beast and AVR timestamps count from when the receiver was turned on,
+		// so this lines them up with other recordings. SBS1 recordings have their own date/time and do not need it,
+		// but Beast and AVR recordings need it to be merged with them.
+		Start time.Time
+	}
+
+	// mergeFile is a single recording found in a MergeSource
+	mergeFile struct {
+		path, origin string
+		// tag is the recordings own tag, when its source holds more than one recording
+		tag    string
+		source *MergeSource
+	}
+
+	// mergeReader reads frames from a single recording, working out when each frame was received
+	mergeReader struct {
+		source tracker.FrameSource
+		format int
+		scan   *bufio.Scanner
+		closer io.Closer
+		order  int
+
+		start    time.Duration
+		hasFirst bool
+		first    time.Duration
+
+		// frame is the next frame to send, received at ts
+		frame tracker.Frame
+		ts    time.Duration
+		// absolute is set when ts is a date and time, and not how long after the recording started
+		absolute bool
+	}
+
+	mergeQueue []*mergeReader
+)
+
+var tarMagic = []byte("ustar")
+
+// WithMergedFiles reads all the recordings in the given sources at once, sending frames in the order they were received.
+// Each recording keeps the tag and reference lat/lon of its source
+func WithMergedFiles(sources []MergeSource) Option {
+	return func(p *Producer) {
+		if noType == p.producerType {
+			WithType(Auto)(p)
+		}
+		p.FrameSource.OriginIdentifier = "merge://"
+		p.run = func() {
+			p.readUntilDone(func() {
+				files, tmpDirs, err := p.expandMergeSources(sources)
+				defer func() {
+					for _, dir := range tmpDirs {
+						_ = os.RemoveAll(dir)
+					}
+				}()
+				if nil != err {
+					p.addError(err)
+					return
+				}
+				for {
+					if p.replay.active() {
+						p.pacer = newReplayPacer(p.replay.speed, p.replay.seek)
+					}
+					if err = p.mergeFiles(files); nil != err {
+						p.addError(err)
+						break
+					}
+					if !p.replay.loop || p.isStopping() {
+						break
+					}
+					log.Debug().Msg("Replaying merged files from the start")
+				}
+				log.Debug().Msg("Done merging files")
+			})
+		}
+	}
+}
+
+// expandMergeSources finds all the recordings in our sources, extracting tar archives to a temporary directory
+func (p *Producer) expandMergeSources(sources []MergeSource) ([]mergeFile, []string, error) {
+	files := make([]mergeFile, 0)
+	tmpDirs := make([]string, 0)
+	for i := range sources {
+		source := &sources[i]
+		first := len(files)
+		paths, err := expandPath(source.Path)
+		if nil != err {
+			return nil, tmpDirs, err
+		}
+		for _, path := range paths {
+			isTar, errTar := isTarFile(path)
+			if nil != errTar {
+				return nil, tmpDirs, errTar
+			}
+			if !isTar {
+				files = append(files, mergeFile{path: path, origin: "file://" + path, source: source})
+				continue
+			}
+			tmpDir, extracted, errExtract := extractTar(path)
+			if "" != tmpDir {
+				tmpDirs = append(tmpDirs, tmpDir)
+			}
+			if nil != errExtract {
+				return nil, tmpDirs, errExtract
+			}
+			for _, f := range extracted {
+				f.source = source
+				files = append(files, f)
+			}
+		}
+		if len(files)-first > 1 {
+			// each recording is from its own receiver, and needs its own tag to be told apart
+			tag := source.Tag
+			if "" == tag {
+				tag = p.Tag
+			}
+			for j := first; j < len(files); j++ {
+				files[j].tag = recordingTag(tag, files[j].origin)
+			}
+		}
+	}
+	if 0 == len(files) {
+		return nil, tmpDirs, errors.New("no files found to merge")
+	}
+	return files, tmpDirs, nil
+}
+
+// expandPath turns a directory or glob into the list of files it contains
+func expandPath(path string) ([]string, error) {
+	if strings.ContainsAny(path, "*?[") {
+		matches, err := filepath.Glob(path)
+		if nil != err {
+			return nil, fmt.Errorf("invalid glob {%s}: %s", path, err)
+		}
+		sort.Strings(matches)
+		return matches, nil
+	}
+
+	info, err := os.Stat(path)
+	if nil != err {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	paths := make([]string, 0)
+	err = filepath.WalkDir(path, func(name string, d fs.DirEntry, errWalk error) error {
+		if nil != errWalk {
+			return errWalk
+		}
+		if d.Type().IsRegular() {
+			paths = append(paths, name)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// recordingTag tags a recording with the name of the file it came from, e.g. a tag of "perth" and a recording of
+// "file:///data/rx1.avr.gz" gives "perth-rx1"
+func recordingTag(tag, origin string) string {
+	name := filepath.Base(origin)
+	if i := strings.Index(name, "."); i > 0 {
+		name = name[:i]
+	}
+	if "" == tag {
+		return name
+	}
+	return tag + "-" + name
+}
+
+// isTarFile checks the (decompressed) contents of a file for the tar magic
+func isTarFile(path string) (bool, error) {
+	f, err := os.Open(path)
+	if nil != err {
+		return false, err
+	}
+	defer func() { _ = f.Close() }()
+	in, _, err := decompress(bufio.NewReader(f))
+	if nil != err {
+		// not something we can decompress, let our reader complain about it later
+		return false, nil
+	}
+	header, _ := bufio.NewReaderSize(in, 512).Peek(262)
+	return len(header) >= 262 && bytes.Equal(tarMagic, header[257:262]), nil
+}
+
+// extractTar writes each file in the archive to a temporary directory, so that we can read them all at the same time
+func extractTar(path string) (string, []mergeFile, error) {
+	f, err := os.Open(path)
+	if nil != err {
+		return "", nil, err
+	}
+	defer func() { _ = f.Close() }()
+	in, _, err := decompress(bufio.NewReader(f))
+	if nil != err {
+		return "", nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "pw-merge-")
+	if nil != err {
+		return "", nil, err
+	}
+	files := make([]mergeFile, 0)
+	archive := tar.NewReader(in)
+	for {
+		header, errNext := archive.Next()
+		if io.EOF == errNext {
+			break
+		}
+		if nil != errNext {
+			return tmpDir, nil, fmt.Errorf("failed to read tar file {%s}: %s", path, errNext)
+		}
+		if tar.TypeReg != header.Typeflag {
+			continue
+		}
+		// do not trust the names in the archive, they could point anywhere
+		tmpName := filepath.Join(tmpDir, fmt.Sprintf("%d-%s", len(files), filepath.Base(header.Name)))
+		out, errCreate := os.Create(tmpName)
+		if nil != errCreate {
+			return tmpDir, nil, errCreate
+		}
+		_, errCopy := io.Copy(out, archive)
+		_ = out.Close()
+		if nil != errCopy {
+			return tmpDir, nil, fmt.Errorf("failed to extract {%s} from {%s}: %s", header.Name, path, errCopy)
+		}
+		files = append(files, mergeFile{path: tmpName, origin: "tar://" + path + "/" + header.Name})
+	}
+	return tmpDir, files, nil
+}
+
+// mergeFiles opens all of our files and sends their frames in timestamp order. Recordings timed from when they
+// started cannot be merged with ones that have a date and time
+func (p *Producer) mergeFiles(files []mergeFile) error {
+	queue := make(mergeQueue, 0, len(files))
+	defer func() {
+		for _, mr := range queue {
+			_ = mr.closer.Close()
+		}
+	}()
+	for i, file := range files {
+		mr, err := p.newMergeReader(file, i)
+		if nil != err {
+			p.addError(err)
+			continue
+		}
+		if mr.next() {
+			queue = append(queue, mr)
+		} else {
+			_ = mr.closer.Close()
+		}
+	}
+	for _, mr := range queue {
+		if mr.absolute != queue[0].absolute {
+			return errors.New("cannot merge Beast or AVR recordings without a start time with recordings that have a date and time")
+		}
+	}
+	heap.Init(&queue)
+
+	for queue.Len() > 0 {
+		if p.isStopping() {
+			return nil
+		}
+		mr := queue[0]
+		if p.pace(mr.ts) {
+			p.addFrame(mr.frame, &mr.source)
+			p.countFrame(mr.format)
+		}
+		if mr.next() {
+			heap.Fix(&queue, 0)
+		} else {
+			if err := mr.scan.Err(); nil != err {
+				p.addError(fmt.Errorf("failed reading {%s}: %s", mr.source.OriginIdentifier, err))
+			}
+			_ = mr.closer.Close()
+			heap.Pop(&queue)
+		}
+	}
+	return nil
+}
+
+func (p *Producer) newMergeReader(file mergeFile, order int) (*mergeReader, error) {
+	f, err := os.Open(file.path)
+	if nil != err {
+		return nil, fmt.Errorf("failed to open file {%s}: %s", file.path, err)
+	}
+	in, _, err := decompress(bufio.NewReader(f))
+	if nil != err {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to open file {%s}: %s", file.path, err)
+	}
+	buffered := bufio.NewReader(in)
+
+	format := file.source.Format
+	if Avr != format && Beast != format && Sbs1 != format {
+		format = p.producerType
+	}
+	if Auto == format || noType == format {
+		format, err = detectFormat(buffered)
+		if nil != err {
+			_ = f.Close()
+			return nil, fmt.Errorf("{%s}: %s", file.path, err)
+		}
+	}
+
+	mr := &mergeReader{
+		source: tracker.FrameSource{
+			OriginIdentifier: file.origin,
+			Name:             p.Name,
+			Tag:              p.Tag,
+			RefLat:           p.RefLat,
+			RefLon:           p.RefLon,
+			MaxRange:         p.MaxRange,
+		},
+		format: format,
+		scan:   bufio.NewScanner(buffered),
+		closer: f,
+		order:  order,
+	}
+	if "" != file.source.Tag {
+		mr.source.Tag = file.source.Tag
+	}
+	if "" != file.tag {
+		mr.source.Tag = file.tag
+	}
+	if nil != file.source.RefLat && nil != file.source.RefLon {
+		mr.source.RefLat = file.source.RefLat
+		mr.source.RefLon = file.source.RefLon
+	}
+	if file.source.MaxRange > 0 {
+		mr.source.MaxRange = file.source.MaxRange
+	}
+	if !file.source.Start.IsZero() {
+		mr.start = time.Duration(file.source.Start.UnixNano())
+	}
+	mr.absolute = Sbs1 == format || !file.source.Start.IsZero()
+	mr.ts = mr.start
+	if Beast == format {
+		mr.scan.Split(ScanBeast())
+	}
+	return mr, nil
+}
+
+// next reads the next frame from our recording, returns false when there are no more
+func (mr *mergeReader) next() bool {
+	last := mr.ts
+	for mr.scan.Scan() {
+		switch mr.format {
+		case Beast:
+			frame, err := beast.NewFrame(mr.scan.Bytes(), false)
+			if nil != err {
+				continue
+			}
+			mr.frame = &frame
+			mr.ts = mr.fromTicks(frame.BeastTicksNs(), last)
+		case Avr:
+			line := mr.scan.Text()
+			mr.frame = mode_s.NewFrame(line, time.Now())
+			mr.ts = last
+			if ts, ok := mode_s.AvrTimeStamp(line); ok {
+				mr.ts = mr.fromTicks(ts, last)
+			}
+		case Sbs1:
+			line := mr.scan.Text()
+			mr.frame = sbs1.NewFrame(line)
+			mr.ts = last
+			if ts, err := sbs1.ParseTimeStamp(line); nil == err {
+				mr.ts = time.Duration(ts.UnixNano())
+			}
+		default:
+			return false
+		}
+		if mr.ts < last {
+			// keep each recording in its own order, even if the receiver was restarted
+			mr.ts = last
+		}
+		return true
+	}
+	return false
+}
+
+// fromTicks turns a receivers timestamp into when the frame was received, based on when the recording started
+func (mr *mergeReader) fromTicks(ticks, last time.Duration) time.Duration {
+	if 0 == ticks {
+		return last
+	}
+	if !mr.hasFirst {
+		mr.hasFirst = true
+		mr.first = ticks
+	}
+	return mr.start + ticks - mr.first
+}
+
+func (mq mergeQueue) Len() int { return len(mq) }
+func (mq mergeQueue) Less(i, j int) bool {
+	if mq[i].ts == mq[j].ts {
+		return mq[i].order < mq[j].order
+	}
+	return mq[i].ts < mq[j].ts
+}
+func (mq mergeQueue) Swap(i, j int)       { mq[i], mq[j] = mq[j], mq[i] }
+func (mq *mergeQueue) Push(x interface{}) { *mq = append(*mq, x.(*mergeReader)) }
+func (mq *mergeQueue) Pop() interface{} {
+	old := *mq
+	n := len(old)
+	mr := old[n-1]
+	*mq = old[:n-1]
+	return mr
+}
+
+// countFrame updates our prometheus counters for the given type of frame
+func (p *Producer) countFrame(format int) {
+	switch format {
+	case Avr:
+		if nil != p.stats.avr {
+			p.stats.avr.Inc()
+		}
+	case Beast:
+		if nil != p.stats.beast {
+			p.stats.beast.Inc()
+		}
+	case Sbs1:
+		if nil != p.stats.sbs1 {
+			p.stats.sbs1.Inc()
+		}
+	}
+}
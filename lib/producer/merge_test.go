@@ -0,0 +1,135 @@
+package producer
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"plane.watch/lib/tracker"
+	"plane.watch/lib/tracker/sbs1"
+	"testing"
+	"time"
+)
+
+func writeTestFile(t *testing.T, name, contents string) {
+	if err := os.WriteFile(name, []byte(contents), 0644); nil != err {
+		t.Fatal(err)
+	}
+}
+
+func collectMerged(t *testing.T, sources []MergeSource) []*tracker.FrameEvent {
+	p := New(WithMergedFiles(sources))
+	events := make([]*tracker.FrameEvent, 0)
+	for e := range p.Listen() {
+		fe, ok := e.(*tracker.FrameEvent)
+		if !ok {
+			t.Fatalf("Unexpected event %s", e)
+		}
+		events = append(events, fe)
+	}
+	return events
+}
+
+func TestWithMergedFiles_Sbs1Directory(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.sbs1"),
+		"MSG,8,1,1,7C12C3,1,2021/03/27,10:00:00.000,2021/03/27,10:00:00.000,,,,,,,,,,,,0\n"+
+			"MSG,8,1,1,7C12C3,1,2021/03/27,10:00:02.000,2021/03/27,10:00:02.000,,,,,,,,,,,,0\n")
+	writeTestFile(t, filepath.Join(dir, "b.sbs1"),
+		"MSG,8,1,1,7C1B17,1,2021/03/27,10:00:01.000,2021/03/27,10:00:01.000,,,,,,,,,,,,0\n"+
+			"MSG,8,1,1,7C1B17,1,2021/03/27,10:00:03.000,2021/03/27,10:00:03.000,,,,,,,,,,,,0\n")
+
+	events := collectMerged(t, []MergeSource{{Path: dir, Tag: "dir"}})
+	if 4 != len(events) {
+		t.Fatalf("Expected 4 frames, got %d", len(events))
+	}
+	want := []string{"7C12C3", "7C1B17", "7C12C3", "7C1B17"}
+	wantTags := []string{"dir-a", "dir-b", "dir-a", "dir-b"}
+	for i, e := range events {
+		f := e.Frame().(*sbs1.Frame)
+		if err := f.Parse(); nil != err {
+			t.Fatal(err)
+		}
+		if want[i] != f.IcaoStr() {
+			t.Errorf("Frame %d out of order, expected %s got %s", i, want[i], f.IcaoStr())
+		}
+		if wantTags[i] != e.Source().Tag {
+			t.Errorf("Expected each recording to have its own tag %s, got %s", wantTags[i], e.Source().Tag)
+		}
+	}
+}
+
+func TestWithMergedFiles_MixedTimeBases(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.sbs1"),
+		"MSG,8,1,1,7C12C3,1,2021/03/27,10:00:00.000,2021/03/27,10:00:00.000,,,,,,,,,,,,0\n")
+	writeTestFile(t, filepath.Join(dir, "b.avr"), "@000000000001*8D7C1B17582F46CBFF85DB3BC793;\n")
+
+	sources := []MergeSource{{Path: filepath.Join(dir, "a.sbs1")}, {Path: filepath.Join(dir, "b.avr")}}
+	if events := collectMerged(t, sources); 0 != len(events) {
+		t.Errorf("Expected recordings without a start time to not be merged with ones that have a date, got %d frames", len(events))
+	}
+
+	start, _ := time.Parse(time.RFC3339, "2021-03-27T09:59:59Z")
+	sources[1].Start = start
+	events := collectMerged(t, sources)
+	if 2 != len(events) {
+		t.Fatalf("Expected 2 frames once we know when our AVR recording started, got %d", len(events))
+	}
+	if _, ok := events[0].Frame().(*sbs1.Frame); ok {
+		t.Errorf("Expected our AVR frame to come first")
+	}
+}
+
+func TestWithMergedFiles_AvrGlobAndTar(t *testing.T) {
+	dir := t.TempDir()
+	// receiver a has been on for a while, receiver b was only just turned on. both started recording at the same time
+	writeTestFile(t, filepath.Join(dir, "a.avr"),
+		"@100000000000*8D7C12C35811D278E63B2EBB12CC;\n"+
+			"@100000BB8000*8D7C12C399C4E50AD804081C4F54;\n")
+
+	tarName := filepath.Join(dir, "b.tar.gz")
+	tf, err := os.Create(tarName)
+	if nil != err {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(tf)
+	tw := tar.NewWriter(gz)
+	contents := []byte("@000000000001*8D7C1B17582F46CBFF85DB3BC793;\n" +
+		"@000000BB8001*8D7C1B1799142F0E80300AF23F8A;\n")
+	_ = tw.WriteHeader(&tar.Header{Name: "../../b.avr", Mode: 0644, Size: int64(len(contents)), Typeflag: tar.TypeReg})
+	_, _ = tw.Write(contents)
+	_ = tw.Close()
+	_ = gz.Close()
+	_ = tf.Close()
+
+	refLat, refLon := -31.9, 115.9
+	events := collectMerged(t, []MergeSource{
+		{Path: filepath.Join(dir, "*.avr"), Tag: "a"},
+		{Path: tarName, Tag: "b", RefLat: &refLat, RefLon: &refLon},
+	})
+	if 4 != len(events) {
+		t.Fatalf("Expected 4 frames, got %d", len(events))
+	}
+	wantTags := []string{"a", "b", "a", "b"}
+	for i, e := range events {
+		if wantTags[i] != e.Source().Tag {
+			t.Errorf("Frame %d out of order, expected %s got %s", i, wantTags[i], e.Source().Tag)
+		}
+		if "b" == e.Source().Tag && (nil == e.Source().RefLat || refLat != *e.Source().RefLat) {
+			t.Errorf("Expected our reference position to be kept")
+		}
+	}
+	if matches, _ := filepath.Glob(filepath.Join(os.TempDir(), "b.avr")); 0 != len(matches) {
+		t.Errorf("Tar extraction escaped our temporary directory")
+	}
+}
+
+func TestWithMergedFiles_Type(t *testing.T) {
+	if p := New(WithMergedFiles(nil)); Auto != p.producerType {
+		t.Errorf("Expected merged files to work out their own type, got %s", producerType(p.producerType))
+	}
+	if p := New(WithType(Avr), WithMergedFiles(nil)); Avr != p.producerType {
+		t.Errorf("Expected merged files to keep the type we gave them, got %s", producerType(p.producerType))
+	}
+}
@@ -0,0 +1,172 @@
+package producer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/rs/zerolog/log"
+	"github.com/ulikunitz/xz"
+	"io"
+	"os"
+)
+
+const (
+	// sniffLen is how much of a stream we look at to work out what format it is in
+	sniffLen = 64
+)
+
+var (
+	magicGzip  = []byte{0x1f, 0x8b}
+	magicBzip2 = []byte("BZh")
+	magicZstd  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	magicXz    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+
+	sbs1Prefixes = [][]byte{[]byte("MSG,"), []byte("SEL,"), []byte("ID,"), []byte("AIR,"), []byte("STA,"), []byte("CLK,")}
+
+	ErrUnknownFormat = errors.New("unable to determine the format of the input")
+)
+
+// WithReader reads frames from the given reader, it is decompressed if needed.
+// Use Auto as the format to work out what type of frames we are reading
+func WithReader(reader io.Reader, format int) Option {
+	return func(p *Producer) {
+		WithType(format)(p)
+		if "" == p.FrameSource.OriginIdentifier {
+			p.FrameSource.OriginIdentifier = "reader://"
+		}
+		p.run = func() {
+			p.readUntilDone(func() {
+				if err := p.readFromReader(reader); nil != err {
+					p.addError(err)
+				}
+			})
+		}
+	}
+}
+
+// WithStdin reads frames from stdin, e.g. rtl_adsb | pw_ingest
+func WithStdin(format int) Option {
+	return func(p *Producer) {
+		p.FrameSource.OriginIdentifier = "stdin://"
+		WithReader(os.Stdin, format)(p)
+	}
+}
+
+// WithNamedPipe reads frames from a named pipe (FIFO)
+func WithNamedPipe(pipePath string, format int) Option {
+	return func(p *Producer) {
+		WithType(format)(p)
+		p.FrameSource.OriginIdentifier = "pipe://" + pipePath
+		p.run = func() {
+			// opened read/write so that opening does not block waiting for a writer, and so we do not
+			// see EOF each time a writer goes away
+			pipe, err := os.OpenFile(pipePath, os.O_RDWR, os.ModeNamedPipe)
+			if nil != err {
+				p.addError(fmt.Errorf("failed to open pipe {%s}: %s", pipePath, err))
+				p.Cleanup()
+				return
+			}
+			p.readUntilDone(func() {
+				if errRead := p.readFromReader(pipe); nil != errRead && !errors.Is(errRead, os.ErrClosed) {
+					p.addError(errRead)
+				}
+			})
+			go func() {
+				<-p.stopReading
+				_ = pipe.Close()
+			}()
+		}
+	}
+}
+
+// readUntilDone runs our reader in the background, cleaning up once it is done. Our readers check isStopping()
+// so that they finish early when we are told to stop
+func (p *Producer) readUntilDone(read func()) {
+	go func() {
+		read()
+		p.Cleanup()
+	}()
+}
+
+// readFromReader works out if our input is compressed and what format it is in before reading it
+func (p *Producer) readFromReader(reader io.Reader) error {
+	in, compression, err := decompress(bufio.NewReader(reader))
+	if nil != err {
+		return err
+	}
+	buffered := bufio.NewReader(in)
+	if p.autoDetect {
+		format, errDetect := detectFormat(buffered)
+		if nil != errDetect {
+			return errDetect
+		}
+		p.setType(format)
+	}
+	log.Debug().
+		Str("section", p.Name).
+		Str("compression", compression).
+		Str("format", producerType(p.producerType)).
+		Msg("Reading")
+
+	return p.readFromScanner(bufio.NewScanner(buffered))
+}
+
+// decompress looks at the start of our stream and transparently decompresses it if needed
+func decompress(in *bufio.Reader) (io.Reader, string, error) {
+	// an error here just means we have a short input, which is fine
+	head, _ := in.Peek(len(magicXz))
+
+	switch {
+	case bytes.HasPrefix(head, magicGzip):
+		r, err := gzip.NewReader(in)
+		return r, "gzip", err
+	case bytes.HasPrefix(head, magicBzip2):
+		return bzip2.NewReader(in), "bzip2", nil
+	case bytes.HasPrefix(head, magicZstd):
+		// a single decoder decodes synchronously, so we do not leave goroutines behind when we are done
+		r, err := zstd.NewReader(in, zstd.WithDecoderConcurrency(1))
+		if nil != err {
+			return nil, "zstd", err
+		}
+		return r.IOReadCloser(), "zstd", nil
+	case bytes.HasPrefix(head, magicXz):
+		r, err := xz.NewReader(in)
+		return r, "xz", err
+	default:
+		return in, "none", nil
+	}
+}
+
+// detectFormat looks at the start of our stream to figure out if it is Beast, AVR or SBS1
+func detectFormat(in *bufio.Reader) (int, error) {
+	head, _ := in.Peek(sniffLen)
+	if 0 == len(head) {
+		return Auto, ErrUnknownFormat
+	}
+
+	// beast frames are escaped with 0x1A followed by the message type
+	for i := 0; i < len(head)-1; i++ {
+		if 0x1A == head[i] && head[i+1] >= 0x31 && head[i+1] <= 0x34 {
+			return Beast, nil
+		}
+	}
+
+	text := bytes.TrimLeft(head, " \t\r\n")
+	if 0 == len(text) {
+		return Auto, ErrUnknownFormat
+	}
+	switch text[0] {
+	case '*', '@', '%', '<':
+		return Avr, nil
+	}
+	for _, prefix := range sbs1Prefixes {
+		if bytes.HasPrefix(text, prefix) {
+			return Sbs1, nil
+		}
+	}
+	return Auto, ErrUnknownFormat
+}
@@ -0,0 +1,104 @@
+package producer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"io"
+	"strings"
+	"testing"
+)
+
+const avrSample = "*8D7C12C35811D278E63B2EBB12CC;\n*8D7C12C399C4E50AD804081C4F54;\n"
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  int
+	}{
+		{name: "avr", input: []byte(avrSample), want: Avr},
+		{name: "avr timestamped", input: []byte("@016CE3671AA88D00199A8BB80030A8000628F400;\n"), want: Avr},
+		{name: "avr signal level", input: []byte("\n<016CE3671AA8C88D00199A8BB80030A8000628F400;\n"), want: Avr},
+		{name: "sbs1", input: []byte("MSG,3,1,1,7C12C3,1,2021/03/27,10:00:00.000,2021/03/27,10:00:00.000,,35000,,,-31.9,115.9,,,0,,0,0\n"), want: Sbs1},
+		{name: "beast", input: []byte{0x1A, 0x32, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0xAA, 0x5D, 0x7C, 0x12, 0xC3, 0x00, 0x00, 0x00}, want: Beast},
+		{name: "garbage", input: []byte("hello world"), want: Auto},
+		{name: "empty", input: []byte{}, want: Auto},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := detectFormat(bufio.NewReader(bytes.NewReader(tt.input)))
+			if got != tt.want {
+				t.Errorf("detectFormat() = %s, want %s", producerType(got), producerType(tt.want))
+			}
+			if (Auto == tt.want) != (nil != err) {
+				t.Errorf("unexpected error state: %s", err)
+			}
+		})
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	compressors := map[string]func(io.Writer) io.WriteCloser{
+		"none": func(w io.Writer) io.WriteCloser { return nopWriteCloser{w} },
+		"gzip": func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"zstd": func(w io.Writer) io.WriteCloser {
+			z, _ := zstd.NewWriter(w)
+			return z
+		},
+		"xz": func(w io.Writer) io.WriteCloser {
+			x, _ := xz.NewWriter(w)
+			return x
+		},
+	}
+	for name, compressor := range compressors {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := compressor(&buf)
+			_, _ = w.Write([]byte(avrSample))
+			_ = w.Close()
+
+			r, compression, err := decompress(bufio.NewReader(&buf))
+			if nil != err {
+				t.Fatal(err)
+			}
+			if name != compression {
+				t.Errorf("Expected compression %s, got %s", name, compression)
+			}
+			out, err := io.ReadAll(r)
+			if nil != err {
+				t.Fatal(err)
+			}
+			if avrSample != string(out) {
+				t.Errorf("Incorrectly decompressed, got %s", out)
+			}
+		})
+	}
+}
+
+func TestWithReader_AutoDetect(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write([]byte(strings.Repeat(avrSample, 5)))
+	_ = gz.Close()
+
+	p := New(WithReader(&buf, Auto))
+	count := 0
+	for range p.Listen() {
+		count++
+	}
+	if 10 != count {
+		t.Errorf("Expected 10 frames, got %d", count)
+	}
+	if Avr != p.producerType {
+		t.Errorf("Expected our input to be detected as AVR, got %s", producerType(p.producerType))
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,141 @@
+package producer
+
+import (
+	"time"
+)
+
+type (
+	// replayConfig controls how we play back recorded files
+	replayConfig struct {
+		// speed is our playback multiplier, 2 is twice as fast as real time. 0 sends frames as fast as we read them
+		speed float64
+		// seek skips this far into the recording before we start sending frames
+		seek time.Duration
+		// loop starts the recording over once we reach the end
+		loop bool
+	}
+
+	// replayPacer works out how long we need to wait before sending a frame so that frames are sent
+	// at the rate they were recorded at
+	replayPacer struct {
+		// speed is our playback multiplier, 0 for no pacing
+		speed float64
+		seek  time.Duration
+
+		started, based bool
+		// first is the timestamp of the first frame of the recording
+		first time.Duration
+		// base is the recording timestamp that matches wallBase
+		base     time.Duration
+		wallBase time.Time
+		last     time.Duration
+	}
+)
+
+// active tells us if we need a pacer, to pace our frames or to seek into the recording
+func (rc replayConfig) active() bool {
+	return rc.speed > 0 || rc.seek > 0
+}
+
+func newReplayPacer(speed float64, seek time.Duration) *replayPacer {
+	if speed < 0 {
+		speed = 0
+	}
+	return &replayPacer{
+		speed: speed,
+		seek:  seek,
+	}
+}
+
+// delay tells us if we should skip this frame (because we are seeking) or how long we need to wait before sending it.
+// ts is the frames timestamp in the recording
+func (rp *replayPacer) delay(ts time.Duration, now time.Time) (skip bool, wait time.Duration) {
+	if !rp.started {
+		rp.started = true
+		rp.first = ts
+	}
+	if !rp.based {
+		if ts-rp.first < rp.seek {
+			return true, 0
+		}
+		rp.rebase(ts, now)
+		return false, 0
+	}
+
+	if ts < rp.last {
+		// our timestamps went backwards, most likely a new file or a receiver that restarted
+		rp.rebase(ts, now)
+		return false, 0
+	}
+	rp.last = ts
+	if 0 == rp.speed {
+		return false, 0
+	}
+
+	target := rp.wallBase.Add(time.Duration(float64(ts-rp.base) / rp.speed))
+	return false, target.Sub(now)
+}
+
+func (rp *replayPacer) rebase(ts time.Duration, now time.Time) {
+	rp.based = true
+	rp.base = ts
+	rp.last = ts
+	rp.wallBase = now
+}
+
+// WithReplay paces the reading of files by the timestamps in the recording. speed is a multiplier, 1 is real time
+// and 0 sends frames as fast as we can read them
+func WithReplay(speed float64) Option {
+	return func(p *Producer) {
+		p.replay.speed = speed
+	}
+}
+
+// WithReplaySeek skips the given amount of the recording before we start sending frames. It does not pace the
+// frames after it, that is up to WithReplay
+func WithReplaySeek(seek time.Duration) Option {
+	return func(p *Producer) {
+		if seek > 0 {
+			p.replay.seek = seek
+		}
+	}
+}
+
+// WithReplayLoop starts reading our files from the start once we have reached the end
+func WithReplayLoop(loop bool) Option {
+	return func(p *Producer) {
+		p.replay.loop = loop
+	}
+}
+
+// pace waits until it is time to send a frame with the given recording timestamp.
+// returns false if the frame should not be sent
+func (p *Producer) pace(ts time.Duration) bool {
+	if nil == p.pacer {
+		return true
+	}
+	skip, wait := p.pacer.delay(ts, time.Now())
+	if skip {
+		return false
+	}
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-p.stopReading:
+			return false
+		}
+	}
+	return true
+}
+
+// isStopping is true once we have been asked to stop reading
+func (p *Producer) isStopping() bool {
+	select {
+	case <-p.stopReading:
+		return true
+	default:
+		return false
+	}
+}
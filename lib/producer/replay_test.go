@@ -0,0 +1,80 @@
+package producer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReplayPacer_Delay(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		speed    float64
+		seek     time.Duration
+		ts       time.Duration
+		now      time.Time
+		wantSkip bool
+		wantWait time.Duration
+	}{
+		{name: "first frame is sent straight away", speed: 1, ts: 10 * time.Second, now: now, wantWait: 0},
+		{name: "second frame waits", speed: 1, ts: 11 * time.Second, now: now, wantWait: time.Second},
+		{name: "waits less once time has passed", speed: 1, ts: 12 * time.Second, now: now.Add(time.Second), wantWait: time.Second},
+		{name: "backwards time rebases", speed: 1, ts: 5 * time.Second, now: now.Add(2 * time.Second), wantWait: 0},
+		{name: "continues after rebase", speed: 1, ts: 6 * time.Second, now: now.Add(2 * time.Second), wantWait: time.Second},
+	}
+	rp := newReplayPacer(1, 0)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			skip, wait := rp.delay(tt.ts, tt.now)
+			if skip != tt.wantSkip {
+				t.Errorf("skip = %t, want %t", skip, tt.wantSkip)
+			}
+			if wait != tt.wantWait {
+				t.Errorf("wait = %s, want %s", wait, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestReplayPacer_SpeedAndSeek(t *testing.T) {
+	now := time.Now()
+	rp := newReplayPacer(4, 10*time.Second)
+
+	if skip, _ := rp.delay(100*time.Second, now); !skip {
+		t.Error("Expected the first frame to be skipped while seeking")
+	}
+	if skip, _ := rp.delay(109*time.Second, now); !skip {
+		t.Error("Expected frames before our seek offset to be skipped")
+	}
+	if skip, wait := rp.delay(110*time.Second, now); skip || 0 != wait {
+		t.Errorf("Expected the frame at our seek offset to be sent straight away, skip=%t wait=%s", skip, wait)
+	}
+	if _, wait := rp.delay(114*time.Second, now); time.Second != wait {
+		t.Errorf("Expected 4 seconds of recording to take 1 second at 4x, got %s", wait)
+	}
+}
+
+func TestReplayPacer_SeekWithoutPacing(t *testing.T) {
+	now := time.Now()
+	rp := newReplayPacer(0, 10*time.Second)
+	if skip, _ := rp.delay(100*time.Second, now); !skip {
+		t.Error("Expected frames before our seek offset to be skipped")
+	}
+	if skip, wait := rp.delay(110*time.Second, now); skip || 0 != wait {
+		t.Errorf("Expected the frame at our seek offset to be sent, skip=%t wait=%s", skip, wait)
+	}
+	if skip, wait := rp.delay(200*time.Second, now); skip || 0 != wait {
+		t.Errorf("Expected frames after our seek to be sent without waiting, skip=%t wait=%s", skip, wait)
+	}
+}
+
+func TestWithReplaySeek_OptionOrder(t *testing.T) {
+	for _, p := range []*Producer{
+		New(WithReplaySeek(time.Minute), WithReplay(0)),
+		New(WithReplay(0), WithReplaySeek(time.Minute)),
+	} {
+		if time.Minute != p.replay.seek || 0 != p.replay.speed || !p.replay.active() {
+			t.Errorf("Expected to seek a minute without pacing, got %+v", p.replay)
+		}
+	}
+}
@@ -3,12 +3,23 @@ package producer
 import (
 	"bufio"
 	"plane.watch/lib/tracker/sbs1"
+	"time"
 )
 
 func (p *Producer) sbsScanner(scan *bufio.Scanner) error {
 	for scan.Scan() {
+		if p.isStopping() {
+			return nil
+		}
 		line := scan.Text()
-		p.addFrame(sbs1.NewFrame(scan.Text()), &p.FrameSource)
+		if nil != p.pacer {
+			if ts, err := sbs1.ParseTimeStamp(line); nil == err {
+				if !p.pace(time.Duration(ts.UnixNano())) {
+					continue
+				}
+			}
+		}
+		p.addFrame(sbs1.NewFrame(line), &p.FrameSource)
 		p.addDebug("SBS Frame: %s", line)
 		if nil != p.stats.sbs1 {
 			p.stats.sbs1.Inc()
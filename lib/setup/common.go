@@ -1,6 +1,12 @@
 package setup
 
-import "net/url"
+import (
+	"github.com/rs/zerolog/log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
 
 func getTag(parsedUrl *url.URL, defaultTag string) string {
 	if nil == parsedUrl {
@@ -11,3 +17,41 @@ func getTag(parsedUrl *url.URL, defaultTag string) string {
 	}
 	return defaultTag
 }
+
+func getDuration(parsedUrl *url.URL, what string, defaultDuration time.Duration) time.Duration {
+	if nil == parsedUrl {
+		return defaultDuration
+	}
+	if parsedUrl.Query().Has(what) {
+		d, err := time.ParseDuration(parsedUrl.Query().Get(what))
+		if nil == err {
+			return d
+		}
+		log.Error().Err(err).Str("query_param", what).Msg("Could not determine duration value")
+	}
+	return defaultDuration
+}
+
+func getBool(parsedUrl *url.URL, what string, defaultBool bool) bool {
+	if nil == parsedUrl || !parsedUrl.Query().Has(what) {
+		return defaultBool
+	}
+	switch strings.ToLower(parsedUrl.Query().Get(what)) {
+	case "", "no", "false", "0":
+		return false
+	default:
+		return true
+	}
+}
+
+func getFloat(parsedUrl *url.URL, what string, defaultFloat float64) float64 {
+	if nil == parsedUrl || !parsedUrl.Query().Has(what) {
+		return defaultFloat
+	}
+	f, err := strconv.ParseFloat(parsedUrl.Query().Get(what), 64)
+	if nil != err {
+		log.Error().Err(err).Str("query_param", what).Msg("Could not determine value")
+		return defaultFloat
+	}
+	return f
+}
@@ -15,6 +15,14 @@ import (
 	"time"
 )
 
+type (
+	// QueuedSink is a Sink along with how the tracker should queue events for it
+	QueuedSink struct {
+		tracker.Sink
+		Options []tracker.SinkOption
+	}
+)
+
 var (
 	prometheusOutputFrame = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "pw_ingest_output_frame_total",
@@ -54,15 +62,27 @@ func IncludeSinkFlags(app *cli.App) {
 			Usage:   "Instead of emitting an update for every update we get, collect updates and send a deduplicated list (based on icao) every period",
 			EnvVars: []string{"SINK_COLLECT_DELAY"},
 		},
+		&cli.IntFlag{
+			Name:    "sink-queue-size",
+			Value:   10000,
+			Usage:   "How many events can be waiting for each sink. Override per sink with ?queue-size=",
+			EnvVars: []string{"SINK_QUEUE_SIZE"},
+		},
+		&cli.StringFlag{
+			Name:    "sink-queue-overflow",
+			Value:   "drop-oldest",
+			Usage:   "What to do with events when a sink falls behind. block, drop-oldest or drop-newest. Override per sink with ?queue-overflow=",
+			EnvVars: []string{"SINK_QUEUE_OVERFLOW"},
+		},
 	}...)
 }
 
-func HandleSinkFlags(c *cli.Context, connName string) ([]tracker.Sink, error) {
+func HandleSinkFlags(c *cli.Context, connName string) ([]QueuedSink, error) {
 	defaultTTl := c.Int("sink-message-ttl")
 	defaultDelay := c.Duration("sink-collect-delay")
 	defaultTag := c.String("tag")
 	defaultQueues := c.StringSlice("publish-types")
-	sinks := make([]tracker.Sink, 0)
+	sinks := make([]QueuedSink, 0)
 	testQueues := c.Bool("rabbitmq-test-queues")
 
 	for _, sinkUrl := range c.StringSlice("sink") {
@@ -71,13 +91,51 @@ func HandleSinkFlags(c *cli.Context, connName string) ([]tracker.Sink, error) {
 		if nil != err {
 			log.Error().Err(err).Str("url", sinkUrl).Str("what", "sink").Msg("Failed setup sink")
 			return nil, err
-		} else {
-			sinks = append(sinks, s)
 		}
+		opts, err := sinkQueueOptions(sinkUrl, c.Int("sink-queue-size"), c.String("sink-queue-overflow"))
+		if nil != err {
+			log.Error().Err(err).Str("url", sinkUrl).Str("what", "sink").Msg("Failed setup sink queue")
+			return nil, err
+		}
+		sinks = append(sinks, QueuedSink{Sink: s, Options: opts})
 	}
 	return sinks, nil
 }
 
+// sinkQueueOptions reads how the tracker should queue events for our sink.
+// ?queue-size=1000&queue-overflow=drop-oldest&skip-events=frame-event (or events=plane-location-event)
+func sinkQueueOptions(urlSink string, defaultSize int, defaultOverflow string) ([]tracker.SinkOption, error) {
+	parsedUrl, err := url.Parse(urlSink)
+	if nil != err {
+		return nil, err
+	}
+	query := parsedUrl.Query()
+	size := defaultSize
+	if query.Has("queue-size") {
+		size, err = strconv.Atoi(query.Get("queue-size"))
+		if nil != err {
+			return nil, fmt.Errorf("invalid queue-size {%s}: %s", query.Get("queue-size"), err)
+		}
+	}
+	overflow := defaultOverflow
+	if query.Has("queue-overflow") {
+		overflow = query.Get("queue-overflow")
+	}
+	policy, err := tracker.ParseOverflowPolicy(overflow)
+	if nil != err {
+		return nil, err
+	}
+
+	opts := []tracker.SinkOption{tracker.WithSinkQueue(size, policy)}
+	if query.Has("events") {
+		opts = append(opts, tracker.WithSinkEventTypes(strings.Split(query.Get("events"), ",")...))
+	}
+	if query.Has("skip-events") {
+		opts = append(opts, tracker.WithoutSinkEventTypes(strings.Split(query.Get("skip-events"), ",")...))
+	}
+	return opts, nil
+}
+
 func handleSink(connName, urlSink, defaultTag string, defaultTtl int, defaultQueues []string, rabbitmqTestQueues bool, sendDelay time.Duration) (tracker.Sink, error) {
 	parsedUrl, err := url.Parse(urlSink)
 	if nil != err {
@@ -11,8 +11,11 @@ import (
 	"plane.watch/lib/tracker"
 	"strconv"
 	"strings"
+	"time"
 )
 
+const defaultIdleTimeout = 60 * time.Second
+
 var (
 	prometheusInputBeastFrames = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "pw_ingest_input_beast_total",
@@ -26,23 +29,36 @@ var (
 		Name: "pw_ingest_input_sbs1_total",
 		Help: "The total number of SBS1 frames processed.",
 	})
+	prometheusInputFramesPerSecond = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pw_ingest_input_frames_per_second",
+		Help: "How many frames a second each source is sending us.",
+	}, []string{"source"})
+	prometheusInputLastFrame = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pw_ingest_input_last_frame_timestamp_seconds",
+		Help: "When (unix time) each source last sent us a frame.",
+	}, []string{"source"})
 )
 
 func IncludeSourceFlags(app *cli.App) {
 	sourceFlags := []cli.Flag{
 		&cli.StringSliceFlag{
 			Name:    "fetch",
-			Usage:   "The Source in URL Form. [avr|beast|sbs1]://host:port?tag=MYTAG&refLat=-31.0&refLon=115.0",
+			Usage:   "The Source in URL Form. [avr|beast|sbs1]://host:port?tag=MYTAG&refLat=-31.0&refLon=115.0&maxRange=400&idleTimeout=30s&backoff=1s&maxBackoff=1m",
 			EnvVars: []string{"SOURCE"},
 		},
 		&cli.StringSliceFlag{
 			Name:    "listen",
-			Usage:   "The Source in URL Form. [avr|beast|sbs1]://host:port?tag=MYTAG&refLat=-31.0&refLon=115.0",
+			Usage:   "The Source in URL Form. [avr|beast|sbs1]://host:port?tag=MYTAG&refLat=-31.0&refLon=115.0&maxRange=400",
 			EnvVars: []string{"LISTEN"},
 		},
+		&cli.StringSliceFlag{
+			Name:    "merge",
+			Usage:   "Recordings merged by timestamp into a single source. A file, directory, glob or tar archive in URL Form. [avr|beast|sbs1|file]:///path/to/dir?tag=MYTAG&refLat=-31.0&refLon=115.0&maxRange=400&start=2021-03-27T00:00:00Z&speed=1.0&seek=10m&loop=no",
+			EnvVars: []string{"MERGE"},
+		},
 		&cli.StringSliceFlag{
 			Name:    "file",
-			Usage:   "The Source in URL Form. [avr|beast|sbs1]:///path/to/file?tag=MYTAG&refLat=-31.0&refLon=115.0&delay=no",
+			Usage:   "The Source in URL Form. [avr|beast|sbs1|file]:///path/to/file?tag=MYTAG&refLat=-31.0&refLon=115.0&maxRange=400&delay=no&speed=1.0&seek=10m&loop=no or stdin://?type=avr or pipe:///path/to/fifo",
 			EnvVars: []string{"FILE"},
 		},
 
@@ -105,6 +121,16 @@ func HandleSourceFlags(c *cli.Context) ([]tracker.Producer, error) {
 		}
 	}
 
+	if mergeUrls := c.StringSlice("merge"); len(mergeUrls) > 0 {
+		log.Debug().Strs("merge-urls", mergeUrls).Msg("With Merge")
+		p, err := handleMergeSources(mergeUrls, defaultTag, refLat, refLon)
+		if nil != err {
+			log.Error().Err(err).Strs("urls", mergeUrls).Msgf("Failed to understand URL: %s", err)
+			return nil, err
+		}
+		out = append(out, p)
+	}
+
 	return out, nil
 }
 
@@ -122,13 +148,27 @@ func getRef(parsedUrl *url.URL, what string, defaultRef float64) float64 {
 	return defaultRef
 }
 
+// getFormat works out the type of frames we are expecting from the type= query param, defaulting to detecting it
+func getFormat(parsedUrl *url.URL) int {
+	switch strings.ToLower(parsedUrl.Query().Get("type")) {
+	case "avr":
+		return producer.Avr
+	case "beast":
+		return producer.Beast
+	case "sbs1":
+		return producer.Sbs1
+	default:
+		return producer.Auto
+	}
+}
+
 func handleSource(urlSource, defaultTag string, defaultRefLat, defaultRefLon float64, listen bool) (tracker.Producer, error) {
 	parsedUrl, err := url.Parse(urlSource)
 	if nil != err {
 		return nil, err
 	}
 
-	producerOpts := make([]producer.Option, 3)
+	producerOpts := make([]producer.Option, 4)
 	producerOpts[0] = producer.WithSourceTag(getTag(parsedUrl, defaultTag))
 
 	switch strings.ToLower(parsedUrl.Scheme) {
@@ -142,17 +182,26 @@ func handleSource(urlSource, defaultTag string, defaultRefLat, defaultRefLon flo
 		return nil, fmt.Errorf("unknown scheme: %s, expected one of [avr|beast|sbs1]", parsedUrl.Scheme)
 	}
 	producerOpts[2] = producer.WithPrometheusCounters(prometheusInputAvrFrames, prometheusInputBeastFrames, prometheusInputSbs1Frames)
+	producerOpts[3] = producer.WithFeedMetrics(prometheusInputFramesPerSecond, prometheusInputLastFrame)
 
 	refLat := getRef(parsedUrl, "refLat", defaultRefLat)
 	refLon := getRef(parsedUrl, "refLon", defaultRefLon)
 	if refLat != 0 && refLon != 0 {
 		producerOpts = append(producerOpts, producer.WithReferenceLatLon(refLat, refLon))
 	}
+	// maxRange is in km, positions further away than this from our receiver are rejected
+	if maxRange := getFloat(parsedUrl, "maxRange", 0); maxRange > 0 {
+		producerOpts = append(producerOpts, producer.WithMaxRange(maxRange*1000))
+	}
 
 	if listen {
 		producerOpts = append(producerOpts, producer.WithListener(parsedUrl.Hostname(), parsedUrl.Port()))
 	} else {
-		producerOpts = append(producerOpts, producer.WithFetcher(parsedUrl.Hostname(), parsedUrl.Port()))
+		producerOpts = append(producerOpts,
+			producer.WithFetcher(parsedUrl.Hostname(), parsedUrl.Port()),
+			producer.WithFetcherIdleTimeout(getDuration(parsedUrl, "idleTimeout", defaultIdleTimeout)),
+			producer.WithFetcherBackoff(getDuration(parsedUrl, "backoff", 0), getDuration(parsedUrl, "maxBackoff", 0)),
+		)
 	}
 
 	return producer.New(producerOpts...), nil
@@ -164,36 +213,111 @@ func handleFileSource(urlFile, defaultTag string, defaultRefLat, defaultRefLon f
 		return nil, err
 	}
 	producerOpts := make([]producer.Option, 1)
+	// stdin://, pipe:// and file:// work out the type of frames from the input, unless told otherwise with type=
+	source := producer.WithFiles([]string{parsedUrl.Path})
 	switch strings.ToLower(parsedUrl.Scheme) {
 	case "avr":
 		producerOpts[0] = producer.WithType(producer.Avr)
 	case "beast":
 		producerOpts[0] = producer.WithType(producer.Beast)
-		delay := false
-		if parsedUrl.Query().Has("delay") {
-			switch strings.ToLower(parsedUrl.Query().Get("delay")) {
-			case "", "no", "false", "0":
-				delay = false
-			default:
-				delay = true
-			}
-		}
-		producerOpts = append(producerOpts, producer.WithBeastDelay(delay))
 	case "sbs1":
 		producerOpts[0] = producer.WithType(producer.Sbs1)
+	case "file":
+		producerOpts[0] = producer.WithType(getFormat(parsedUrl))
+	case "stdin":
+		producerOpts[0] = producer.WithType(getFormat(parsedUrl))
+		source = producer.WithStdin(getFormat(parsedUrl))
+	case "pipe":
+		producerOpts[0] = producer.WithType(getFormat(parsedUrl))
+		source = producer.WithNamedPipe(parsedUrl.Path, getFormat(parsedUrl))
 	default:
 		return nil, fmt.Errorf("unknown file Type: %s", parsedUrl.Scheme)
 	}
+
+	// delay=yes replays the file in real time, speed=N replays it N times faster
+	speed := 0.0
+	if getBool(parsedUrl, "delay", false) {
+		speed = 1
+	}
+	speed = getFloat(parsedUrl, "speed", speed)
+	producerOpts = append(producerOpts,
+		producer.WithReplay(speed),
+		producer.WithReplaySeek(getDuration(parsedUrl, "seek", 0)),
+		producer.WithReplayLoop(getBool(parsedUrl, "loop", false)),
+	)
+
 	refLat := getRef(parsedUrl, "refLat", defaultRefLat)
 	refLon := getRef(parsedUrl, "refLon", defaultRefLon)
 	if refLat != 0 && refLon != 0 {
 		producerOpts = append(producerOpts, producer.WithReferenceLatLon(refLat, refLon))
 	}
+	// maxRange is in km, positions further away than this from our receiver are rejected
+	if maxRange := getFloat(parsedUrl, "maxRange", 0); maxRange > 0 {
+		producerOpts = append(producerOpts, producer.WithMaxRange(maxRange*1000))
+	}
 
 	producerOpts = append(
 		producerOpts,
 		producer.WithSourceTag(getTag(parsedUrl, defaultTag)),
-		producer.WithFiles([]string{parsedUrl.Path}),
+		source,
+	)
+
+	return producer.New(producerOpts...), nil
+}
+
+// handleMergeSources creates a single producer for all of our merge sources. The replay options come from the first url
+func handleMergeSources(mergeUrls []string, defaultTag string, defaultRefLat, defaultRefLon float64) (tracker.Producer, error) {
+	sources := make([]producer.MergeSource, 0, len(mergeUrls))
+	producerOpts := make([]producer.Option, 0)
+	for i, mergeUrl := range mergeUrls {
+		parsedUrl, err := url.Parse(mergeUrl)
+		if nil != err {
+			return nil, err
+		}
+		source := producer.MergeSource{
+			Path: parsedUrl.Path,
+			Tag:  getTag(parsedUrl, defaultTag),
+		}
+		switch strings.ToLower(parsedUrl.Scheme) {
+		case "avr":
+			source.Format = producer.Avr
+		case "beast":
+			source.Format = producer.Beast
+		case "sbs1":
+			source.Format = producer.Sbs1
+		case "file":
+			source.Format = getFormat(parsedUrl)
+		default:
+			return nil, fmt.Errorf("unknown file Type: %s", parsedUrl.Scheme)
+		}
+
+		refLat := getRef(parsedUrl, "refLat", defaultRefLat)
+		refLon := getRef(parsedUrl, "refLon", defaultRefLon)
+		if refLat != 0 && refLon != 0 {
+			source.RefLat = &refLat
+			source.RefLon = &refLon
+		}
+		source.MaxRange = getFloat(parsedUrl, "maxRange", 0) * 1000
+		if parsedUrl.Query().Has("start") {
+			source.Start, err = time.Parse(time.RFC3339, parsedUrl.Query().Get("start"))
+			if nil != err {
+				return nil, fmt.Errorf("invalid start time for %s: %s", mergeUrl, err)
+			}
+		}
+		sources = append(sources, source)
+
+		if 0 == i {
+			producerOpts = append(producerOpts,
+				producer.WithReplay(getFloat(parsedUrl, "speed", 0)),
+				producer.WithReplaySeek(getDuration(parsedUrl, "seek", 0)),
+				producer.WithReplayLoop(getBool(parsedUrl, "loop", false)),
+				producer.WithSourceTag(getTag(parsedUrl, defaultTag)),
+			)
+		}
+	}
+	producerOpts = append(producerOpts,
+		producer.WithType(producer.Auto),
+		producer.WithMergedFiles(sources),
 	)
 
 	return producer.New(producerOpts...), nil
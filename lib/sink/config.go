@@ -5,6 +5,7 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"os"
+	"plane.watch/lib/tracker"
 	"sync"
 	"time"
 )
@@ -17,6 +18,15 @@ const (
 	QueueTypeSbs1All     = "sbs1-all"
 	QueueTypeSbs1Reduce  = "sbs1-reduce"
 	QueueLocationUpdates = "location-updates"
+
+	// lifecycle events, things that happen to planes
+	QueueTakeoff         = "takeoff"
+	QueueLanding         = "landing"
+	QueueSquawkChanged   = "squawk-changed"
+	QueueEmergency       = "emergency"
+	QueueCallsignChanged = "callsign-changed"
+	QueueSignal          = "signal"
+	QueueAnomaly         = "anomaly"
 )
 
 var AllQueues = [...]string{
@@ -27,6 +37,26 @@ var AllQueues = [...]string{
 	QueueTypeSbs1All,
 	QueueTypeSbs1Reduce,
 	QueueLocationUpdates,
+	QueueTakeoff,
+	QueueLanding,
+	QueueSquawkChanged,
+	QueueEmergency,
+	QueueCallsignChanged,
+	QueueSignal,
+	QueueAnomaly,
+}
+
+// lifecycleQueues is where each type of lifecycle event is sent
+var lifecycleQueues = map[string]string{
+	tracker.TakeoffEventType:           QueueTakeoff,
+	tracker.LandingEventType:           QueueLanding,
+	tracker.SquawkChangedEventType:     QueueSquawkChanged,
+	tracker.EmergencyDeclaredEventType: QueueEmergency,
+	tracker.EmergencyClearedEventType:  QueueEmergency,
+	tracker.CallsignChangedEventType:   QueueCallsignChanged,
+	tracker.SignalLostEventType:        QueueSignal,
+	tracker.SignalRegainedEventType:    QueueSignal,
+	tracker.AnomalyDetectedEventType:   QueueAnomaly,
 }
 
 type (
@@ -161,5 +191,8 @@ func WithAllQueues() Option {
 		conf.queue[QueueTypeSbs1All] = QueueTypeSbs1All
 		conf.queue[QueueTypeSbs1Reduce] = QueueTypeSbs1Reduce
 		conf.queue[QueueLocationUpdates] = QueueLocationUpdates
+		for _, queue := range lifecycleQueues {
+			conf.queue[queue] = queue
+		}
 	}
 }
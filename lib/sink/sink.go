@@ -102,6 +102,23 @@ func (s *Sink) trackerMsgJson(le *tracker.PlaneLocationEvent) ([]byte, error) {
 	return eventStruct.ToJsonBytes()
 }
 
+// sendLifecycleEvent sends our event to its own queue, if we are publishing it
+func (s *Sink) sendLifecycleEvent(e tracker.LifecycleEvent) error {
+	queue, ok := lifecycleQueues[e.Type()]
+	if !ok {
+		return nil
+	}
+	if _, ok = s.config.queue[queue]; !ok {
+		return nil
+	}
+	le := export.NewLifecycleEvent(e, s.config.sourceTag)
+	jsonBuf, err := le.ToJsonBytes()
+	if nil != err {
+		return err
+	}
+	return s.dest.PublishJson(queue, jsonBuf)
+}
+
 func (s *Sink) sendFrameEvent(queueAvr, queueBeast, queueSbs1 string) func(tracker.Frame, *tracker.FrameSource) error {
 	return func(ourFrame tracker.Frame, source *tracker.FrameSource) error {
 		var err error
@@ -189,6 +206,9 @@ func (s *Sink) OnEvent(e tracker.Event) {
 		if nil != s.config.stats.frame {
 			s.config.stats.frame.Inc()
 		}
+
+	case tracker.LifecycleEvent:
+		err = s.sendLifecycleEvent(e.(tracker.LifecycleEvent))
 	}
 
 	if nil != err {
@@ -0,0 +1,209 @@
+package tracker
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	AnomalyDetectedEventType = "anomaly-detected-event"
+
+	// AnomalyDuplicateIcao is two aircraft (or a spoofer) using the same ICAO, giving us two tracks that take turns
+	AnomalyDuplicateIcao = "duplicate-icao"
+	// AnomalyOutOfRange is positions further from the receiver than it can hear
+	AnomalyOutOfRange = "out-of-range"
+	// AnomalySignalLevel is a signal too strong for how far the position says the aircraft is from the receiver
+	AnomalySignalLevel = "signal-level"
+	// AnomalyDistantReceivers is the same message heard by receivers too far apart to hear the same aircraft
+	AnomalyDistantReceivers = "distant-receivers"
+
+	// anomalyWindow is how long we remember an anomaly for, a plane stays flagged until it has gone this long without one
+	anomalyWindow = 5 * time.Minute
+	// anomalyThreshold is how many times we need to see an anomaly within our window before we flag the plane
+	anomalyThreshold = 3
+	// anomalyDuplicateWindow is how far apart two receivers can hear the same message and still be hearing the same transmission
+	anomalyDuplicateWindow = time.Second
+	// anomalyStrongSignal (dBFS) and anomalyStrongSignalRange (metres) are a signal we do not expect from that far away
+	anomalyStrongSignal      = -6.0
+	anomalyStrongSignalRange = 150_000.0
+)
+
+type (
+	// anomalies remembers the messages our receivers have recently heard, so we can tell when distant ones hear the same
+	anomalies struct {
+		lock   sync.Mutex
+		recent map[string]heardMessage
+		swept  time.Time
+	}
+
+	heardMessage struct {
+		source   string
+		lat, lon float64
+		metres   float64
+		at       time.Time
+	}
+
+	// anomaly is how often we have seen a type of anomaly for a plane
+	anomaly struct {
+		count   int
+		last    time.Time
+		flagged bool
+	}
+
+	// AnomalyEvent is sent when we decide a plane is not what it seems, e.g. its ICAO is being used by more than one aircraft
+	AnomalyEvent struct {
+		lifecycleEvent
+		anomaly, detail string
+	}
+)
+
+// WithAnomalyDetection flags planes that look like more than one aircraft sharing an ICAO, or a spoofer. Flagged
+// planes have their Anomalies set and we send an AnomalyDetectedEventType event for them
+func WithAnomalyDetection() Option {
+	return func(t *Tracker) {
+		t.anomalies = &anomalies{recent: map[string]heardMessage{}}
+	}
+}
+
+// heard remembers a message a source heard, and tells us about another source that heard the same message when the
+// two of them are too far apart to have heard the same aircraft
+func (a *anomalies) heard(key string, hm heardMessage) (heardMessage, bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if hm.at.Sub(a.swept) > anomalyDuplicateWindow {
+		for k, old := range a.recent {
+			if hm.at.Sub(old.at) > anomalyDuplicateWindow {
+				delete(a.recent, k)
+			}
+		}
+		a.swept = hm.at
+	}
+	prev, ok := a.recent[key]
+	if !ok || hm.at.Sub(prev.at) > anomalyDuplicateWindow {
+		a.recent[key] = hm
+		return heardMessage{}, false
+	}
+	if prev.source == hm.source || math.Abs(float64(hm.at.Sub(prev.at))) > float64(anomalyDuplicateWindow) {
+		return heardMessage{}, false
+	}
+	return prev, distance(prev.lat, prev.lon, hm.lat, hm.lon) > prev.metres+hm.metres
+}
+
+// hearingRange is how far (in metres) we think the source can hear
+func (t *Tracker) hearingRange(source *FrameSource) float64 {
+	if metres, ok := t.knownRange(source); ok {
+		return metres
+	}
+	return maxReceiverRange
+}
+
+// knownRange is how far (in metres) the source can hear, as it told us or as we learned it. False if we do not know
+func (t *Tracker) knownRange(source *FrameSource) (float64, bool) {
+	if source.MaxRange > 0 {
+		return source.MaxRange, true
+	}
+	if nil != t.ranges {
+		return t.ranges.learned(source.Id())
+	}
+	return 0, false
+}
+
+// checkDistantReceivers looks for the same message heard by receivers that are too far apart to hear the same
+// aircraft. It needs to see our frames before our middlewares remove the duplicates
+func (t *Tracker) checkDistantReceivers(f *FrameEvent) {
+	if nil == t.anomalies || nil == f || nil == f.Source() {
+		return
+	}
+	m := modeSFrame(f.Frame())
+	if nil == m || 0 == m.Icao() {
+		return
+	}
+	refLat, refLon, _ := t.reference(f.Source())
+	if nil == refLat || nil == refLon {
+		return
+	}
+	hm := heardMessage{source: f.Source().Id(), lat: *refLat, lon: *refLon, metres: t.hearingRange(f.Source()), at: m.TimeStamp()}
+	if other, distant := t.anomalies.heard(string(m.Raw()), hm); distant {
+		plane := t.GetPlane(m.Icao())
+		plane.rwLock.Lock()
+		plane.noteAnomaly(AnomalyDistantReceivers, fmt.Sprintf("heard by %s and %s, %0.0fkm apart", other.source, hm.source, distance(other.lat, other.lon, hm.lat, hm.lon)/1000), hm.at)
+		plane.rwLock.Unlock()
+		plane.sendEvents()
+	}
+}
+
+// checkSignalLevel flags a position that came with a signal too strong for how far it is from the receiver
+func (t *Tracker) checkSignalLevel(refLat, refLon *float64, frame Frame, plane *Plane, positionBefore time.Time) {
+	if nil == t.anomalies || nil == refLat || nil == refLon || nil == plane {
+		return
+	}
+	if !plane.HasLocation() || plane.IsMlatLocation() || !plane.LocationUpdatedAt().After(positionBefore) {
+		return
+	}
+	rssi := frameRssi(frame)
+	if math.IsNaN(rssi) || rssi < anomalyStrongSignal {
+		return
+	}
+	if d := distance(*refLat, *refLon, plane.Lat(), plane.Lon()); d > anomalyStrongSignalRange {
+		plane.rwLock.Lock()
+		plane.noteAnomaly(AnomalySignalLevel, fmt.Sprintf("%0.1f dBFS from %0.0fkm away", rssi, d/1000), plane.location.cprDecodedTs)
+		plane.rwLock.Unlock()
+		plane.sendEvents()
+	}
+}
+
+// noteAnomaly counts an anomaly for our plane, and flags it once we have seen enough of them. Must be called with our lock held
+func (p *Plane) noteAnomaly(kind, detail string, ts time.Time) {
+	if nil == p.tracker || nil == p.tracker.anomalies {
+		return
+	}
+	if nil == p.anomalies {
+		p.anomalies = map[string]*anomaly{}
+	}
+	a, ok := p.anomalies[kind]
+	if !ok || ts.Sub(a.last) > anomalyWindow {
+		a = &anomaly{}
+		p.anomalies[kind] = a
+	}
+	a.count++
+	a.last = ts
+	if a.count >= anomalyThreshold && !a.flagged {
+		a.flagged = true
+		p.tracker.log.Warn().Str("ICAO", p.icao).Str("Anomaly", kind).Str("Detail", detail).Msg("Plane flagged")
+		p.queueEvent(&AnomalyEvent{lifecycleEvent: lifecycleEvent{p: p, at: ts}, anomaly: kind, detail: detail})
+	}
+}
+
+// Anomalies are the things that make us think this plane is not what it seems, empty if we have no reason to doubt it
+func (p *Plane) Anomalies() []string {
+	p.rwLock.RLock()
+	defer p.rwLock.RUnlock()
+	var out []string
+	for kind, a := range p.anomalies {
+		if a.flagged && p.lastSeen.Sub(a.last) <= anomalyWindow {
+			out = append(out, kind)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (e *AnomalyEvent) Type() string {
+	return AnomalyDetectedEventType
+}
+func (e *AnomalyEvent) String() string {
+	return fmt.Sprintf("%s flagged as %s: %s", e.p.IcaoIdentifierStr(), e.anomaly, e.detail)
+}
+
+// Anomaly is what we think is wrong with the plane, one of the Anomaly* constants
+func (e *AnomalyEvent) Anomaly() string {
+	return e.anomaly
+}
+
+// Detail describes what we saw
+func (e *AnomalyEvent) Detail() string {
+	return e.detail
+}
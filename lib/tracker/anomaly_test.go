@@ -0,0 +1,150 @@
+package tracker
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"plane.watch/lib/tracker/mode_s"
+)
+
+func TestPlane_DuplicateIcao(t *testing.T) {
+	trk, catcher := newEventTracker(t, []string{AnomalyDetectedEventType}, WithAnomalyDetection())
+	p := trk.GetPlane(0x7C0008)
+	now := time.Now()
+
+	// two aircraft 100km apart, taking turns with our ICAO
+	for i := 0; i < 9; i++ {
+		lat := -31.95
+		if i%2 == 1 {
+			lat = -31.05
+		}
+		_ = p.addLatLong(lat, 115.86, now.Add(time.Duration(i)*time.Second))
+		if i < 8 && 0 != len(p.Anomalies()) {
+			t.Fatalf("expected our plane to not be flagged after %d positions, got %v", i+1, p.Anomalies())
+		}
+	}
+	expectEvents(t, "duplicate ICAO", eventTypes(t, p, catcher), AnomalyDetectedEventType)
+	if anomalies := p.Anomalies(); 1 != len(anomalies) || AnomalyDuplicateIcao != anomalies[0] {
+		t.Errorf("expected our plane to be flagged as a duplicate ICAO, got %v", anomalies)
+	}
+
+	// a single aircraft that changes direction is not two aircraft
+	single := trk.GetPlane(0x7C0009)
+	lat, lon := -31.95, 115.86
+	for i := 0; i < 20; i++ {
+		north := 200.0
+		if i >= 10 {
+			north = -200
+		}
+		lat, lon = offsetMetres(lat, lon, north, 100)
+		_ = single.addLatLong(lat, lon, now.Add(time.Duration(i)*time.Second))
+	}
+	if 0 != len(single.Anomalies()) {
+		t.Errorf("expected a single aircraft to not be flagged, got %v", single.Anomalies())
+	}
+}
+
+func TestTracker_DistantReceivers(t *testing.T) {
+	trk, catcher := newEventTracker(t, []string{AnomalyDetectedEventType}, WithAnomalyDetection())
+	perthLat, perthLon := -31.95, 115.86
+	sydneyLat, sydneyLon := -33.87, 151.21
+	perth := &FrameSource{Name: "perth", RefLat: &perthLat, RefLon: &perthLon}
+	sydney := &FrameSource{Name: "sydney", RefLat: &sydneyLat, RefLon: &sydneyLon}
+	nearbyLat := -32.1
+	nearby := &FrameSource{Name: "nearby", RefLat: &nearbyLat, RefLon: &perthLon}
+
+	now := time.Now()
+	for i := 0; i < anomalyThreshold; i++ {
+		at := now.Add(time.Duration(i) * 5 * time.Second)
+		frame, err := mode_s.DecodeString("8D40621D58C382D690C8AC2863A7", at)
+		if nil != err {
+			t.Fatal(err)
+		}
+		trk.checkDistantReceivers(NewFrameEvent(frame, perth))
+		// a receiver down the road hearing it is what we expect
+		trk.checkDistantReceivers(NewFrameEvent(frame, nearby))
+		if 0 != len(trk.GetPlane(frame.Icao()).Anomalies()) {
+			t.Fatalf("expected nearby receivers to not flag our plane")
+		}
+
+		copied, _ := mode_s.DecodeString("8D40621D58C382D690C8AC2863A7", at.Add(10*time.Millisecond))
+		trk.checkDistantReceivers(NewFrameEvent(copied, sydney))
+	}
+
+	p := trk.GetPlane(0x40621D)
+	expectEvents(t, "distant receivers", eventTypes(t, p, catcher), AnomalyDetectedEventType)
+	if anomalies := p.Anomalies(); 1 != len(anomalies) || AnomalyDistantReceivers != anomalies[0] {
+		t.Errorf("expected our plane to be flagged as heard by distant receivers, got %v", anomalies)
+	}
+}
+
+func TestTracker_CheckSignalLevel(t *testing.T) {
+	trk, catcher := newEventTracker(t, []string{AnomalyDetectedEventType}, WithAnomalyDetection())
+	// our plane is ~200km north of our receiver
+	refLat, refLon := 50.457, 3.918
+	now := time.Now()
+
+	weak, err := mode_s.DecodeString("<016CE3671AA8208D40621D58C382D690C8AC2863A7;", now)
+	if nil != err {
+		t.Fatal(err)
+	}
+	strong, err := mode_s.DecodeString("<016CE3671AA8F08D40621D58C382D690C8AC2863A7;", now)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if rssi := frameRssi(strong); math.Abs(rssi-20*math.Log10(240.0/255)) > 1e-9 {
+		t.Fatalf("expected our strong frame to be %0.2f dBFS, got %0.2f", 20*math.Log10(240.0/255), rssi)
+	}
+	if rssi := frameRssi(weak); rssi > -15 {
+		t.Fatalf("expected our weak frame to be below -15 dBFS, got %0.2f", rssi)
+	}
+
+	p := trk.GetPlane(strong.Icao())
+	for i := 0; i < anomalyThreshold; i++ {
+		at := now.Add(time.Duration(i) * time.Second)
+		before := p.LocationUpdatedAt()
+		_ = p.addLatLong(52.2572, 3.9194, at)
+		trk.checkSignalLevel(&refLat, &refLon, weak, p, before)
+	}
+	if 0 != len(p.Anomalies()) {
+		t.Fatalf("expected a weak signal from 200km away to not flag our plane, got %v", p.Anomalies())
+	}
+
+	for i := 0; i < anomalyThreshold; i++ {
+		at := now.Add(time.Duration(anomalyThreshold+i) * time.Second)
+		before := p.LocationUpdatedAt()
+		_ = p.addLatLong(52.2572, 3.9194, at)
+		trk.checkSignalLevel(&refLat, &refLon, strong, p, before)
+	}
+	expectEvents(t, "strong signal", eventTypes(t, p, catcher), AnomalyDetectedEventType)
+	if anomalies := p.Anomalies(); 1 != len(anomalies) || AnomalySignalLevel != anomalies[0] {
+		t.Errorf("expected our plane to be flagged for its signal level, got %v", anomalies)
+	}
+}
+
+func TestPlane_OutOfRangeFlaggedNotRejected(t *testing.T) {
+	trk, catcher := newEventTracker(t, []string{AnomalyDetectedEventType}, WithAnomalyDetection())
+	refLat, refLon := -31.95, 115.86
+	source := &FrameSource{Name: "perth", RefLat: &refLat, RefLon: &refLon}
+	heardBy := trk.receiverRange(source, &refLat, &refLon)
+	if nil == heardBy || heardBy.reject {
+		t.Fatalf("expected anomaly detection to check our range without rejecting, got %+v", heardBy)
+	}
+
+	// somewhere near Sydney, much further than perth can hear
+	now := time.Now()
+	p := trk.GetPlane(0x7C000A)
+	for i := 0; i < anomalyThreshold; i++ {
+		if err := p.addPosition(-33.87, 151.21+float64(i)*0.001, now.Add(time.Duration(i)*time.Second), false, heardBy); nil != err {
+			t.Fatalf("expected a position out of range to be kept, got %s", err)
+		}
+	}
+	if !p.HasLocation() {
+		t.Fatalf("expected our plane to have a location")
+	}
+	expectEvents(t, "out of range", eventTypes(t, p, catcher), AnomalyDetectedEventType)
+	if anomalies := p.Anomalies(); 1 != len(anomalies) || AnomalyOutOfRange != anomalies[0] {
+		t.Errorf("expected our plane to be flagged as out of range, got %v", anomalies)
+	}
+}
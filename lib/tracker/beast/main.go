@@ -69,6 +69,17 @@ func (f *Frame) Decode() error {
 	}
 }
 
+// Address works out which aircraft our frame is for, without decoding the rest of it
+func (f *Frame) Address() (uint32, error) {
+	if nil == f {
+		return 0, errors.New("nil frame")
+	}
+	if f.msgType != 0x32 && f.msgType != 0x33 {
+		return 0, mode_s.ErrNoOp
+	}
+	return f.decodedModeS.Address()
+}
+
 func (f *Frame) TimeStamp() time.Time {
 	// todo: calculate this off the mlat timestamp
 	return time.Now()
@@ -139,15 +150,20 @@ func (f *Frame) decodeConfig() {
 	// TODO: Decode RadarCape Config Info
 }
 
-// BeastTicksNs returns the number of nanoseconds the beast has been on for (the mlat timestamp is calculated from power on)
-func (f *Frame) BeastTicksNs() time.Duration {
+// BeastTicks returns the raw 12MHz counter the beast stamped this frame with
+func (f *Frame) BeastTicks() uint64 {
 	var t uint64
 	inc := 40
 	for i := 0; i < 6; i++ {
 		t = t | uint64(f.mlatTimestamp[i])<<inc
 		inc -= 8
 	}
-	return time.Duration(t * 500)
+	return t
+}
+
+// BeastTicksNs returns the number of nanoseconds the beast has been on for (the mlat timestamp is calculated from power on)
+func (f *Frame) BeastTicksNs() time.Duration {
+	return time.Duration(f.BeastTicks() * 500)
 }
 
 func (f *Frame) String() string {
@@ -169,7 +185,8 @@ func (f *Frame) String() string {
 	)
 }
 
-func (f *Frame) isMlat() bool {
+// IsMlat tells us if this frame was synthesised by an MLAT server (it has the MLAT marker instead of a timestamp)
+func (f *Frame) IsMlat() bool {
 	if nil == f {
 		return false
 	}
@@ -0,0 +1,461 @@
+package tracker
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/kpawlik/geojson"
+	"github.com/prometheus/client_golang/prometheus"
+	"plane.watch/lib/tracker/sbs1"
+)
+
+const (
+	// coverageSectors splits the area around a receiver into bearings, 10° each
+	coverageSectors = 36
+	// coverageRangeBucket is how wide (in metres) each bucket of our range distribution is
+	coverageRangeBucket  = 25_000.0
+	coverageRangeBuckets = 20
+	// coverageRssiSamples is how many recent signal levels we work out our percentiles from
+	coverageRssiSamples = 1000
+	// coverageAircraftWindow is how long we count an aircraft as one a source can hear
+	coverageAircraftWindow = time.Hour
+	// coverageRateWindow is how often we work out our message rates
+	coverageRateWindow = time.Minute
+	// coverageSectorSamples is how many recent positions in each sector we work out its range from
+	coverageSectorSamples = 200
+	// coverageSectorWindow is how long a position counts towards its sectors range
+	coverageSectorWindow = 24 * time.Hour
+	// coverageSectorPercentile is how far into a sectors positions its range is, so one bad position does not set it
+	coverageSectorPercentile = 99
+)
+
+type (
+	// CoverageMetrics are the prometheus metrics we keep for each of our sources, any of them can be nil
+	CoverageMetrics struct {
+		// Messages is labelled with source and df
+		Messages *prometheus.CounterVec
+		// Aircraft is labelled with source
+		Aircraft *prometheus.GaugeVec
+		// SectorRange is labelled with source and bearing
+		SectorRange *prometheus.GaugeVec
+		// Range is labelled with source
+		Range *prometheus.HistogramVec
+		// Rssi is labelled with source
+		Rssi *prometheus.SummaryVec
+	}
+
+	// coverage keeps statistics for each of our sources
+	coverage struct {
+		lock    sync.Mutex
+		sources map[string]*sourceCoverage
+		metrics CoverageMetrics
+	}
+
+	sourceCoverage struct {
+		lock           sync.Mutex
+		id             string
+		refLat, refLon *float64
+		refEstimated   bool
+		since          time.Time
+		// latest is the newest frame time we have had, our windows are relative to it so recordings work
+		latest time.Time
+
+		messages   map[string]uint64
+		rateStart  time.Time
+		rateCounts map[string]uint64
+		rates      map[string]float64
+
+		aircraft  map[uint32]time.Time
+		positions uint64
+		sectors   [coverageSectors]sectorSamples
+		ranges    [coverageRangeBuckets + 1]uint64
+
+		rssi     []float64
+		rssiNext int
+	}
+
+	// SourceCoverage is what one of our sources can hear, so that we can find poorly sited or misconfigured feeders
+	SourceCoverage struct {
+		Source         string
+		RefLat, RefLon *float64 `json:",omitempty"`
+		// RefEstimated is set when our source did not tell us where it is, and we worked it out
+		RefEstimated bool
+		Since        time.Time
+		// Messages is how many messages of each downlink format we have had, MessageRates is per second
+		Messages     map[string]uint64
+		MessageRates map[string]float64
+		// Aircraft is how many different aircraft we have heard in the last hour
+		Aircraft  int
+		Positions uint64
+		// MaxRange is in metres
+		MaxRange          float64
+		Sectors           []CoverageSector
+		RangeDistribution []RangeBucket
+		Rssi              *RssiPercentiles `json:",omitempty"`
+	}
+
+	// CoverageSector is the furthest position we have from a source on a bearing, Range is in metres. It is the
+	// 99th percentile of the positions we have had recently, so that it follows changes in what the source can hear
+	CoverageSector struct {
+		Bearing  float64
+		Range    float64
+		Lat, Lon float64
+	}
+
+	// sectorSamples are the recent positions we have had in a sector
+	sectorSamples struct {
+		samples []sectorSample
+		next    int
+	}
+
+	sectorSample struct {
+		rng, lat, lon float64
+		at            time.Time
+	}
+
+	// RangeBucket is how many positions we have from a source between From and To metres away, the last one has no To
+	RangeBucket struct {
+		From, To float64
+		Count    uint64
+	}
+
+	// RssiPercentiles are the signal levels (in dBFS) of a sources recent messages
+	RssiPercentiles struct {
+		P10, P50, P90, P99 float64
+	}
+)
+
+// WithCoverage keeps coverage and range statistics for each of our sources
+func WithCoverage() Option {
+	return func(t *Tracker) {
+		t.coverage = newCoverage(CoverageMetrics{})
+	}
+}
+
+// WithCoverageMetrics keeps coverage and range statistics for each of our sources, and exposes them as metrics
+func WithCoverageMetrics(metrics CoverageMetrics) Option {
+	return func(t *Tracker) {
+		t.coverage = newCoverage(metrics)
+	}
+}
+
+func newCoverage(metrics CoverageMetrics) *coverage {
+	return &coverage{
+		sources: map[string]*sourceCoverage{},
+		metrics: metrics,
+	}
+}
+
+// forSource gets the statistics we keep for a source
+func (c *coverage) forSource(source *FrameSource, now time.Time) *sourceCoverage {
+	id := source.Id()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	sc, ok := c.sources[id]
+	if !ok {
+		sc = &sourceCoverage{
+			id:         id,
+			since:      now,
+			messages:   map[string]uint64{},
+			rateStart:  now,
+			rateCounts: map[string]uint64{},
+			rates:      map[string]float64{},
+			aircraft:   map[uint32]time.Time{},
+			rssi:       make([]float64, 0, coverageRssiSamples),
+		}
+		c.sources[id] = sc
+	}
+	return sc
+}
+
+// record adds a frame we have handled to its sources statistics. refLat/refLon is where the source is, as it told us
+// or as we estimated it. positionBefore is when the planes position was updated before we handled the frame, so we
+// can tell if this frame gave us a new position
+func (c *coverage) record(source *FrameSource, refLat, refLon *float64, frame Frame, plane *Plane, positionBefore time.Time) {
+	if nil == source || nil == frame || nil == plane {
+		return
+	}
+	// we go by when the frame was heard, so that replayed and merged recordings give sensible rates and windows
+	now := frame.TimeStamp()
+	if now.IsZero() {
+		now = time.Now()
+	}
+	sc := c.forSource(source, now)
+
+	df := "unknown"
+	if m := modeSFrame(frame); nil != m {
+		df = fmt.Sprintf("DF%02d", m.DownLinkType())
+	} else if _, ok := frame.(*sbs1.Frame); ok {
+		df = "SBS1"
+	}
+	rssi := frameRssi(frame)
+
+	var lat, lon, rng, bearing float64
+	hasPosition := false
+	if nil != refLat && nil != refLon && plane.HasLocation() && !plane.IsMlatLocation() &&
+		plane.LocationUpdatedAt().After(positionBefore) {
+		lat, lon = plane.Lat(), plane.Lon()
+		rng = distance(*refLat, *refLon, lat, lon)
+		bearing = initialBearing(*refLat, *refLon, lat, lon)
+		hasPosition = true
+	}
+
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	sc.refLat, sc.refLon = refLat, refLon
+	sc.refEstimated = nil == source.RefLat && nil != refLat
+	if now.After(sc.latest) {
+		sc.latest = now
+	}
+	sc.messages[df]++
+	sc.rateCounts[df]++
+	sc.aircraft[plane.IcaoIdentifier()] = now
+	if elapsed := now.Sub(sc.rateStart); elapsed >= coverageRateWindow {
+		sc.rollover(now, elapsed)
+		if nil != c.metrics.Aircraft {
+			c.metrics.Aircraft.WithLabelValues(sc.id).Set(float64(len(sc.aircraft)))
+		}
+		if nil != c.metrics.SectorRange {
+			for _, s := range sc.sectorRanges(now) {
+				c.metrics.SectorRange.WithLabelValues(sc.id, fmt.Sprintf("%03.0f", s.Bearing)).Set(s.Range)
+			}
+		}
+	}
+	if nil != c.metrics.Messages {
+		c.metrics.Messages.WithLabelValues(sc.id, df).Inc()
+	}
+
+	if !math.IsInf(rssi, 0) && !math.IsNaN(rssi) {
+		if len(sc.rssi) < coverageRssiSamples {
+			sc.rssi = append(sc.rssi, rssi)
+		} else {
+			sc.rssi[sc.rssiNext] = rssi
+		}
+		sc.rssiNext = (sc.rssiNext + 1) % coverageRssiSamples
+		if nil != c.metrics.Rssi {
+			c.metrics.Rssi.WithLabelValues(sc.id).Observe(rssi)
+		}
+	}
+
+	if !hasPosition {
+		return
+	}
+	sc.positions++
+	bucket := int(rng / coverageRangeBucket)
+	if bucket > coverageRangeBuckets {
+		bucket = coverageRangeBuckets
+	}
+	sc.ranges[bucket]++
+	if nil != c.metrics.Range {
+		c.metrics.Range.WithLabelValues(sc.id).Observe(rng)
+	}
+	sector := int(bearing/(360/coverageSectors)) % coverageSectors
+	sc.sectors[sector].add(sectorSample{rng: rng, lat: lat, lon: lon, at: now})
+}
+
+// add keeps a position, replacing our oldest one once we have enough
+func (ss *sectorSamples) add(sample sectorSample) {
+	if len(ss.samples) < coverageSectorSamples {
+		ss.samples = append(ss.samples, sample)
+	} else {
+		ss.samples[ss.next] = sample
+	}
+	ss.next = (ss.next + 1) % coverageSectorSamples
+}
+
+// sectorRanges works out how far each of our sectors reaches from its recent positions,
+// must be called with our lock held
+func (sc *sourceCoverage) sectorRanges(now time.Time) []CoverageSector {
+	out := make([]CoverageSector, coverageSectors)
+	for i := range sc.sectors {
+		out[i].Bearing = float64(i * 360 / coverageSectors)
+		recent := make([]sectorSample, 0, len(sc.sectors[i].samples))
+		for _, sample := range sc.sectors[i].samples {
+			if now.Sub(sample.at) <= coverageSectorWindow {
+				recent = append(recent, sample)
+			}
+		}
+		if 0 == len(recent) {
+			continue
+		}
+		sort.Slice(recent, func(a, b int) bool {
+			return recent[a].rng < recent[b].rng
+		})
+		furthest := recent[percentileIndex(len(recent), coverageSectorPercentile)]
+		out[i].Range = furthest.rng
+		out[i].Lat = furthest.lat
+		out[i].Lon = furthest.lon
+	}
+	return out
+}
+
+// rollover works out our message rates and forgets the aircraft we have not heard in a while,
+// must be called with our lock held
+func (sc *sourceCoverage) rollover(now time.Time, elapsed time.Duration) {
+	sc.rates = make(map[string]float64, len(sc.rateCounts))
+	for df, count := range sc.rateCounts {
+		sc.rates[df] = float64(count) / elapsed.Seconds()
+	}
+	sc.rateCounts = map[string]uint64{}
+	sc.rateStart = now
+	for icao, seen := range sc.aircraft {
+		if now.Sub(seen) > coverageAircraftWindow {
+			delete(sc.aircraft, icao)
+		}
+	}
+}
+
+// snapshot gives us a copy of our statistics
+func (sc *sourceCoverage) snapshot() SourceCoverage {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	out := SourceCoverage{
+		Source:            sc.id,
+		RefLat:            sc.refLat,
+		RefLon:            sc.refLon,
+		RefEstimated:      sc.refEstimated,
+		Since:             sc.since,
+		Messages:          make(map[string]uint64, len(sc.messages)),
+		MessageRates:      make(map[string]float64, len(sc.rates)),
+		Positions:         sc.positions,
+		RangeDistribution: make([]RangeBucket, 0, len(sc.ranges)),
+	}
+	for df, count := range sc.messages {
+		out.Messages[df] = count
+	}
+	for df, rate := range sc.rates {
+		out.MessageRates[df] = rate
+	}
+	now := sc.latest
+	if now.IsZero() {
+		now = time.Now()
+	}
+	for _, seen := range sc.aircraft {
+		if now.Sub(seen) <= coverageAircraftWindow {
+			out.Aircraft++
+		}
+	}
+	out.Sectors = sc.sectorRanges(now)
+	for _, s := range out.Sectors {
+		out.MaxRange = math.Max(out.MaxRange, s.Range)
+	}
+	for i, count := range sc.ranges {
+		bucket := RangeBucket{From: float64(i) * coverageRangeBucket, To: float64(i+1) * coverageRangeBucket, Count: count}
+		if coverageRangeBuckets == i {
+			// our last bucket is everything further away
+			bucket.To = 0
+		}
+		out.RangeDistribution = append(out.RangeDistribution, bucket)
+	}
+	if len(sc.rssi) > 0 {
+		sorted := make([]float64, len(sc.rssi))
+		copy(sorted, sc.rssi)
+		sort.Float64s(sorted)
+		out.Rssi = &RssiPercentiles{
+			P10: percentile(sorted, 10),
+			P50: percentile(sorted, 50),
+			P90: percentile(sorted, 90),
+			P99: percentile(sorted, 99),
+		}
+	}
+	return out
+}
+
+// percentile picks the nearest rank from our sorted values
+func percentile(sorted []float64, p float64) float64 {
+	return sorted[percentileIndex(len(sorted), p)]
+}
+
+// percentileIndex is where the nearest rank is in n sorted values
+func percentileIndex(n int, p float64) int {
+	i := int(math.Ceil(p/100*float64(n))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return i
+}
+
+// Coverage gives us the statistics we have for each of our sources, if we are keeping them
+func (t *Tracker) Coverage() []SourceCoverage {
+	if nil == t.coverage {
+		return nil
+	}
+	t.coverage.lock.Lock()
+	sources := make([]*sourceCoverage, 0, len(t.coverage.sources))
+	for _, sc := range t.coverage.sources {
+		sources = append(sources, sc)
+	}
+	t.coverage.lock.Unlock()
+
+	out := make([]SourceCoverage, 0, len(sources))
+	for _, sc := range sources {
+		out = append(out, sc.snapshot())
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Source < out[j].Source
+	})
+	return out
+}
+
+// CoverageGeoJSON outlines what each source can hear, joining up its furthest position on each bearing
+func CoverageGeoJSON(sources []SourceCoverage) *geojson.FeatureCollection {
+	fc := geojson.NewFeatureCollection([]*geojson.Feature{})
+	for _, sc := range sources {
+		if nil == sc.RefLat || nil == sc.RefLon || 0 == sc.Positions {
+			continue
+		}
+		outline := make(geojson.Coordinates, 0, len(sc.Sectors)+1)
+		for _, s := range sc.Sectors {
+			lat, lon := *sc.RefLat, *sc.RefLon
+			if s.Range > 0 {
+				lat, lon = s.Lat, s.Lon
+			}
+			outline = append(outline, geojson.Coordinate{geojson.CoordType(lon), geojson.CoordType(lat)})
+		}
+		outline = append(outline, outline[0])
+		props := map[string]interface{}{
+			"source":    sc.Source,
+			"maxRange":  sc.MaxRange,
+			"aircraft":  sc.Aircraft,
+			"positions": sc.Positions,
+		}
+		fc.AddFeatures(geojson.NewFeature(geojson.NewPolygon(geojson.MultiLine{outline}), props, sc.Source))
+	}
+	return fc
+}
+
+// CoverageHandler serves our sources statistics as JSON, or as a GeoJSON outline with ?format=geojson
+func (t *Tracker) CoverageHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if "geojson" == r.URL.Query().Get("format") {
+			serveJson(w, CoverageGeoJSON(t.Coverage()))
+			return
+		}
+		serveJson(w, t.Coverage())
+	})
+}
+
+func serveJson(w http.ResponseWriter, body interface{}) {
+	buf, err := jsoniter.ConfigFastest.Marshal(body)
+	if nil != err {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(buf)
+}
+
+// initialBearing is the bearing (in degrees from north) to travel from the first point to the second
+func initialBearing(lat1, lon1, lat2, lon2 float64) float64 {
+	la1 := lat1 * math.Pi / 180
+	la2 := lat2 * math.Pi / 180
+	dLon := (lon2 - lon1) * math.Pi / 180
+	y := math.Sin(dLon) * math.Cos(la2)
+	x := math.Cos(la1)*math.Sin(la2) - math.Sin(la1)*math.Cos(la2)*math.Cos(dLon)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
@@ -0,0 +1,130 @@
+package tracker
+
+import (
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"plane.watch/lib/tracker/mode_s"
+)
+
+func TestTracker_Coverage(t *testing.T) {
+	trk := NewTracker(WithCoverage())
+	t.Cleanup(trk.Finish)
+	refLat, refLon := -31.95, 115.86
+	source := &FrameSource{Name: "perth", RefLat: &refLat, RefLon: &refLon}
+
+	frame, err := mode_s.DecodeString("*8D40621D58C382D690C8AC2863A7;", time.Now())
+	if nil != err {
+		t.Fatalf("failed to decode our frame: %s", err)
+	}
+	north := trk.GetPlane(0x7C0001)
+	east := trk.GetPlane(0x7C0002)
+
+	before := north.LocationUpdatedAt()
+	_ = north.addLatLong(-31.05, 115.86, time.Now())
+	trk.coverage.record(source, &refLat, &refLon, frame, north, before)
+
+	before = east.LocationUpdatedAt()
+	_ = east.addLatLong(-31.95, 116.39, time.Now())
+	trk.coverage.record(source, &refLat, &refLon, frame, east, before)
+
+	// a frame that did not move our plane does not count as a position
+	trk.coverage.record(source, &refLat, &refLon, frame, east, east.LocationUpdatedAt())
+
+	coverage := trk.Coverage()
+	if 1 != len(coverage) {
+		t.Fatalf("expected coverage for 1 source, got %d", len(coverage))
+	}
+	sc := coverage[0]
+	if "perth" != sc.Source || 3 != sc.Messages["DF17"] || 2 != sc.Aircraft || 2 != sc.Positions {
+		t.Errorf("expected 3 DF17 messages, 2 aircraft and 2 positions for perth, got %+v", sc)
+	}
+	if math.Abs(sc.Sectors[0].Range-100_000) > 1000 {
+		t.Errorf("expected our northern sector to reach 100km, got %0.0fm", sc.Sectors[0].Range)
+	}
+	if math.Abs(sc.Sectors[9].Range-50_000) > 1000 {
+		t.Errorf("expected our eastern sector to reach 50km, got %0.0fm", sc.Sectors[9].Range)
+	}
+	if sc.MaxRange != sc.Sectors[0].Range {
+		t.Errorf("expected our max range to be our northern sector, got %0.0fm", sc.MaxRange)
+	}
+	if 1 != sc.RangeDistribution[2].Count || 1 != sc.RangeDistribution[4].Count {
+		t.Errorf("expected a position in our 50km and 100km range buckets, got %+v", sc.RangeDistribution)
+	}
+
+	// a single position much further out than the rest of our sector does not set its range
+	south := trk.GetPlane(0x7C0003)
+	for i := 0; i < 100; i++ {
+		before = south.LocationUpdatedAt()
+		_ = south.addLatLong(-32.40, 115.86, time.Now())
+		trk.coverage.record(source, &refLat, &refLon, frame, south, before)
+	}
+	farSouth := trk.GetPlane(0x7C0004)
+	before = farSouth.LocationUpdatedAt()
+	_ = farSouth.addLatLong(-35.55, 115.86, time.Now())
+	trk.coverage.record(source, &refLat, &refLon, frame, farSouth, before)
+	if rng := trk.Coverage()[0].Sectors[18].Range; math.Abs(rng-50_000) > 1000 {
+		t.Errorf("expected our southern sector to reach 50km, got %0.0fm", rng)
+	}
+
+	// and what a source could hear a long time ago does not count
+	sc.Sectors = trk.coverage.sources["perth"].sectorRanges(time.Now().Add(coverageSectorWindow + time.Minute))
+	for _, s := range sc.Sectors {
+		if 0 != s.Range {
+			t.Errorf("expected our old positions to no longer count, bearing %0.0f reaches %0.0fm", s.Bearing, s.Range)
+		}
+	}
+
+	fc := CoverageGeoJSON(coverage)
+	if 1 != len(fc.Features) {
+		t.Fatalf("expected a coverage outline for our source, got %d", len(fc.Features))
+	}
+
+	w := httptest.NewRecorder()
+	trk.CoverageHandler().ServeHTTP(w, httptest.NewRequest("GET", "/coverage?format=geojson", nil))
+	if !strings.Contains(w.Body.String(), `"Polygon"`) {
+		t.Errorf("expected a GeoJSON polygon, got %s", w.Body.String())
+	}
+}
+
+func TestTracker_CoverageUsesFrameTime(t *testing.T) {
+	trk := NewTracker(WithCoverage())
+	t.Cleanup(trk.Finish)
+	refLat, refLon := -31.95, 115.86
+	source := &FrameSource{Name: "recording", RefLat: &refLat, RefLon: &refLon}
+	plane := trk.GetPlane(0x7C0001)
+
+	// a recording from a couple of days ago, two messages a second for a minute and then one more
+	start := time.Now().Add(-48 * time.Hour)
+	for i := 0; i <= 120; i++ {
+		at := start.Add(time.Duration(i) * 500 * time.Millisecond)
+		if 120 == i {
+			at = start.Add(coverageRateWindow)
+		}
+		frame, err := mode_s.DecodeString("*8D40621D58C382D690C8AC2863A7;", at)
+		if nil != err {
+			t.Fatalf("failed to decode our frame: %s", err)
+		}
+		before := plane.LocationUpdatedAt()
+		_ = plane.addLatLong(-31.05, 115.86, at)
+		trk.coverage.record(source, &refLat, &refLon, frame, plane, before)
+	}
+
+	sc := trk.Coverage()[0]
+	if !sc.Since.Equal(start) {
+		t.Errorf("expected our source to be heard since %s, got %s", start, sc.Since)
+	}
+	// the message that rolls our window over counts towards it too
+	if rate, expected := sc.MessageRates["DF17"], 121/coverageRateWindow.Seconds(); math.Abs(rate-expected) > 0.001 {
+		t.Errorf("expected %0.2f DF17 messages a second, got %0.2f", expected, rate)
+	}
+	if 1 != sc.Aircraft {
+		t.Errorf("expected our recorded aircraft to count, got %d", sc.Aircraft)
+	}
+	if math.Abs(sc.Sectors[0].Range-100_000) > 1000 {
+		t.Errorf("expected our recorded positions to count towards our northern sector, got %0.0fm", sc.Sectors[0].Range)
+	}
+}
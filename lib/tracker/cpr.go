@@ -29,6 +29,28 @@ type CprLocation struct {
 	globalSurfaceRange float64
 
 	refLat, refLon float64
+
+	// surface is set when our frames are surface positions, they do not decode with airborne ones
+	surface bool
+}
+
+const (
+	// A local CPR decode is only unambiguous within half a zone of its reference. These are half a zone (in metres)
+	// in the air and on the ground
+	localCprAirborneHalfZone = 333_000.0
+	localCprSurfaceHalfZone  = 83_000.0
+	// localCprZoneMargin is how much of half a zone we let a local decode be from its reference
+	localCprZoneMargin = 0.75
+	// localCprMaxRefAge is how old a planes position can be and still be the reference for a local decode
+	localCprMaxRefAge = 30 * time.Second
+)
+
+// WithPairedCprOnly only places planes from even/odd CPR pairs, never from a single frame decoded against where the
+// plane or its receiver was
+func WithPairedCprOnly() Option {
+	return func(t *Tracker) {
+		t.pairedCprOnly = true
+	}
 }
 
 var NLTable = map[int32]float64{
@@ -115,6 +137,16 @@ func (cpr *CprLocation) zero(lock bool) {
 	cpr.oddFrame = false
 }
 
+// setSurface tells us if our frames are surface positions, throwing away any frames of the other kind
+func (cpr *CprLocation) setSurface(surface bool) {
+	cpr.rwLock.Lock()
+	defer cpr.rwLock.Unlock()
+	if cpr.surface != surface {
+		cpr.zero(false)
+		cpr.surface = surface
+	}
+}
+
 func (cpr *CprLocation) SetEvenLocation(lat, lon float64, t time.Time) error {
 	// cpr locations are 17 bits long, if we get a value outside of this then we have a problem
 	if lat > max17Bits || lat < 0 || lon > max17Bits || lon < 0 {
@@ -418,6 +450,37 @@ func (cpr *CprLocation) decodeGlobalAir() (*PlaneLocation, error) {
 	return locRet, nil
 }
 
+// decodeLocalCpr decodes a single CPR frame against a reference that we trust to be within half a zone of the plane.
+// Unlike a global decode, it does not need the other half of an even/odd pair
+func decodeLocalCpr(cprLat, cprLon float64, odd, onGround bool, refLat, refLon float64) (lat, lon float64, err error) {
+	zoneRange := 360.0
+	if onGround {
+		zoneRange = 90.0
+	}
+	i := 0.0
+	if odd {
+		i = 1
+	}
+	dLat := zoneRange / (60 - i)
+	yz := cprLat / 131072
+	j := math.Floor(refLat/dLat) + math.Floor(0.5+cprPositiveMod(refLat, dLat)/dLat-yz)
+	lat = dLat * (j + yz)
+	if lat < -90 || lat > 90 {
+		return 0, 0, fmt.Errorf("failed to decode local CPR, lat %0.6f is out of range", lat)
+	}
+
+	nl := float64(getNumLongitudeZone(lat)) - i
+	if nl < 1 {
+		nl = 1
+	}
+	dLon := zoneRange / nl
+	xz := cprLon / 131072
+	m := math.Floor(refLon/dLon) + math.Floor(0.5+cprPositiveMod(refLon, dLon)/dLon-xz)
+	lon = dLon * (m + xz)
+	lon -= math.Floor((lon+180.0)/360.0) * 360.0
+	return lat, lon, nil
+}
+
 // NL - The NL function uses the precomputed table from 1090-WP-9-14
 func getNumLongitudeZone(lat float64) int32 {
 	if lat < 0 {
@@ -457,7 +520,36 @@ func cprModFunction(a, b int32) float64 {
 	return res
 }
 
+// cprPositiveMod is cprModFunction for the fractional values a local decode works with
+func cprPositiveMod(a, b float64) float64 {
+	res := math.Mod(a, b)
+	if res < 0 {
+		res += b
+	}
+	return res
+}
+
 // haversin(θ) function
 func hsin(theta float64) float64 {
 	return math.Pow(math.Sin(theta/2), 2)
 }
+
+// localCprRange is how far (in metres) from a receiver we let a local decode against it be. We do not go past the range
+// of the receiver (if we know it), or get near half a zone. A receiver that hears further than half a zone
+// can hear planes from the next zone over, which decode to within a zone less its range of it, so we stay inside that
+// too. Planes on the ground are only heard close by, so that does not matter for surface positions
+func localCprRange(onGround bool, heardBy *receiverRange) float64 {
+	if onGround {
+		maxRange := localCprSurfaceHalfZone * localCprZoneMargin
+		if nil != heardBy && heardBy.known {
+			maxRange = math.Min(maxRange, heardBy.metres)
+		}
+		return maxRange
+	}
+	maxRange := localCprAirborneHalfZone * localCprZoneMargin
+	if nil != heardBy && heardBy.known {
+		maxRange = math.Min(maxRange, heardBy.metres)
+		maxRange = math.Min(maxRange, (2*localCprAirborneHalfZone-heardBy.metres)*localCprZoneMargin)
+	}
+	return math.Max(maxRange, 0)
+}
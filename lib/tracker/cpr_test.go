@@ -2,6 +2,7 @@ package tracker
 
 import (
 	"fmt"
+	"math"
 	"plane.watch/lib/tracker/mode_s"
 	"testing"
 	"time"
@@ -357,3 +358,110 @@ func TestCprDecode2(t *testing.T) {
 	}
 
 }
+
+func TestDecodeLocalCpr(t *testing.T) {
+	// airborne example from https://mode-s.org/decode/content/ads-b/3-airborne-position.html
+	air, err := mode_s.DecodeString("8D40621D58C382D690C8AC2863A7", time.Now())
+	if nil != err {
+		t.Fatal(err)
+	}
+	lat, lon, err := decodeLocalCpr(float64(air.Latitude()), float64(air.Longitude()), !air.IsEven(), false, 52.258, 3.918)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if math.Abs(lat-52.25720) > 0.00001 || math.Abs(lon-3.91937) > 0.00001 {
+		t.Errorf("expected our airborne frame to decode to {52.25720, 3.91937}, got {%0.5f, %0.5f}", lat, lon)
+	}
+
+	// a local surface decode should agree with decoding the pair
+	frame0 := decodeSurfaceFrame(t, "*8C4841753AAB238733C8CD4020B1;")
+	frame1 := decodeSurfaceFrame(t, "*8C4841753A8A35323FAEBDAC702D;")
+	cpr := CprLocation{}
+	_ = cpr.SetEvenLocation(float64(frame0.Latitude()), float64(frame0.Longitude()), frame0.TimeStamp())
+	_ = cpr.SetOddLocation(float64(frame1.Latitude()), float64(frame1.Longitude()), frame1.TimeStamp())
+	pair, err := cpr.decodeSurface(51.990, 4.375)
+	if nil != err {
+		t.Fatal(err)
+	}
+	lat, lon, err = decodeLocalCpr(float64(frame0.Latitude()), float64(frame0.Longitude()), false, true, 51.990, 4.375)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if math.Abs(lat-pair.latitude) > 1e-9 || math.Abs(lon-pair.longitude) > 1e-9 {
+		t.Errorf("expected our local surface decode to be {%0.6f, %0.6f}, got {%0.6f, %0.6f}", pair.latitude, pair.longitude, lat, lon)
+	}
+}
+
+func TestPlane_DecodeCprLocal(t *testing.T) {
+	frame, err := mode_s.DecodeString("8D40621D58C382D690C8AC2863A7", time.Now())
+	if nil != err {
+		t.Fatal(err)
+	}
+	trk := NewTracker()
+	t.Cleanup(trk.Finish)
+
+	// a single frame is all we need when we have a reference
+	refLat, refLon := 52.258, 3.918
+	p := trk.GetPlane(frame.Icao())
+	p.HandleModeSFrame(frame, &refLat, &refLon)
+	if !p.HasLocation() {
+		t.Fatalf("expected a single frame to decode against our reference")
+	}
+
+	// a reference too far away to trust
+	farLat := 55.0
+	p = trk.GetPlane(0x7C0007)
+	if err = p.decodeCprLocal(frame, false, &farLat, &refLon, nil); nil == err {
+		t.Errorf("expected a local decode 300km from its reference to be rejected")
+	}
+	if p.HasLocation() {
+		t.Errorf("expected our plane to not have a location")
+	}
+}
+
+func TestLocalCprRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		onGround bool
+		heardBy  *receiverRange
+		want     float64
+	}{
+		{name: "airborne, range unknown", want: 249_750},
+		{name: "airborne, short range receiver", heardBy: &receiverRange{metres: 100_000, known: true}, want: 100_000},
+		{name: "airborne, hears past half a zone", heardBy: &receiverRange{metres: 400_000, known: true}, want: 199_500},
+		{name: "airborne, hears past a zone", heardBy: &receiverRange{metres: 700_000, known: true}, want: 0},
+		{name: "airborne, only the furthest anyone hears", heardBy: &receiverRange{metres: maxReceiverRange}, want: 249_750},
+		{name: "surface, range unknown", onGround: true, want: 62_250},
+		{name: "surface, long range receiver", onGround: true, heardBy: &receiverRange{metres: 300_000, known: true}, want: 62_250},
+		{name: "surface, short range receiver", onGround: true, heardBy: &receiverRange{metres: 20_000, known: true}, want: 20_000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := localCprRange(tt.onGround, tt.heardBy); math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("expected %0.0fm, got %0.0fm", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPlane_DecodeCprLocalReceiverRange(t *testing.T) {
+	frame, err := mode_s.DecodeString("8D40621D58C382D690C8AC2863A7", time.Now())
+	if nil != err {
+		t.Fatal(err)
+	}
+	trk := NewTracker()
+	t.Cleanup(trk.Finish)
+
+	// our plane is ~200km north of our receiver
+	refLat, refLon := 50.457, 3.918
+	if err = trk.GetPlane(0x7C0008).decodeCprLocal(frame, false, &refLat, &refLon, &receiverRange{lat: refLat, lon: refLon, metres: 150_000, known: true, reject: true}); nil == err {
+		t.Errorf("expected a local decode further away than our receiver hears to be rejected")
+	}
+	p := trk.GetPlane(0x7C0009)
+	if err = p.decodeCprLocal(frame, false, &refLat, &refLon, &receiverRange{lat: refLat, lon: refLon, metres: 250_000, known: true, reject: true}); nil != err {
+		t.Errorf("expected a local decode inside our receivers range to be taken, got %s", err)
+	}
+	if math.Abs(p.Lat()-52.25720) > 0.00001 || math.Abs(p.Lon()-3.91937) > 0.00001 {
+		t.Errorf("expected our plane at {52.25720, 3.91937}, got {%0.5f, %0.5f}", p.Lat(), p.Lon())
+	}
+}
@@ -0,0 +1,115 @@
+package tracker
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"plane.watch/lib/tracker/mode_s"
+)
+
+// WithDecodeQueue sets how many frames we can have waiting to be processed, and what to do when there is no more room
+func WithDecodeQueue(size int, policy OverflowPolicy) Option {
+	return func(t *Tracker) {
+		if size > 0 {
+			t.decodeQueueSize = size
+		}
+		t.overflowPolicy = policy
+	}
+}
+
+// WithDecodeQueueCounters lets us see how deep our decode queues are and how many frames we have had to drop
+func WithDecodeQueueCounters(queued prometheus.Gauge, dropped prometheus.Counter) Option {
+	return func(t *Tracker) {
+		t.stats.queuedFrames = queued
+		t.stats.droppedFrames = dropped
+	}
+}
+
+// makeDecodingQueues splits our queue between our decode workers, each worker looks after its own set of planes
+func (t *Tracker) makeDecodingQueues() {
+	if t.decodeWorkerCount < 1 {
+		t.decodeWorkerCount = 1
+	}
+	perWorker := t.decodeQueueSize / t.decodeWorkerCount
+	if perWorker < 1 {
+		perWorker = 1
+	}
+	t.decodingQueues = make([]chan *FrameEvent, t.decodeWorkerCount)
+	for i := range t.decodingQueues {
+		t.decodingQueues[i] = make(chan *FrameEvent, perWorker)
+	}
+}
+
+// queueFor gives us the queue that handles the given plane, so that all of a planes frames are processed in order
+func (t *Tracker) queueFor(icao uint32) chan *FrameEvent {
+	return t.decodingQueues[icao%uint32(len(t.decodingQueues))]
+}
+
+// queueFrame works out which plane our frame is for, and queues it for that planes worker to decode
+func (t *Tracker) queueFrame(f *FrameEvent) {
+	if nil == f || nil == f.Frame() {
+		return
+	}
+	if nil != t.stats.decodedFrames {
+		t.stats.decodedFrames.Inc()
+	}
+	icao, err := frameAddress(f.Frame())
+	if nil != err {
+		t.decodeFailed(f, err)
+		return
+	}
+	t.queuesLock.RLock()
+	defer t.queuesLock.RUnlock()
+	if !t.queuesOpen {
+		// we are shutting down and can no longer take frames
+		t.frameDropped()
+		return
+	}
+	t.enqueue(t.queueFor(icao), f)
+}
+
+// frameAddress gives us the plane our frame is for, only decoding all of it when there is no quicker way.
+// The rest of the decoding is left to the planes worker, so that a busy feed is still decoded in parallel
+func frameAddress(frame Frame) (uint32, error) {
+	if a, ok := frame.(addressedFrame); ok {
+		return a.Address()
+	}
+	if err := frame.Decode(); nil != err {
+		return 0, err
+	}
+	return frame.Icao(), nil
+}
+
+// decodeFailed tells someone about a frame that we could not decode
+func (t *Tracker) decodeFailed(f *FrameEvent, err error) {
+	if mode_s.ErrNoOp == err {
+		return
+	}
+	t.log.Error().Err(err).Str("Tag", f.Source().Tag).Send()
+}
+
+// enqueue adds our frame to the queue, following our overflow policy if it is full
+func (t *Tracker) enqueue(queue chan *FrameEvent, f *FrameEvent) {
+	queued, evicted := offer(queue, f, t.overflowPolicy)
+	for i := 0; i < evicted; i++ {
+		t.frameDequeued()
+		t.frameDropped()
+	}
+	if !queued {
+		t.frameDropped()
+		return
+	}
+	if nil != t.stats.queuedFrames {
+		t.stats.queuedFrames.Inc()
+	}
+}
+
+func (t *Tracker) frameDequeued() {
+	if nil != t.stats.queuedFrames {
+		t.stats.queuedFrames.Dec()
+	}
+}
+
+func (t *Tracker) frameDropped() {
+	if nil != t.stats.droppedFrames {
+		t.stats.droppedFrames.Inc()
+	}
+}
@@ -0,0 +1,102 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+
+	"plane.watch/lib/tracker/mode_s"
+)
+
+func queuedFrames(queue chan *FrameEvent) []*FrameEvent {
+	frames := make([]*FrameEvent, 0)
+	for {
+		select {
+		case f := <-queue:
+			frames = append(frames, f)
+		default:
+			return frames
+		}
+	}
+}
+
+func TestTracker_EnqueueOverflow(t *testing.T) {
+	frames := []*FrameEvent{
+		NewFrameEvent(mode_s.NewFrame("*8D7C7F0D581176D7BB8D48CD7714;", time.Now()), nil),
+		NewFrameEvent(mode_s.NewFrame("*8D7C7F0D581176D7BB8D48CD7714;", time.Now()), nil),
+		NewFrameEvent(mode_s.NewFrame("*8D7C7F0D581176D7BB8D48CD7714;", time.Now()), nil),
+	}
+	tests := []struct {
+		policy   OverflowPolicy
+		expected []*FrameEvent
+	}{
+		{policy: OverflowDropNewest, expected: frames[:2]},
+		{policy: OverflowDropOldest, expected: frames[1:]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			trk := &Tracker{overflowPolicy: tt.policy}
+			queue := make(chan *FrameEvent, 2)
+			for _, f := range frames {
+				trk.enqueue(queue, f)
+			}
+			got := queuedFrames(queue)
+			if len(tt.expected) != len(got) {
+				t.Fatalf("Expected %d frames in the queue, got %d", len(tt.expected), len(got))
+			}
+			for i := range got {
+				if tt.expected[i] != got[i] {
+					t.Errorf("Unexpected frame at position %d", i)
+				}
+			}
+		})
+	}
+
+	t.Run("block", func(t *testing.T) {
+		trk := &Tracker{overflowPolicy: OverflowBlock}
+		queue := make(chan *FrameEvent, 1)
+		trk.enqueue(queue, frames[0])
+		done := make(chan bool)
+		go func() {
+			trk.enqueue(queue, frames[1])
+			close(done)
+		}()
+		select {
+		case <-done:
+			t.Fatalf("Expected to wait for room in the queue")
+		case <-time.After(20 * time.Millisecond):
+		}
+		<-queue
+		<-done
+		if got := queuedFrames(queue); 1 != len(got) || frames[1] != got[0] {
+			t.Errorf("Expected our second frame to be queued once there was room")
+		}
+	})
+}
+
+func TestTracker_QueueForIsStablePerPlane(t *testing.T) {
+	trk := &Tracker{decodeWorkerCount: 4, decodeQueueSize: 100}
+	trk.makeDecodingQueues()
+	if 4 != len(trk.decodingQueues) || 25 != cap(trk.decodingQueues[0]) {
+		t.Fatalf("Expected 4 queues of 25 frames")
+	}
+	for _, icao := range []uint32{0x7C1234, 0x7C1235, 0xABCDEF} {
+		if trk.queueFor(icao) != trk.queueFor(icao) {
+			t.Errorf("Expected the same queue for the same plane")
+		}
+	}
+	if trk.queueFor(0x7C1234) == trk.queueFor(0x7C1235) {
+		t.Errorf("Expected neighbouring planes to be spread across workers")
+	}
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowBlock, OverflowDropOldest, OverflowDropNewest} {
+		got, err := ParseOverflowPolicy(policy.String())
+		if nil != err || got != policy {
+			t.Errorf("Expected to parse %s", policy)
+		}
+	}
+	if _, err := ParseOverflowPolicy("sometimes"); nil == err {
+		t.Errorf("Expected an unknown policy to fail")
+	}
+}
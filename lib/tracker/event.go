@@ -1,6 +1,11 @@
 package tracker
 
-const PlaneLocationEventType = "plane-location-event"
+const (
+	PlaneLocationEventType = "plane-location-event"
+	// FrameEventType picks out frame events when choosing which events a sink gets. A FrameEvent still says it is a
+	// PlaneLocationEventType, as it always has, so that consumers looking for that keep working
+	FrameEventType = "frame-event"
+)
 
 type (
 	// Event is something that we want to know about. This is the base of our sending of data
@@ -19,30 +24,55 @@ type (
 	FrameEvent struct {
 		frame  Frame
 		source *FrameSource
+		// meta is anything our middlewares have to say about this frame
+		meta map[string]string
 	}
 
 	FrameSource struct {
 		OriginIdentifier string
 		Name, Tag        string
 		RefLat, RefLon   *float64
+		// MaxRange is how far (in metres) the source can hear, 0 if we should work it out
+		MaxRange float64
 	}
 )
 
+// Id is how we tell our sources apart, their tag if they have one
+func (fs *FrameSource) Id() string {
+	if "" != fs.Tag {
+		return fs.Tag
+	}
+	if "" != fs.Name {
+		return fs.Name
+	}
+	return fs.OriginIdentifier
+}
+
 func (t *Tracker) AddEvent(e Event) {
 	t.eventSync.RLock()
 	defer t.eventSync.RUnlock()
 	if t.eventsOpen {
-		t.events <- e
+		select {
+		case t.events <- e:
+		case <-t.eventsClosing:
+		}
 	}
 }
 
 func (t *Tracker) processEvents() {
-	t.eventsWaiter.Add(1)
 	for e := range t.events {
-		for _, sink := range t.sinks {
-			sink.OnEvent(e)
+		t.sinksLock.RLock()
+		for _, sq := range t.sinks {
+			sq.add(e)
 		}
+		t.sinksLock.RUnlock()
+	}
+	// let each of our sinks catch up before we say we are done
+	t.sinksLock.RLock()
+	for _, sq := range t.sinks {
+		sq.close()
 	}
+	t.sinksLock.RUnlock()
 	t.eventsWaiter.Done()
 }
 
@@ -89,3 +119,23 @@ func (f *FrameEvent) Frame() Frame {
 func (f *FrameEvent) Source() *FrameSource {
 	return f.source
 }
+
+// SetMeta lets a middleware annotate our frame. Middlewares run one after the other for a frame, so this is only
+// safe to call from Middleware.Handle
+func (f *FrameEvent) SetMeta(key, value string) {
+	if nil == f.meta {
+		f.meta = map[string]string{}
+	}
+	f.meta[key] = value
+}
+
+// Meta gets an annotation a middleware has put on our frame
+func (f *FrameEvent) Meta(key string) (string, bool) {
+	value, ok := f.meta[key]
+	return value, ok
+}
+
+// Metadata is everything our middlewares have said about our frame
+func (f *FrameEvent) Metadata() map[string]string {
+	return f.meta
+}
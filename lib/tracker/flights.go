@@ -0,0 +1,68 @@
+package tracker
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultFlightGap is how long a plane can go unheard before we say it is on a new flight
+const defaultFlightGap = 15 * time.Minute
+
+// WithFlightGap sets how long we go without hearing from a plane before its next message starts a new flight
+func WithFlightGap(gap time.Duration) Option {
+	return func(t *Tracker) {
+		t.flightGap = gap
+	}
+}
+
+// flightIdFor gives us a stable identifier for the flight the given plane started at the given time
+func flightIdFor(icao string, started time.Time) string {
+	return fmt.Sprintf("%s-%s", icao, started.UTC().Format("20060102T150405Z"))
+}
+
+// startFlight begins a new flight for our plane, must be called with our lock held. seen is true when we saw the
+// flight start (a takeoff or new callsign), rather than picking the plane up part way through its flight
+func (p *Plane) startFlight(ts time.Time, seen bool) {
+	if "" != p.flight.id {
+		// the track we have belongs to the last flight
+		p.locationHistory.reset()
+	}
+	p.flight.id = flightIdFor(p.icao, ts)
+	p.flight.startedAt = ts
+	p.flight.startSeen = seen
+	p.flight.landed = false
+}
+
+// checkFlightGap starts a new flight if this is the first we have heard from our plane, or if we have not heard
+// from it in a long time, must be called with our lock held
+func (p *Plane) checkFlightGap(ts time.Time) {
+	gap := defaultFlightGap
+	if nil != p.tracker {
+		gap = p.tracker.flightGap
+	}
+	if "" == p.flight.id || (gap > 0 && !p.lastSeen.IsZero() && ts.Sub(p.lastSeen) >= gap) {
+		p.startFlight(ts, false)
+	}
+}
+
+// FlightId identifies the flight our plane is on. A plane starts a new flight when it takes off after landing,
+// after we have not heard from it for a while and when its callsign changes
+func (p *Plane) FlightId() string {
+	p.rwLock.RLock()
+	defer p.rwLock.RUnlock()
+	return p.flight.id
+}
+
+// FlightStartedAt is when our planes current flight started
+func (p *Plane) FlightStartedAt() time.Time {
+	p.rwLock.RLock()
+	defer p.rwLock.RUnlock()
+	return p.flight.startedAt
+}
+
+// FlightStartSeen is true when we saw our planes current flight start, rather than picking it up part way through
+func (p *Plane) FlightStartSeen() bool {
+	p.rwLock.RLock()
+	defer p.rwLock.RUnlock()
+	return p.flight.startSeen
+}
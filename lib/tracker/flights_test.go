@@ -0,0 +1,60 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlane_FlightSegments(t *testing.T) {
+	trk := NewTracker(WithFlightGap(20 * time.Minute))
+	defer trk.Finish()
+	p := trk.GetPlane(0x7C1234)
+	start := time.Date(2022, 8, 1, 9, 30, 0, 0, time.UTC)
+
+	p.setLastSeen(start)
+	first := p.FlightId()
+	if "7C1234-20220801T093000Z" != first {
+		t.Errorf("Unexpected flight id %s", first)
+	}
+	if p.FlightStartSeen() {
+		t.Errorf("We did not see our first flight start")
+	}
+
+	p.setFlightNumber("QFA123")
+	p.setLastSeen(start.Add(10 * time.Minute))
+	if first != p.FlightId() {
+		t.Errorf("A first callsign and a short gap should not start a new flight")
+	}
+
+	// land, and then take off again
+	p.setGroundStatus(false, start)
+	p.setVelocity(130, start)
+	p.setGroundStatus(true, start.Add(time.Hour))
+	if first != p.FlightId() {
+		t.Errorf("Landing does not start a new flight until we take off")
+	}
+	p.rwLock.Lock()
+	p.locationHistory.push(&PlaneLocation{}, 0, 0)
+	p.rwLock.Unlock()
+	p.setVelocity(150, start.Add(2*time.Hour))
+	p.setGroundStatus(false, start.Add(2*time.Hour))
+	second := p.FlightId()
+	if "7C1234-20220801T113000Z" != second || !p.FlightStartSeen() {
+		t.Errorf("Taking off should have started a new flight, got %s", second)
+	}
+	if 0 != len(p.LocationHistory()) {
+		t.Errorf("Our new flight should not have our old track")
+	}
+
+	p.setLastSeen(start.Add(2*time.Hour + time.Minute))
+	p.setFlightNumber("QFA124")
+	third := p.FlightId()
+	if second == third {
+		t.Errorf("A new callsign should start a new flight")
+	}
+
+	p.setLastSeen(start.Add(3 * time.Hour))
+	if third == p.FlightId() || p.FlightStartSeen() {
+		t.Errorf("A long gap should start a new flight")
+	}
+}
@@ -110,11 +110,9 @@ func (fl *lossyFrameList) Len() int {
 func (fl *lossyFrameList) Range(f func(f *mode_s.Frame) bool) {
 	fl.mu.Lock()
 	defer fl.mu.Unlock()
-	t := fl.head
-	for t.next != nil {
+	for t := fl.head; nil != t; t = t.next {
 		if !f(t.item) {
 			return
 		}
-		t = t.next
 	}
 }
@@ -80,3 +80,26 @@ func BenchmarkLossyFrameList_Push(b *testing.B) {
 		fl.Push(frame)
 	}
 }
+
+func TestStackRange(t *testing.T) {
+	fl := newLossyFrameList(10)
+	count := 0
+	fl.Range(func(f *mode_s.Frame) bool {
+		count++
+		return true
+	})
+	if 0 != count {
+		t.Errorf("an empty stack should have nothing to range over")
+	}
+
+	for i := 0; i < 3; i++ {
+		fl.Push(&mode_s.Frame{})
+	}
+	fl.Range(func(f *mode_s.Frame) bool {
+		count++
+		return true
+	})
+	if 3 != count {
+		t.Errorf("expected to range over all 3 frames, got %d", count)
+	}
+}
@@ -0,0 +1,146 @@
+package tracker
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// groundVerticalStatus is a DF0/4/5/11/16 or operational status frame telling us if the plane is on the ground
+	groundVerticalStatus groundSource = iota
+	// groundSurfaceFrame is a DF17 surface position or surface status, only sent on the ground
+	groundSurfaceFrame
+	// groundAirborneFrame is a DF17 airborne position or velocity, only sent in the air
+	groundAirborneFrame
+)
+
+const (
+	// groundHysteresis is how long our evidence has to disagree with our air/ground state before we change it
+	groundHysteresis = 5 * time.Second
+	// groundEvidenceWeight is how much each frame counts towards our evidence, compared to the frames before it
+	groundEvidenceWeight = 0.3
+	// groundSwitchConfidence is how strongly our evidence has to lean the other way before we change state
+	groundSwitchConfidence = 0.3
+	// groundStuckWeight is how much a frame says the plane is on the ground when its transponder says airborne while
+	// it goes slower than anything but a helicopter or balloon can fly
+	groundStuckWeight = 0.4
+	// groundStuckSpeed (knots) is slower than a plane can fly, a plane saying it is airborne at this speed is taxiing
+	groundStuckSpeed = 40
+	// groundMaxSpeed (knots) is faster than any plane goes on the ground
+	groundMaxSpeed = 250
+	// groundEvidenceMaxAge is how recent a speed or altitude has to be for us to weigh it against what a frame says
+	groundEvidenceMaxAge = 30 * time.Second
+)
+
+type (
+	// groundSource is the kind of frame telling us if the plane is on the ground
+	groundSource int
+
+	// airGround is what our frames have been telling us about a plane being on the ground
+	airGround struct {
+		// evidence is how our recent frames lean, from -1 (in the air) to 1 (on the ground)
+		evidence float64
+		// disputedSince is when our evidence started leaning away from our air/ground state
+		disputedSince time.Time
+	}
+)
+
+var groundWeights = map[groundSource]float64{
+	groundVerticalStatus: 0.6,
+	groundSurfaceFrame:   1,
+	groundAirborneFrame:  1,
+}
+
+// groundEvidence weighs up a frame telling us the plane is on the ground (or not). We only change our air/ground state
+// once the evidence has leaned the other way for groundHysteresis, so that a plane is not flipped by a single frame
+func (p *Plane) groundEvidence(source groundSource, onGround bool, ts time.Time) bool {
+	p.rwLock.Lock()
+	onGround, weight := p.weighGroundClaim(source, onGround, ts)
+	if 0 == weight {
+		p.rwLock.Unlock()
+		return false
+	}
+	lean := -weight
+	if onGround {
+		lean = weight
+	}
+
+	hasChanged := false
+	switch {
+	case p.location.onGroundTs.IsZero():
+		// our first idea of where the plane is, there is nothing to change from
+		p.ground.evidence = lean
+		hasChanged = p.changeGroundStatus(onGround, ts, ts)
+	default:
+		p.ground.evidence = (1-groundEvidenceWeight)*p.ground.evidence + groundEvidenceWeight*lean
+		leansGround := p.ground.evidence > 0
+		if leansGround == p.location.onGround || 0 == p.ground.evidence {
+			p.ground.disputedSince = time.Time{}
+			if onGround == p.location.onGround {
+				p.location.onGroundTs = ts
+			}
+			break
+		}
+		if p.ground.disputedSince.IsZero() {
+			p.ground.disputedSince = ts
+		}
+		if ts.Sub(p.ground.disputedSince) >= groundHysteresis && math.Abs(p.ground.evidence) >= groundSwitchConfidence {
+			hasChanged = p.changeGroundStatus(leansGround, p.ground.disputedSince, ts)
+		}
+	}
+	nowOnGround := p.location.onGround
+	p.rwLock.Unlock()
+
+	if nowOnGround {
+		p.setVerticalRate(0, ts)
+	}
+	return hasChanged
+}
+
+// weighGroundClaim checks what a frame tells us against how fast and high the plane is, giving us what we think the
+// frame really tells us and how much it counts. Must be called with our lock held
+func (p *Plane) weighGroundClaim(source groundSource, onGround bool, ts time.Time) (bool, float64) {
+	speedKnown := p.location.hasVelocity && !p.location.velocityTs.IsZero() && ts.Sub(p.location.velocityTs) <= groundEvidenceMaxAge
+	altitudeKnown := !p.location.altitudeTs.IsZero() && ts.Sub(p.location.altitudeTs) <= groundEvidenceMaxAge
+	if onGround {
+		// nothing is on the ground that high or that fast
+		if (speedKnown && p.location.velocity > groundMaxSpeed) || (altitudeKnown && p.location.altitude > groundMaxAltitude) {
+			return onGround, 0
+		}
+		return onGround, groundWeights[source]
+	}
+	// some transponders say they are airborne all of the time, no matter how slowly they are taxiing
+	if speedKnown && p.location.velocity < groundStuckSpeed && !slowFlyer(p.airframe.categoryType) {
+		if !altitudeKnown || p.location.altitude <= groundMaxAltitude {
+			return true, groundStuckWeight
+		}
+	}
+	return onGround, groundWeights[source]
+}
+
+// OnGroundConfidence is how sure we are (0 to 1) of OnGround, from how much our recent frames agree with it
+func (p *Plane) OnGroundConfidence() float64 {
+	p.rwLock.RLock()
+	defer p.rwLock.RUnlock()
+	if p.location.onGroundTs.IsZero() {
+		return 0
+	}
+	confidence := p.ground.evidence
+	if !p.location.onGround {
+		confidence = -confidence
+	}
+	if confidence < 0 {
+		return 0
+	}
+	return confidence
+}
+
+// slowFlyer tells us if an airframe category (see mode_s aircraftCategory) can fly slower than a plane taxis, e.g. a
+// helicopter or a balloon
+func slowFlyer(categoryType string) bool {
+	switch categoryType {
+	case "0/7", "1/1", "1/2", "1/3", "1/4", "1/6":
+		return true
+	}
+	return false
+}
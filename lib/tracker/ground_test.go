@@ -0,0 +1,108 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlane_GroundHysteresis(t *testing.T) {
+	trk, catcher := newEventTracker(t, LifecycleEventTypes)
+	p := trk.GetPlane(0x7C0030)
+	now := time.Now()
+	at := func(seconds int) time.Time {
+		return now.Add(time.Duration(seconds) * time.Second)
+	}
+
+	// on approach
+	p.setAltitude(1500, "feet", now)
+	p.setVelocity(140, now)
+	for i := 0; i < 10; i++ {
+		p.groundEvidence(groundAirborneFrame, false, at(i))
+	}
+	if p.OnGround() || p.OnGroundConfidence() < 0.9 {
+		t.Fatalf("expected to be sure our plane is airborne, got on ground %t (%0.2f)", p.OnGround(), p.OnGroundConfidence())
+	}
+
+	// a single frame saying otherwise does not put us on the ground
+	p.groundEvidence(groundVerticalStatus, true, at(10))
+	for i := 11; i < 20; i++ {
+		p.groundEvidence(groundAirborneFrame, false, at(i))
+	}
+	if p.OnGround() {
+		t.Errorf("expected a single on ground frame to not land our plane")
+	}
+	expectEvents(t, "single frame", eventTypes(t, p, catcher))
+
+	// touchdown, with the odd airborne frame still coming through
+	p.setVelocity(120, at(20))
+	for i := 20; i < 40; i++ {
+		onGround := 0 != i%5
+		source := groundSurfaceFrame
+		if !onGround {
+			source = groundAirborneFrame
+		}
+		p.groundEvidence(source, onGround, at(i))
+	}
+	if !p.OnGround() {
+		t.Fatalf("expected our plane to have landed")
+	}
+	expectEvents(t, "touchdown", eventTypes(t, p, catcher), LandingEventType)
+	if p.OnGroundConfidence() < 0.5 {
+		t.Errorf("expected to be fairly sure our plane is on the ground, got %0.2f", p.OnGroundConfidence())
+	}
+}
+
+func TestPlane_GroundStuckTransponder(t *testing.T) {
+	trk, catcher := newEventTracker(t, LifecycleEventTypes)
+	p := trk.GetPlane(0x7C0031)
+	now := time.Now()
+	at := func(seconds int) time.Time {
+		return now.Add(time.Duration(seconds) * time.Second)
+	}
+
+	p.groundEvidence(groundSurfaceFrame, true, now)
+	if !p.OnGround() {
+		t.Fatalf("expected our plane to start on the ground")
+	}
+
+	// taxiing, with a transponder that says it is airborne
+	for i := 1; i < 60; i++ {
+		p.setVelocity(15, at(i))
+		p.groundEvidence(groundAirborneFrame, false, at(i))
+	}
+	if !p.OnGround() {
+		t.Errorf("expected a slow plane saying it is airborne to stay on the ground")
+	}
+	expectEvents(t, "taxiing", eventTypes(t, p, catcher))
+
+	// a helicopter can hover
+	heli := trk.GetPlane(0x7C0032)
+	heli.setAirFrameCategoryType("0/7")
+	heli.groundEvidence(groundSurfaceFrame, true, now)
+	for i := 1; i < 20; i++ {
+		heli.setVelocity(5, at(i))
+		heli.groundEvidence(groundAirborneFrame, false, at(i))
+	}
+	if heli.OnGround() {
+		t.Errorf("expected a hovering helicopter to be airborne")
+	}
+
+	// our take off roll
+	for i := 60; i < 90; i++ {
+		p.setVelocity(float64(15+5*(i-60)), at(i))
+		p.groundEvidence(groundAirborneFrame, false, at(i))
+	}
+	if p.OnGround() {
+		t.Errorf("expected our plane to have taken off")
+	}
+	expectEvents(t, "takeoff", eventTypes(t, p, catcher), TakeoffEventType)
+
+	// nothing is on the ground at 35,000 feet
+	for i := 90; i < 120; i++ {
+		p.setAltitude(35000, "feet", at(i))
+		p.groundEvidence(groundVerticalStatus, true, at(i))
+	}
+	if p.OnGround() {
+		t.Errorf("expected our plane to stay airborne at 35,000 feet")
+	}
+}
@@ -0,0 +1,306 @@
+package tracker
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// historyAltitudeChange (feet) is how much a plane has to climb or descend for us to keep the point where it did
+	historyAltitudeChange = 300
+	// historyMaxGap is the longest we let a simplified history go between points, so we still know when it was where
+	historyMaxGap = time.Minute
+	// trackTolerance (metres) is how far a compact track can stray from the planes path
+	trackTolerance = 50.0
+)
+
+type (
+	// locationHistory is a ring buffer of where a plane has been, oldest first
+	locationHistory struct {
+		ring  []*PlaneLocation
+		head  int
+		count int
+		// dropped are the positions we have simplified away since the one before our newest
+		dropped []*PlaneLocation
+	}
+
+	// TrackPoint is a point on a compact track
+	TrackPoint struct {
+		Lat, Lon          float64
+		Altitude          int32
+		HasAltitude       bool
+		Heading, Velocity float64
+		At                time.Time
+		// TrackFinished is set on the last point before a gap we could not join up
+		TrackFinished bool
+	}
+)
+
+// WithLocationHistory bounds how much history we keep for each plane, to maxPoints positions (<= 0 for no limit) and
+// to positions no older than maxAge (0 for no limit). Without it we keep MaxLocationHistory positions
+func WithLocationHistory(maxPoints int, maxAge time.Duration) Option {
+	return func(t *Tracker) {
+		t.historyMaxPoints = maxPoints
+		t.historyMaxAge = maxAge
+		t.historyBounded = true
+	}
+}
+
+// WithHistorySimplification drops positions from our history that lie within toleranceMetres of the line between
+// their neighbours, as they arrive. Turns, climbs and descents are kept, straight and level flight is not
+func WithHistorySimplification(toleranceMetres float64) Option {
+	return func(t *Tracker) {
+		t.historyTolerance = toleranceMetres
+	}
+}
+
+func (h *locationHistory) len() int {
+	return h.count
+}
+
+// at gives us the i'th oldest position
+func (h *locationHistory) at(i int) *PlaneLocation {
+	return h.ring[(h.head+i)%len(h.ring)]
+}
+
+func (h *locationHistory) last() *PlaneLocation {
+	if 0 == h.count {
+		return nil
+	}
+	return h.at(h.count - 1)
+}
+
+// push adds our newest position, making room for it by dropping positions that are too old or too many
+func (h *locationHistory) push(loc *PlaneLocation, maxPoints int, maxAge time.Duration) {
+	for maxAge > 0 && h.count > 0 && loc.cprDecodedTs.Sub(h.at(0).cprDecodedTs) > maxAge {
+		h.dropOldest()
+	}
+	for maxPoints > 0 && h.count >= maxPoints {
+		h.dropOldest()
+	}
+	if h.count == len(h.ring) {
+		h.grow(maxPoints)
+	}
+	h.ring[(h.head+h.count)%len(h.ring)] = loc
+	h.count++
+	h.dropped = nil
+}
+
+// replaceLast swaps our newest position for the given one, remembering the one we dropped
+func (h *locationHistory) replaceLast(loc *PlaneLocation) {
+	i := (h.head + h.count - 1) % len(h.ring)
+	h.dropped = append(h.dropped, h.ring[i])
+	h.ring[i] = loc
+}
+
+func (h *locationHistory) dropOldest() {
+	h.ring[h.head] = nil
+	h.head = (h.head + 1) % len(h.ring)
+	h.count--
+}
+
+// grow makes room for more positions, never more than maxPoints of them
+func (h *locationHistory) grow(maxPoints int) {
+	size := 2 * len(h.ring)
+	if size < 16 {
+		size = 16
+	}
+	if maxPoints > 0 && size > maxPoints {
+		size = maxPoints
+	}
+	ring := make([]*PlaneLocation, size)
+	for i := 0; i < h.count; i++ {
+		ring[i] = h.at(i)
+	}
+	h.ring = ring
+	h.head = 0
+}
+
+// truncate keeps our oldest keep positions
+func (h *locationHistory) truncate(keep int) {
+	for i := keep; i < h.count; i++ {
+		h.ring[(h.head+i)%len(h.ring)] = nil
+	}
+	if keep < h.count {
+		h.count = keep
+	}
+	h.dropped = nil
+}
+
+func (h *locationHistory) reset() {
+	h.ring = nil
+	h.head = 0
+	h.count = 0
+	h.dropped = nil
+}
+
+// slice gives us our positions, oldest first
+func (h *locationHistory) slice() []*PlaneLocation {
+	out := make([]*PlaneLocation, h.count)
+	for i := range out {
+		out[i] = h.at(i)
+	}
+	return out
+}
+
+// historyLimits are how many positions, and how old a position, we keep for our plane and how far a position can be
+// off the line between its neighbours before we keep it
+func (p *Plane) historyLimits() (maxPoints int, maxAge time.Duration, toleranceMetres float64) {
+	maxPoints = MaxLocationHistory
+	if nil == p.tracker {
+		return maxPoints, 0, 0
+	}
+	if p.tracker.historyBounded {
+		maxPoints = p.tracker.historyMaxPoints
+		maxAge = p.tracker.historyMaxAge
+	}
+	return maxPoints, maxAge, p.tracker.historyTolerance
+}
+
+// addToHistory adds our newest position to our history, in place of the one before it if that one, and every position
+// we have already dropped in its place, adds nothing to our path. Must be called with our lock held
+func (p *Plane) addToHistory(loc *PlaneLocation) {
+	maxPoints, maxAge, toleranceMetres := p.historyLimits()
+	n := p.locationHistory.len()
+	if toleranceMetres > 0 && n >= 2 && redundant(p.locationHistory.at(n-2), p.locationHistory.at(n-1), loc, p.locationHistory.dropped, toleranceMetres) {
+		p.locationHistory.replaceLast(loc)
+		return
+	}
+	p.locationHistory.push(loc, maxPoints, maxAge)
+}
+
+// redundant tells us if mid adds nothing to the path from prev to next, that it and the positions we dropped between
+// prev and mid are all within tolerance of the line between them at the same altitude, and dropping it does not leave
+// too big a gap
+func redundant(prev, mid, next *PlaneLocation, dropped []*PlaneLocation, toleranceMetres float64) bool {
+	if mid.TrackFinished || prev.mlat != mid.mlat || prev.onGround != mid.onGround {
+		return false
+	}
+	if next.cprDecodedTs.Sub(prev.cprDecodedTs) > historyMaxGap {
+		return false
+	}
+	if altitudeChange(prev.altitude, mid.altitude) >= historyAltitudeChange || altitudeChange(mid.altitude, next.altitude) >= historyAltitudeChange {
+		return false
+	}
+	if crossTrackDistance(prev.latitude, prev.longitude, next.latitude, next.longitude, mid.latitude, mid.longitude) > toleranceMetres {
+		return false
+	}
+	// our line now stands in for every position we dropped along the way, not just mid
+	for _, d := range dropped {
+		if altitudeChange(prev.altitude, d.altitude) >= historyAltitudeChange {
+			return false
+		}
+		if crossTrackDistance(prev.latitude, prev.longitude, next.latitude, next.longitude, d.latitude, d.longitude) > toleranceMetres {
+			return false
+		}
+	}
+	return true
+}
+
+func altitudeChange(a, b int32) int32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// crossTrackDistance is how far (in metres) the point {lat, lon} is from the line between our two ends
+func crossTrackDistance(lat1, lon1, lat2, lon2, lat, lon float64) float64 {
+	// close enough to flat over the distances between positions
+	metresPerLon := metresPerDegree * math.Cos(lat1*math.Pi/180)
+	x2, y2 := normaliseLon(lon2-lon1)*metresPerLon, (lat2-lat1)*metresPerDegree
+	x, y := normaliseLon(lon-lon1)*metresPerLon, (lat-lat1)*metresPerDegree
+	lengthSquared := x2*x2 + y2*y2
+	if 0 == lengthSquared {
+		return math.Hypot(x, y)
+	}
+	along := (x*x2 + y*y2) / lengthSquared
+	if along < 0 {
+		along = 0
+	} else if along > 1 {
+		along = 1
+	}
+	return math.Hypot(x-along*x2, y-along*y2)
+}
+
+// SimplifyTrack thins out a track with Douglas-Peucker, keeping points that are more than toleranceMetres off the line
+// between their neighbours or more than altitudeTolerance (feet) off the climb or descent between them. It keeps
+// raising its tolerance until we have no more than maxPoints (<= 0 for no limit) points
+func SimplifyTrack(points []TrackPoint, toleranceMetres float64, altitudeTolerance int32, maxPoints int) []TrackPoint {
+	if len(points) <= 2 {
+		return points
+	}
+	for {
+		keep := make([]bool, len(points))
+		keep[0], keep[len(points)-1] = true, true
+		simplifyBetween(points, keep, 0, len(points)-1, toleranceMetres, float64(altitudeTolerance))
+		out := make([]TrackPoint, 0, len(points))
+		for i, k := range keep {
+			if k {
+				out = append(out, points[i])
+			}
+		}
+		if maxPoints <= 0 || len(out) <= maxPoints || toleranceMetres > 1e7 {
+			return out
+		}
+		toleranceMetres *= 2
+		altitudeTolerance *= 2
+	}
+}
+
+// simplifyBetween is a step of our Douglas-Peucker, it keeps the point between first and last that is furthest out of
+// tolerance and then looks either side of it
+func simplifyBetween(points []TrackPoint, keep []bool, first, last int, toleranceMetres, altitudeTolerance float64) {
+	if last-first < 2 {
+		return
+	}
+	a, b := points[first], points[last]
+	worst, worstIndex := 1.0, -1
+	for i := first + 1; i < last; i++ {
+		p := points[i]
+		if p.TrackFinished {
+			worst, worstIndex = math.Inf(1), i
+			break
+		}
+		off := crossTrackDistance(a.Lat, a.Lon, b.Lat, b.Lon, p.Lat, p.Lon) / toleranceMetres
+		if a.HasAltitude && b.HasAltitude && p.HasAltitude && altitudeTolerance > 0 {
+			// without times, we assume our points are evenly spaced
+			fraction := float64(i-first) / float64(last-first)
+			if span := b.At.Sub(a.At); span > 0 {
+				fraction = float64(p.At.Sub(a.At)) / float64(span)
+			}
+			expected := float64(a.Altitude) + fraction*float64(b.Altitude-a.Altitude)
+			off = math.Max(off, math.Abs(float64(p.Altitude)-expected)/altitudeTolerance)
+		}
+		if off > worst {
+			worst, worstIndex = off, i
+		}
+	}
+	if worstIndex < 0 {
+		return
+	}
+	keep[worstIndex] = true
+	simplifyBetween(points, keep, first, worstIndex, toleranceMetres, altitudeTolerance)
+	simplifyBetween(points, keep, worstIndex, last, toleranceMetres, altitudeTolerance)
+}
+
+// CompactTrack is where our plane has been, simplified down to no more than maxPoints points (<= 0 for no limit)
+func (p *Plane) CompactTrack(maxPoints int) []TrackPoint {
+	p.rwLock.RLock()
+	points := make([]TrackPoint, 0, p.locationHistory.len())
+	for i := 0; i < p.locationHistory.len(); i++ {
+		loc := p.locationHistory.at(i)
+		points = append(points, TrackPoint{
+			Lat:           loc.latitude,
+			Lon:           loc.longitude,
+			Altitude:      loc.altitude,
+			HasAltitude:   !loc.altitudeTs.IsZero(),
+			Heading:       loc.heading,
+			Velocity:      loc.velocity,
+			At:            loc.cprDecodedTs,
+			TrackFinished: loc.TrackFinished,
+		})
+	}
+	p.rwLock.RUnlock()
+	return SimplifyTrack(points, trackTolerance, historyAltitudeChange, maxPoints)
+}
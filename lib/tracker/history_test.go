@@ -0,0 +1,180 @@
+package tracker
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLocationHistory_Ring(t *testing.T) {
+	now := time.Now()
+	var h locationHistory
+	for i := 0; i < 50; i++ {
+		h.push(&PlaneLocation{altitude: int32(i), cprDecodedTs: now.Add(time.Duration(i) * time.Second)}, 20, 0)
+	}
+	if 20 != h.len() {
+		t.Fatalf("expected 20 positions, got %d", h.len())
+	}
+	if 20 != len(h.ring) {
+		t.Errorf("expected our ring to not grow past 20, got %d", len(h.ring))
+	}
+	for i, loc := range h.slice() {
+		if int32(30+i) != loc.altitude {
+			t.Errorf("expected position %d to be %d, got %d", i, 30+i, loc.altitude)
+		}
+	}
+	if 49 != h.last().altitude {
+		t.Errorf("expected our last position to be 49, got %d", h.last().altitude)
+	}
+
+	h.truncate(5)
+	if 5 != h.len() || 34 != h.last().altitude {
+		t.Errorf("expected truncate to keep our 5 oldest positions, got %d ending at %d", h.len(), h.last().altitude)
+	}
+	h.push(&PlaneLocation{altitude: 100, cprDecodedTs: now.Add(time.Minute)}, 20, 0)
+	if 6 != h.len() || 100 != h.last().altitude {
+		t.Errorf("expected to add after truncating, got %d ending at %d", h.len(), h.last().altitude)
+	}
+
+	h.reset()
+	if 0 != h.len() || nil != h.last() {
+		t.Errorf("expected reset to empty our history")
+	}
+}
+
+func TestLocationHistory_MaxAge(t *testing.T) {
+	now := time.Now()
+	var h locationHistory
+	for i := 0; i < 100; i++ {
+		h.push(&PlaneLocation{altitude: int32(i), cprDecodedTs: now.Add(time.Duration(i) * time.Second)}, 0, 30*time.Second)
+	}
+	if 31 != h.len() {
+		t.Fatalf("expected 31 positions in 30 seconds, got %d", h.len())
+	}
+	if 69 != h.at(0).altitude {
+		t.Errorf("expected our oldest position to be 69, got %d", h.at(0).altitude)
+	}
+}
+
+func TestPlane_HistorySimplification(t *testing.T) {
+	trk := NewTracker(WithLocationHistory(100, 0), WithHistorySimplification(50))
+	t.Cleanup(trk.Finish)
+	p := trk.GetPlane(0x7C0010)
+	now := time.Now()
+
+	// straight and level for 20 positions, a turn, then a climb
+	lat, lon := -31.95, 115.86
+	altitude := int32(10000)
+	var turnLat, turnLon float64
+	for i := 0; i < 40; i++ {
+		north, east := 200.0, 0.0
+		if i >= 20 {
+			north, east = 0, 200
+		}
+		if i >= 30 {
+			altitude += 500
+		}
+		lat, lon = offsetMetres(lat, lon, north, east)
+		if 19 == i {
+			turnLat, turnLon = lat, lon
+		}
+		at := now.Add(time.Duration(i) * time.Second)
+		p.rwLock.Lock()
+		p.location.altitude = altitude
+		p.location.altitudeTs = at
+		p.rwLock.Unlock()
+		_ = p.addLatLong(lat, lon, at)
+	}
+
+	history := p.LocationHistory()
+	if len(history) >= 20 {
+		t.Errorf("expected straight and level flight to be simplified, got %d positions", len(history))
+	}
+	turned, climbed := false, 0
+	for _, loc := range history {
+		turned = turned || distance(loc.latitude, loc.longitude, turnLat, turnLon) < 1
+		if loc.altitude > 10000 {
+			climbed++
+		}
+	}
+	if !turned {
+		t.Errorf("expected our turn to be kept")
+	}
+	if climbed < 9 {
+		t.Errorf("expected each step of our climb to be kept, got %d", climbed)
+	}
+}
+
+func TestPlane_HistorySimplificationSlowTurn(t *testing.T) {
+	trk := NewTracker(WithLocationHistory(100, 0), WithHistorySimplification(50))
+	t.Cleanup(trk.Finish)
+	p := trk.GetPlane(0x7C0011)
+	now := time.Now()
+
+	// a gentle half a degree a second turn at 120m/s, each step is well within tolerance of its neighbours but over a
+	// minute we end up ~500m off a straight line
+	lat, lon := -31.95, 115.86
+	heading := 0.0
+	var path [][2]float64
+	for i := 0; i < 60; i++ {
+		heading += 0.5
+		lat, lon = offsetMetres(lat, lon, 120*math.Cos(heading*math.Pi/180), 120*math.Sin(heading*math.Pi/180))
+		path = append(path, [2]float64{lat, lon})
+		at := now.Add(time.Duration(i) * time.Second)
+		p.rwLock.Lock()
+		p.location.altitude = 10000
+		p.location.altitudeTs = at
+		p.rwLock.Unlock()
+		_ = p.addLatLong(lat, lon, at)
+	}
+
+	history := p.LocationHistory()
+	if len(history) >= len(path) {
+		t.Errorf("expected our turn to be simplified, got %d positions", len(history))
+	}
+	for i, pos := range path {
+		closest := math.Inf(1)
+		for j := 1; j < len(history); j++ {
+			a, b := history[j-1], history[j]
+			closest = math.Min(closest, crossTrackDistance(a.latitude, a.longitude, b.latitude, b.longitude, pos[0], pos[1]))
+		}
+		if closest > 51 {
+			t.Errorf("expected position %d to be within tolerance of our history, it is %0.0fm off", i, closest)
+		}
+	}
+}
+
+func TestSimplifyTrack(t *testing.T) {
+	lat, lon := -31.95, 115.86
+	var points []TrackPoint
+	for i := 0; i < 1000; i++ {
+		// a zig zag, 300m either side of our line
+		east := 300.0
+		if i%2 == 1 {
+			east = -300
+		}
+		pLat, pLon := offsetMetres(lat, lon, float64(i)*1000, east)
+		points = append(points, TrackPoint{Lat: pLat, Lon: pLon, Altitude: 30000, HasAltitude: true})
+	}
+
+	if simplified := SimplifyTrack(points, 50, 300, 0); len(simplified) != len(points) {
+		t.Errorf("expected every point of our zig zag to be kept, got %d", len(simplified))
+	}
+	simplified := SimplifyTrack(points, 50, 300, 100)
+	if len(simplified) > 100 {
+		t.Errorf("expected no more than 100 points, got %d", len(simplified))
+	}
+	if simplified[0] != points[0] || simplified[len(simplified)-1] != points[len(points)-1] {
+		t.Errorf("expected our ends to be kept")
+	}
+
+	// a gap we could not join up is always kept
+	points[500].TrackFinished = true
+	found := false
+	for _, point := range SimplifyTrack(points, 50, 300, 10) {
+		found = found || point.TrackFinished
+	}
+	if !found {
+		t.Errorf("expected our finished track point to be kept")
+	}
+}
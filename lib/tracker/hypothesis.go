@@ -0,0 +1,148 @@
+package tracker
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	TrackCorrectedEventType = "track-corrected-event"
+
+	// hypothesisConfirmations is how many more positions an alternate track needs before we believe it over our current one
+	hypothesisConfirmations = 2
+	// hypothesisMaxAge is how long an alternate track lives without a position that fits it
+	hypothesisMaxAge = 30 * time.Second
+	// maxPlausibleSpeed is mach 2 in metres/second, which seems fast enough for a plane we know nothing about...
+	maxPlausibleSpeed = 686
+)
+
+type (
+	// trackHypothesis is an alternate track for a plane, started by a position that did not fit where we thought
+	// the plane was. Either our current track or this one is wrong, later positions decide which.
+	trackHypothesis struct {
+		locations []*PlaneLocation
+		// currentSupport is how many positions have fit our current track since this hypothesis started
+		currentSupport int
+	}
+
+	// TrackCorrectedEvent is sent when we decide a planes track was wrong and move it to the track that later positions fit
+	TrackCorrectedEvent struct {
+		p                  *Plane
+		fromLat, fromLon   float64
+		toLat, toLon       float64
+		discardedPositions int
+	}
+)
+
+// isPlausibleMove tells us if a plane going no faster than maxSpeed (metres/second) could get from our location to the
+// given position in time
+func (pl *PlaneLocation) isPlausibleMove(lat, lon float64, ts time.Time, maxSpeed float64) bool {
+	seconds := math.Abs(ts.Sub(pl.cprDecodedTs).Seconds())
+	return distance(pl.latitude, pl.longitude, lat, lon) <= (1+seconds)*maxSpeed
+}
+
+func (th *trackHypothesis) last() *PlaneLocation {
+	return th.locations[len(th.locations)-1]
+}
+
+// considerAlternateTrack is called with a position that does not fit our current track. It builds an alternate track
+// from these positions and switches to it once enough of them agree, must be called with our lock held
+func (p *Plane) considerAlternateTrack(lat, lon float64, ts time.Time, mlat bool, warn error) (*TrackCorrectedEvent, error) {
+	loc := &PlaneLocation{latitude: lat, longitude: lon, hasLatLon: true, mlat: mlat, cprDecodedTs: ts}
+	if nil != p.alternate && (ts.Sub(p.alternate.last().cprDecodedTs) > hypothesisMaxAge || !p.alternate.last().isPlausibleMove(lat, lon, ts, p.performance().MaxSpeed)) {
+		p.alternate = nil
+	}
+	if nil == p.alternate {
+		p.alternate = &trackHypothesis{locations: []*PlaneLocation{loc}}
+		return nil, warn
+	}
+	p.alternate.locations = append(p.alternate.locations, loc)
+	if p.alternate.currentSupport > 0 {
+		// our current track has had positions since this one started, two aircraft are taking turns with our ICAO
+		p.noteAnomaly(AnomalyDuplicateIcao, fmt.Sprintf("positions alternate between {%0.4f,%0.4f} and {%0.4f,%0.4f}", p.location.latitude, p.location.longitude, lat, lon), ts)
+	}
+	if len(p.alternate.locations) <= hypothesisConfirmations {
+		return nil, warn
+	}
+	return p.switchToAlternateTrack(), nil
+}
+
+// supportCurrentTrack is called with a position that fits our current track, must be called with our lock held
+func (p *Plane) supportCurrentTrack(ts time.Time) {
+	if nil == p.alternate {
+		return
+	}
+	p.alternate.currentSupport++
+	if p.alternate.currentSupport > hypothesisConfirmations || ts.Sub(p.alternate.last().cprDecodedTs) > hypothesisMaxAge {
+		p.alternate = nil
+	}
+}
+
+// switchToAlternateTrack throws away the positions that do not fit our alternate track and makes it our current one,
+// must be called with our lock held
+func (p *Plane) switchToAlternateTrack() *TrackCorrectedEvent {
+	alternate := p.alternate
+	p.alternate = nil
+	first := alternate.locations[0]
+	event := &TrackCorrectedEvent{
+		p:       p,
+		fromLat: p.location.latitude,
+		fromLon: p.location.longitude,
+		toLat:   alternate.last().latitude,
+		toLon:   alternate.last().longitude,
+	}
+
+	// walk back through our history until we find where our tracks agree
+	keep := p.locationHistory.len()
+	for keep > 0 && !p.locationHistory.at(keep-1).isPlausibleMove(first.latitude, first.longitude, first.cprDecodedTs, p.performance().MaxSpeed) {
+		keep--
+	}
+	event.discardedPositions = p.locationHistory.len() - keep
+	p.locationHistory.truncate(keep)
+
+	p.location.TrackFinished = false
+	if nil != p.track {
+		p.track.reset(first.latitude, first.longitude, first.cprDecodedTs)
+	}
+	for i, loc := range alternate.locations {
+		if nil != p.track && i > 0 {
+			p.track.addPosition(loc.latitude, loc.longitude, loc.cprDecodedTs)
+		}
+		p.setLatLong(loc.latitude, loc.longitude, loc.cprDecodedTs, loc.mlat)
+	}
+
+	p.tracker.log.Info().
+		Str("ICAO", p.icao).
+		Floats64("Stale Lat/Lon", []float64{event.fromLat, event.fromLon}).
+		Floats64("Corrected Lat/Lon", []float64{event.toLat, event.toLon}).
+		Int("Discarded Positions", event.discardedPositions).
+		Msg("Switched to alternate track")
+	return event
+}
+
+func (e *TrackCorrectedEvent) Type() string {
+	return TrackCorrectedEventType
+}
+func (e *TrackCorrectedEvent) String() string {
+	return fmt.Sprintf("%s track corrected from {%0.4f,%0.4f} to {%0.4f,%0.4f}, discarding %d positions",
+		e.p.IcaoIdentifierStr(), e.fromLat, e.fromLon, e.toLat, e.toLon, e.discardedPositions)
+}
+func (e *TrackCorrectedEvent) Plane() *Plane {
+	return e.p
+}
+
+// From is where we thought the plane was before we corrected its track
+func (e *TrackCorrectedEvent) From() (float64, float64) {
+	return e.fromLat, e.fromLon
+}
+
+// To is where the plane is on its corrected track
+func (e *TrackCorrectedEvent) To() (float64, float64) {
+	return e.toLat, e.toLon
+}
+
+// DiscardedPositions is how many positions were removed from the planes history as they were on the wrong track
+func (e *TrackCorrectedEvent) DiscardedPositions() int {
+	return e.discardedPositions
+}
@@ -0,0 +1,96 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+type eventCatcher struct {
+	events chan Event
+}
+
+func (ec *eventCatcher) OnEvent(e Event) {
+	ec.events <- e
+}
+func (ec *eventCatcher) Stop()                   {}
+func (ec *eventCatcher) HealthCheckName() string { return "Event Catcher" }
+func (ec *eventCatcher) HealthCheck() bool       { return true }
+
+func TestPlane_AlternateTrackWins(t *testing.T) {
+	trk := NewTracker()
+	catcher := &eventCatcher{events: make(chan Event, 10)}
+	trk.AddSink(catcher)
+	defer trk.Finish()
+	plane := trk.GetPlane(0x7C1234)
+	start := time.Now().Add(-time.Minute)
+
+	// a bad first position (think wrong CPR zone), followed by a plane flying along its real track
+	if err := plane.addLatLong(-34.95, 115.86, start); nil != err {
+		t.Fatal(err)
+	}
+	for i := 1; i <= hypothesisConfirmations; i++ {
+		lat, lon := offsetMetres(-31.95, 115.86, 200*float64(i), 0)
+		if err := plane.addLatLong(lat, lon, start.Add(time.Duration(i)*time.Second)); nil == err {
+			t.Fatalf("Position %d should not fit our (wrong) track yet", i)
+		}
+	}
+	if -34.95 != plane.Lat() {
+		t.Errorf("Our plane should not have moved yet")
+	}
+
+	lat, lon := offsetMetres(-31.95, 115.86, 200*float64(hypothesisConfirmations+1), 0)
+	if err := plane.addLatLong(lat, lon, start.Add(time.Duration(hypothesisConfirmations+1)*time.Second)); nil != err {
+		t.Fatalf("Expected our alternate track to win: %s", err)
+	}
+	if lat != plane.Lat() || lon != plane.Lon() {
+		t.Errorf("Expected our plane to be on its corrected track")
+	}
+	if history := plane.LocationHistory(); hypothesisConfirmations+1 != len(history) {
+		t.Errorf("Expected the stale position to be gone from our history, have %d positions", len(history))
+	}
+
+	select {
+	case e := <-catcher.events:
+		corrected, ok := e.(*TrackCorrectedEvent)
+		if !ok {
+			t.Fatalf("Expected a track corrected event, got %s", e.Type())
+		}
+		if fromLat, _ := corrected.From(); -34.95 != fromLat {
+			t.Errorf("Expected the correction to be from our stale position")
+		}
+		if 1 != corrected.DiscardedPositions() {
+			t.Errorf("Expected 1 discarded position, got %d", corrected.DiscardedPositions())
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected a track corrected event")
+	}
+}
+
+func TestPlane_CurrentTrackWins(t *testing.T) {
+	trk := NewTracker()
+	defer trk.Finish()
+	plane := trk.GetPlane(0x7C1234)
+	start := time.Now().Add(-time.Minute)
+
+	_ = plane.addLatLong(-31.95, 115.86, start)
+	// a single bad position starts an alternate track
+	if err := plane.addLatLong(-34.95, 115.86, start.Add(time.Second)); nil == err {
+		t.Fatalf("Expected a bad position to be discarded")
+	}
+	if nil == plane.alternate {
+		t.Fatalf("Expected an alternate track")
+	}
+	// our real track carries on
+	for i := 2; i <= hypothesisConfirmations+2; i++ {
+		lat, lon := offsetMetres(-31.95, 115.86, 200*float64(i), 0)
+		if err := plane.addLatLong(lat, lon, start.Add(time.Duration(i)*time.Second)); nil != err {
+			t.Fatalf("Position %d should fit our track: %s", i, err)
+		}
+	}
+	if nil != plane.alternate {
+		t.Errorf("Expected our alternate track to be dropped")
+	}
+	if 4 != len(plane.LocationHistory()) {
+		t.Errorf("Expected our history to be untouched, have %d positions", len(plane.LocationHistory()))
+	}
+}
@@ -1,6 +1,7 @@
 package tracker
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
@@ -27,6 +28,9 @@ type (
 	EventListener interface {
 		OnEvent(Event)
 	}
+	Starter interface {
+		Start()
+	}
 	Stopper interface {
 		Stop()
 	}
@@ -39,6 +43,11 @@ type (
 		Raw() []byte
 	}
 
+	// addressedFrame is a Frame that can tell us which plane it is for without being decoded
+	addressedFrame interface {
+		Address() (uint32, error)
+	}
+
 	// A Producer can listen for or generate Frames, it provides the output via a channel that the handler can then
 	// processes further.
 	// A Producer can send *LogEvent and  *FrameEvent events
@@ -55,10 +64,13 @@ type (
 		monitoring.HealthCheck
 	}
 
-	// Middleware has a chance to modify a frame before we send it to the plane Tracker
+	// Middleware has a chance to modify (or drop, by returning nil) a frame before we send it to the plane Tracker.
+	// It gets the whole FrameEvent, so it can see where the frame came from and annotate it with SetMeta.
+	// A Middleware that is also a Starter is started when it is added, and one that is a Stopper is stopped
+	// once the tracker has handled its last frame
 	Middleware interface {
 		fmt.Stringer
-		Handle(Frame) Frame
+		Handle(*FrameEvent) *FrameEvent
 	}
 )
 
@@ -80,31 +92,10 @@ func WithPrometheusCounters(currentPlanes prometheus.Gauge, decodedFrames promet
 	}
 }
 
-// Finish begins the ending of the tracking by closing our decoding queue
+// Finish stops our producers and waits until everything they gave us has been handed to our sinks.
+// It is safe to call more than once
 func (t *Tracker) Finish() {
-	if t.finishDone {
-		return
-	}
-	t.finishDone = true
-	log.Debug().Msg("Starting Finish()")
-	for _, p := range t.producers {
-		log.Debug().Str("producer", p.String()).Msg("Stopping Producer")
-		p.Stop()
-	}
-	log.Debug().Msg("Closing Decoding Queue")
-	close(t.decodingQueue)
-	t.planeList.Stop()
-	log.Debug().Msg("Stopping Events")
-	t.eventSync.Lock()
-	t.eventsOpen = false
-	t.eventSync.Unlock()
-	log.Debug().Msg("Closing Events Queue")
-
-	close(t.events)
-	for _, s := range t.sinks {
-		log.Debug().Str("sink", s.HealthCheckName()).Msg("Closing Sink")
-		s.Stop()
-	}
+	_ = t.shutdown()
 }
 
 func (t *Tracker) EventListener(eventSource EventMaker, waiter *sync.WaitGroup) {
@@ -112,7 +103,7 @@ func (t *Tracker) EventListener(eventSource EventMaker, waiter *sync.WaitGroup)
 		//fmt.Printf("Event For %s %s\n", eventSource, e)
 		switch e.(type) {
 		case *FrameEvent:
-			t.decodingQueue <- e.(*FrameEvent)
+			t.queueFrame(e.(*FrameEvent))
 			// send this event on!
 			//t.AddEvent(e)
 		}
@@ -142,18 +133,34 @@ func (t *Tracker) AddMiddleware(m Middleware) {
 		return
 	}
 	t.log.Debug().Str("name", m.String()).Msg("Adding middleware")
+	if s, ok := m.(Starter); ok {
+		s.Start()
+	}
 	t.middlewares = append(t.middlewares, m)
 
 	t.log.Debug().Msg("Just added a middleware")
 }
 
-// AddSink wires up a Sink in the tracker. Whenever an event happens it gets sent to each Sink
-func (t *Tracker) AddSink(s Sink) {
+// stopMiddlewares stops the middlewares that need it, once the last of our frames has been handled
+func (t *Tracker) stopMiddlewares() {
+	for _, m := range t.middlewares {
+		if s, ok := m.(Stopper); ok {
+			log.Debug().Str("middleware", m.String()).Msg("Stopping Middleware")
+			s.Stop()
+		}
+	}
+}
+
+// AddSink wires up a Sink in the tracker. Whenever an event happens it gets sent to each Sink.
+// Each Sink gets its events from its own queue, so a slow Sink does not hold up the others
+func (t *Tracker) AddSink(s Sink, opts ...SinkOption) {
 	t.log.Debug().Str("name", s.HealthCheckName()).Msg("Add Sink")
 	if nil == s {
 		return
 	}
-	t.sinks = append(t.sinks, s)
+	t.sinksLock.Lock()
+	t.sinks = append(t.sinks, t.newSinkQueue(s, opts...))
+	t.sinksLock.Unlock()
 	monitoring.AddHealthCheck(s)
 }
 
@@ -161,10 +168,6 @@ func (t *Tracker) AddSink(s Sink) {
 // use this if you are listening to remote sources
 func (t *Tracker) Stop() {
 	t.Finish()
-	t.producerWaiter.Wait()
-	t.decodingQueueWaiter.Wait()
-	t.eventsWaiter.Wait()
-	t.middlewareWaiter.Wait()
 }
 
 // StopOnCancel listens for SigInt etc and gracefully stops
@@ -186,62 +189,64 @@ func (t *Tracker) StopOnCancel() {
 	}
 }
 
-// Wait waits for all producers to stop producing input and then returns
+// Wait waits for all producers to stop producing input and then returns once everything has been handled
 // use this method if you are processing a file
 func (t *Tracker) Wait() {
-	t.producerWaiter.Wait()
-	log.Debug().Msg("Producers finished")
-	time.Sleep(time.Millisecond * 50)
-	t.Finish()
-	log.Debug().Msg("Finish() done")
-	t.decodingQueueWaiter.Wait()
-	log.Debug().Msg("Decoding waiter done")
-	t.eventsWaiter.Wait()
-	log.Debug().Msg("events waiter done")
+	_ = t.Run(context.Background())
 }
 
-func (t *Tracker) decodeQueue() {
-	for f := range t.decodingQueue {
-		if nil == f {
-			continue
-		}
-		if nil != t.stats.decodedFrames {
-			t.stats.decodedFrames.Inc()
-		}
-		frame := f.Frame()
-		err := frame.Decode()
-		if nil != err {
-			if mode_s.ErrNoOp != err {
-				// the decode operation failed to produce valid output, and we tell someone about it
-				t.log.Error().Err(err).Str("Tag", f.Source().Tag).Send()
-			}
+// decodeQueue decodes and processes our frames, in the order they arrived
+func (t *Tracker) decodeQueue(queue chan *FrameEvent) {
+	for f := range queue {
+		t.frameDequeued()
+		if err := f.Frame().Decode(); nil != err {
+			t.decodeFailed(f, err)
 			continue
 		}
-
+		t.checkDistantReceivers(f)
 		for _, m := range t.middlewares {
-			frame = m.Handle(frame)
-			if nil == frame {
+			f = m.Handle(f)
+			if nil == f {
 				break
 			}
 		}
-		if nil == frame || frame.Icao() == 0 {
+		if nil == f || nil == f.Frame() || f.Frame().Icao() == 0 {
 			// invalid frame || unable to determine planes ICAO
 			continue
 		}
+		frame := f.Frame()
 		plane := t.GetPlane(frame.Icao())
+		positionBefore := plane.LocationUpdatedAt()
+		refLat, refLon, estimated := t.reference(f.Source())
+		heardBy := t.receiverRange(f.Source(), refLat, refLon)
+		// a local CPR decode against a reference that is not where the receiver is, puts the plane somewhere else
+		decodeLat, decodeLon := refLat, refLon
+		if estimated {
+			decodeLat, decodeLon = nil, nil
+		}
 
 		switch frame.(type) {
 		case *beast.Frame:
 			b := frame.(*beast.Frame)
-			plane.HandleModeSFrame(b.AvrFrame(), f.Source().RefLat, f.Source().RefLon)
+			plane.handleModeSFrame(b.AvrFrame(), decodeLat, decodeLon, heardBy)
 			plane.setSignalLevel(b.SignalRssi())
 		case *mode_s.Frame:
-			plane.HandleModeSFrame(frame.(*mode_s.Frame), f.Source().RefLat, f.Source().RefLon)
+			m := frame.(*mode_s.Frame)
+			plane.handleModeSFrame(m, decodeLat, decodeLon, heardBy)
+			if m.HasSignalLevel() {
+				plane.setSignalLevel(m.SignalRssi())
+			}
 		case *sbs1.Frame:
-			plane.HandleSbs1Frame(frame.(*sbs1.Frame))
+			plane.handleSbs1Frame(frame.(*sbs1.Frame), heardBy)
 		default:
 			t.log.Error().Str("Tag", f.Source().Tag).Msg("unknown frame type, cannot track")
 		}
+		t.estimateReceiver(f.Source(), frame, plane, positionBefore)
+		t.learnRange(f.Source(), refLat, refLon, plane, positionBefore)
+		t.checkSignalLevel(refLat, refLon, frame, plane, positionBefore)
+		if nil != t.coverage {
+			t.coverage.record(f.Source(), refLat, refLon, frame, plane, positionBefore)
+		}
 	}
 	t.decodingQueueWaiter.Done()
 }
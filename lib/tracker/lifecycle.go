@@ -0,0 +1,312 @@
+package tracker
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	TakeoffEventType           = "takeoff-event"
+	LandingEventType           = "landing-event"
+	SquawkChangedEventType     = "squawk-changed-event"
+	EmergencyDeclaredEventType = "emergency-declared-event"
+	EmergencyClearedEventType  = "emergency-cleared-event"
+	CallsignChangedEventType   = "callsign-changed-event"
+	SignalLostEventType        = "signal-lost-event"
+	SignalRegainedEventType    = "signal-regained-event"
+
+	// takeoffMinSpeed (knots) is the slowest we expect a plane to be going when it leaves the ground
+	takeoffMinSpeed = 50
+	// landingMaxSpeed (knots) is the fastest we expect a plane to be going when it touches down
+	landingMaxSpeed = 200
+	// groundMaxAltitude (feet) is above the highest airports, a plane changing ground state above this is not landing or taking off
+	groundMaxAltitude = 15000
+	// defaultSignalLostAfter is how long we go without hearing from a plane before we say we have lost it
+	defaultSignalLostAfter = time.Minute
+)
+
+var (
+	// LifecycleEventTypes are all the events we send when something happens to a plane
+	LifecycleEventTypes = []string{
+		TakeoffEventType,
+		LandingEventType,
+		SquawkChangedEventType,
+		EmergencyDeclaredEventType,
+		EmergencyClearedEventType,
+		CallsignChangedEventType,
+		SignalLostEventType,
+		SignalRegainedEventType,
+		AnomalyDetectedEventType,
+	}
+
+	emergencySquawks = map[uint32]string{
+		7500: "Unlawful interference (squawk 7500)",
+		7600: "Radio failure (squawk 7600)",
+		7700: "General emergency (squawk 7700)",
+	}
+)
+
+type (
+	// LifecycleEvent is something that happened to a plane, at a given time
+	LifecycleEvent interface {
+		Event
+		Plane() *Plane
+		At() time.Time
+	}
+
+	lifecycleEvent struct {
+		p  *Plane
+		at time.Time
+	}
+
+	// TakeoffEvent is sent when a plane leaves the ground
+	TakeoffEvent struct {
+		lifecycleEvent
+	}
+
+	// LandingEvent is sent when a plane touches down
+	LandingEvent struct {
+		lifecycleEvent
+	}
+
+	// SquawkChangedEvent is sent when a plane is given a new squawk code
+	SquawkChangedEvent struct {
+		lifecycleEvent
+		from, to uint32
+	}
+
+	// EmergencyEvent is sent when a plane declares an emergency, or the emergency is over
+	EmergencyEvent struct {
+		lifecycleEvent
+		declared  bool
+		emergency string
+	}
+
+	// CallsignChangedEvent is sent when a plane starts using a different callsign
+	CallsignChangedEvent struct {
+		lifecycleEvent
+		from, to string
+	}
+
+	// SignalEvent is sent when we stop hearing from a plane, and when we hear from it again
+	SignalEvent struct {
+		lifecycleEvent
+		lost      bool
+		silentFor time.Duration
+	}
+)
+
+// WithSignalLostAfter sets how long we go without hearing from a plane before we send a SignalLostEventType event
+func WithSignalLostAfter(after time.Duration) Option {
+	return func(t *Tracker) {
+		t.signalLostAfter = after
+	}
+}
+
+func (le lifecycleEvent) Plane() *Plane {
+	return le.p
+}
+func (le lifecycleEvent) At() time.Time {
+	return le.at
+}
+
+func (e *TakeoffEvent) Type() string {
+	return TakeoffEventType
+}
+func (e *TakeoffEvent) String() string {
+	return fmt.Sprintf("%s took off", e.p.IcaoIdentifierStr())
+}
+
+func (e *LandingEvent) Type() string {
+	return LandingEventType
+}
+func (e *LandingEvent) String() string {
+	return fmt.Sprintf("%s landed", e.p.IcaoIdentifierStr())
+}
+
+func (e *SquawkChangedEvent) Type() string {
+	return SquawkChangedEventType
+}
+func (e *SquawkChangedEvent) String() string {
+	return fmt.Sprintf("%s squawk changed from %04d to %04d", e.p.IcaoIdentifierStr(), e.from, e.to)
+}
+func (e *SquawkChangedEvent) From() uint32 {
+	return e.from
+}
+func (e *SquawkChangedEvent) To() uint32 {
+	return e.to
+}
+
+func (e *EmergencyEvent) Type() string {
+	if e.declared {
+		return EmergencyDeclaredEventType
+	}
+	return EmergencyClearedEventType
+}
+func (e *EmergencyEvent) String() string {
+	if e.declared {
+		return fmt.Sprintf("%s declared an emergency: %s", e.p.IcaoIdentifierStr(), e.emergency)
+	}
+	return fmt.Sprintf("%s cleared its emergency: %s", e.p.IcaoIdentifierStr(), e.emergency)
+}
+
+// Declared is true when the emergency has started, false when it is over
+func (e *EmergencyEvent) Declared() bool {
+	return e.declared
+}
+
+// Emergency describes the emergency
+func (e *EmergencyEvent) Emergency() string {
+	return e.emergency
+}
+
+func (e *CallsignChangedEvent) Type() string {
+	return CallsignChangedEventType
+}
+func (e *CallsignChangedEvent) String() string {
+	return fmt.Sprintf("%s callsign changed from '%s' to '%s'", e.p.IcaoIdentifierStr(), e.from, e.to)
+}
+func (e *CallsignChangedEvent) From() string {
+	return e.from
+}
+func (e *CallsignChangedEvent) To() string {
+	return e.to
+}
+
+func (e *SignalEvent) Type() string {
+	if e.lost {
+		return SignalLostEventType
+	}
+	return SignalRegainedEventType
+}
+func (e *SignalEvent) String() string {
+	if e.lost {
+		return fmt.Sprintf("%s signal lost", e.p.IcaoIdentifierStr())
+	}
+	return fmt.Sprintf("%s signal regained after %s", e.p.IcaoIdentifierStr(), e.silentFor)
+}
+
+// Lost is true when we stopped hearing from the plane, false when we hear from it again
+func (e *SignalEvent) Lost() bool {
+	return e.lost
+}
+
+// SilentFor is how long we went without hearing from the plane
+func (e *SignalEvent) SilentFor() time.Duration {
+	return e.silentFor
+}
+
+// queueEvent holds on to an event until we have finished with this frame, must be called with our lock held
+func (p *Plane) queueEvent(e Event) {
+	p.pendingEvents = append(p.pendingEvents, e)
+}
+
+// sendEvents sends all the events that happened while handling our frame
+func (p *Plane) sendEvents() {
+	p.rwLock.Lock()
+	events := p.pendingEvents
+	p.pendingEvents = nil
+	p.rwLock.Unlock()
+	if nil == p.tracker {
+		return
+	}
+	for _, e := range events {
+		p.tracker.AddEvent(e)
+	}
+}
+
+// checkGroundTransition decides if our change in ground status was a takeoff or landing, must be called with our lock held
+func (p *Plane) checkGroundTransition(onGround bool, ts time.Time) {
+	if !p.location.altitudeTs.IsZero() && p.location.altitude > groundMaxAltitude {
+		return
+	}
+	event := lifecycleEvent{p: p, at: ts}
+	if onGround {
+		if !p.location.hasVelocity || p.location.velocity <= landingMaxSpeed {
+			p.queueEvent(&LandingEvent{lifecycleEvent: event})
+			p.flight.landed = true
+		}
+		return
+	}
+	if !p.location.hasVelocity || p.location.velocity >= takeoffMinSpeed {
+		if p.flight.landed {
+			p.startFlight(ts, true)
+		}
+		p.queueEvent(&TakeoffEvent{lifecycleEvent: event})
+	}
+}
+
+// currentEmergency is the emergency our plane is telling us about, must be called with our lock held
+func (p *Plane) currentEmergency() string {
+	if "" != p.statusEmergency {
+		return p.statusEmergency
+	}
+	return p.squawkEmergency
+}
+
+// checkEmergency sends an event if our plane has started or stopped telling us about an emergency,
+// must be called with our lock held. The squawk and the status report word the same emergency
+// differently, so only the change between having one and not having one counts.
+func (p *Plane) checkEmergency(before string, ts time.Time) {
+	after := p.currentEmergency()
+	switch {
+	case ("" == before) == ("" == after):
+	case "" == after:
+		p.queueEvent(&EmergencyEvent{lifecycleEvent: lifecycleEvent{p: p, at: ts}, emergency: before})
+	default:
+		p.queueEvent(&EmergencyEvent{lifecycleEvent: lifecycleEvent{p: p, at: ts}, declared: true, emergency: after})
+	}
+}
+
+// setEmergencyStatus records the emergency status a plane is broadcasting
+func (p *Plane) setEmergencyStatus(alert bool, emergency string, ts time.Time) {
+	p.rwLock.Lock()
+	defer p.rwLock.Unlock()
+	before := p.currentEmergency()
+	p.statusEmergency = ""
+	if alert {
+		p.statusEmergency = strings.TrimSpace(emergency)
+	}
+	p.checkEmergency(before, ts)
+}
+
+// markSignalLost checks if we have gone too long without hearing from our plane
+func (p *Plane) markSignalLost(now time.Time, after time.Duration) *SignalEvent {
+	p.rwLock.Lock()
+	defer p.rwLock.Unlock()
+	if p.signalLost || p.lastSeen.IsZero() || now.Sub(p.lastSeen) < after {
+		return nil
+	}
+	p.signalLost = true
+	return &SignalEvent{lifecycleEvent: lifecycleEvent{p: p, at: now}, lost: true, silentFor: now.Sub(p.lastSeen)}
+}
+
+// startSignalWatch looks for planes we have stopped hearing from
+func (t *Tracker) startSignalWatch() {
+	t.signalWatchDone = make(chan struct{})
+	if t.signalLostAfter <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(t.pruneTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.signalWatchDone:
+				return
+			case now := <-ticker.C:
+				lost := make([]Event, 0)
+				t.EachPlane(func(p *Plane) bool {
+					if e := p.markSignalLost(now, t.signalLostAfter); nil != e {
+						lost = append(lost, e)
+					}
+					return true
+				})
+				for _, e := range lost {
+					t.AddEvent(e)
+				}
+			}
+		}
+	}()
+}
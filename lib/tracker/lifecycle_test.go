@@ -0,0 +1,146 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+// eventTypes sends our planes pending events and gives us their types
+func eventTypes(t *testing.T, p *Plane, catcher *eventCatcher) []string {
+	p.sendEvents()
+	types := make([]string, 0)
+	for {
+		select {
+		case e := <-catcher.events:
+			types = append(types, e.Type())
+		case <-time.After(50 * time.Millisecond):
+			return types
+		}
+	}
+}
+
+func expectEvents(t *testing.T, what string, got []string, expected ...string) {
+	t.Helper()
+	if len(expected) != len(got) {
+		t.Errorf("%s: expected events %v, got %v", what, expected, got)
+		return
+	}
+	for i := range expected {
+		if expected[i] != got[i] {
+			t.Errorf("%s: expected events %v, got %v", what, expected, got)
+			return
+		}
+	}
+}
+
+// newEventTracker gives us a tracker, set up with opts, and a sink that catches the events of the given types
+func newEventTracker(t *testing.T, eventTypes []string, opts ...Option) (*Tracker, *eventCatcher) {
+	trk := NewTracker(opts...)
+	catcher := &eventCatcher{events: make(chan Event, 10)}
+	trk.AddSink(catcher, WithSinkEventTypes(eventTypes...))
+	t.Cleanup(trk.Finish)
+	return trk, catcher
+}
+
+func TestPlane_TakeoffAndLanding(t *testing.T) {
+	trk, catcher := newEventTracker(t, LifecycleEventTypes)
+	p := trk.GetPlane(0x7C1234)
+	now := time.Now()
+
+	p.setGroundStatus(true, now)
+	expectEvents(t, "first ground status", eventTypes(t, p, catcher))
+
+	p.setAltitude(1000, "feet", now)
+	p.setVelocity(150, now)
+	p.setGroundStatus(false, now)
+	expectEvents(t, "takeoff", eventTypes(t, p, catcher), TakeoffEventType)
+
+	p.setVelocity(130, now)
+	p.setGroundStatus(true, now)
+	expectEvents(t, "landing", eventTypes(t, p, catcher), LandingEventType)
+
+	// nobody lands at 35,000 feet
+	cruise := now.Add(time.Hour)
+	p.setAltitude(35000, "feet", cruise)
+	p.setGroundStatus(false, cruise)
+	p.setGroundStatus(true, cruise)
+	expectEvents(t, "at altitude", eventTypes(t, p, catcher))
+
+	// or takes off while taxiing
+	taxi := cruise.Add(time.Hour)
+	p.setAltitude(100, "feet", taxi)
+	p.setVelocity(15, taxi)
+	p.setGroundStatus(false, taxi)
+	expectEvents(t, "taxiing", eventTypes(t, p, catcher))
+}
+
+func TestPlane_SquawkAndEmergency(t *testing.T) {
+	trk, catcher := newEventTracker(t, LifecycleEventTypes)
+	p := trk.GetPlane(0x7C1234)
+	now := time.Now()
+
+	p.setSquawkIdentity(3000, now)
+	expectEvents(t, "first squawk", eventTypes(t, p, catcher))
+
+	p.setSquawkIdentity(7700, now)
+	expectEvents(t, "squawk 7700", eventTypes(t, p, catcher), SquawkChangedEventType, EmergencyDeclaredEventType)
+
+	// still the same emergency
+	p.setEmergencyStatus(true, "General emergency", now)
+	p.setEmergencyStatus(false, "", now)
+	expectEvents(t, "emergency status", eventTypes(t, p, catcher))
+
+	// the status alone is enough to declare one
+	p.setSquawkIdentity(3000, now)
+	expectEvents(t, "squawk back", eventTypes(t, p, catcher), SquawkChangedEventType, EmergencyClearedEventType)
+	p.setEmergencyStatus(true, "Minimum fuel", now)
+	expectEvents(t, "minimum fuel", eventTypes(t, p, catcher), EmergencyDeclaredEventType)
+	p.setSquawkIdentity(7700, now)
+	expectEvents(t, "squawk during status", eventTypes(t, p, catcher), SquawkChangedEventType)
+	p.setEmergencyStatus(false, "", now)
+	expectEvents(t, "status over", eventTypes(t, p, catcher))
+
+	p.setSquawkIdentity(3000, now)
+	expectEvents(t, "emergency over", eventTypes(t, p, catcher), SquawkChangedEventType, EmergencyClearedEventType)
+}
+
+func TestPlane_CallsignChanged(t *testing.T) {
+	trk, catcher := newEventTracker(t, LifecycleEventTypes)
+	p := trk.GetPlane(0x7C1234)
+
+	p.setFlightNumber("QFA123  ")
+	p.setFlightNumber("QFA123")
+	p.setFlightNumber("QFA124")
+	p.setFlightNumber("")
+	expectEvents(t, "callsigns", eventTypes(t, p, catcher), CallsignChangedEventType)
+}
+
+func TestPlane_SignalLostAndRegained(t *testing.T) {
+	trk, catcher := newEventTracker(t, LifecycleEventTypes)
+	p := trk.GetPlane(0x7C1234)
+	start := time.Now()
+	p.setLastSeen(start)
+
+	if nil != p.markSignalLost(start.Add(30*time.Second), time.Minute) {
+		t.Errorf("We have not lost our plane yet")
+	}
+	lost := p.markSignalLost(start.Add(2*time.Minute), time.Minute)
+	if nil == lost || SignalLostEventType != lost.Type() {
+		t.Fatalf("Expected to lose our plane")
+	}
+	if nil != p.markSignalLost(start.Add(3*time.Minute), time.Minute) {
+		t.Errorf("We should only lose our plane once")
+	}
+
+	p.setLastSeen(start.Add(3 * time.Minute))
+	p.sendEvents()
+	select {
+	case e := <-catcher.events:
+		regained, ok := e.(*SignalEvent)
+		if !ok || regained.Lost() || 3*time.Minute != regained.SilentFor() {
+			t.Errorf("Expected to regain our plane after 3 minutes, got %s", e)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected a signal regained event")
+	}
+}
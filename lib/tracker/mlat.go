@@ -0,0 +1,43 @@
+package tracker
+
+import (
+	"errors"
+	"time"
+)
+
+// mlatAdsbPreference is how long a position the plane reported itself is preferred over one we worked out with MLAT
+const mlatAdsbPreference = 30 * time.Second
+
+var ErrMlatHasAdsb = errors.New("plane is reporting its own position, ignoring MLAT position")
+
+// AddMlatLocation gives a plane a position worked out by multilateration. Planes that are telling us where they are
+// keep their own positions, MLAT only fills in for the ones that do not
+func (t *Tracker) AddMlatLocation(icao uint32, lat, lon float64, ts time.Time) error {
+	if 0 == icao {
+		return errors.New("cannot add an MLAT position without an ICAO")
+	}
+	return t.GetPlane(icao).addMlatLatLong(lat, lon, ts)
+}
+
+// addMlatLatLong adds a position we worked out with MLAT, unless the plane has recently told us where it is
+func (p *Plane) addMlatLatLong(lat, lon float64, ts time.Time) error {
+	if err := p.addPosition(lat, lon, ts, true, nil); nil != err {
+		return err
+	}
+	p.tracker.AddEvent(NewPlaneLocationEvent(p))
+	p.sendEvents()
+	return nil
+}
+
+// hasReportedPosition tells us if the plane told us where it was recently enough, before ts, for us to prefer that
+// over MLAT. Must be called with our lock held
+func (p *Plane) hasReportedPosition(ts time.Time) bool {
+	return p.location.hasLatLon && !p.location.mlat && ts.Sub(p.location.cprDecodedTs) < mlatAdsbPreference
+}
+
+// IsMlatLocation tells us if the planes current position was worked out by multilateration
+func (p *Plane) IsMlatLocation() bool {
+	p.rwLock.RLock()
+	defer p.rwLock.RUnlock()
+	return p.location.mlat
+}
@@ -0,0 +1,40 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTracker_AddMlatLocation(t *testing.T) {
+	trk := NewTracker()
+	t.Cleanup(trk.Finish)
+	now := time.Now()
+
+	if err := trk.AddMlatLocation(0x7C0003, -31.95, 115.86, now); nil != err {
+		t.Fatalf("expected our MLAT position to be taken, got %s", err)
+	}
+	p := trk.GetPlane(0x7C0003)
+	if !p.HasLocation() || !p.IsMlatLocation() {
+		t.Fatalf("expected our plane to have an MLAT location")
+	}
+	if -31.95 != p.Lat() || 115.86 != p.Lon() {
+		t.Errorf("expected our plane at {-31.95, 115.86}, got {%0.4f, %0.4f}", p.Lat(), p.Lon())
+	}
+
+	// once a plane tells us where it is, we believe it over MLAT
+	if err := p.addLatLong(-31.951, 115.861, now.Add(time.Second)); nil != err {
+		t.Fatalf("expected our reported position to be taken, got %s", err)
+	}
+	if p.IsMlatLocation() {
+		t.Errorf("expected a reported position to not be marked as MLAT")
+	}
+	if err := trk.AddMlatLocation(0x7C0003, -31.952, 115.862, now.Add(2*time.Second)); ErrMlatHasAdsb != err {
+		t.Errorf("expected MLAT to give way to a reported position, got %v", err)
+	}
+	if err := trk.AddMlatLocation(0x7C0003, -31.99, 115.9, now.Add(time.Minute)); nil != err {
+		t.Errorf("expected MLAT to take over once the reported positions stop, got %s", err)
+	}
+	if !p.IsMlatLocation() {
+		t.Errorf("expected our plane to have an MLAT location again")
+	}
+}
@@ -121,6 +121,74 @@ func TestBeastAvrTimestampDecode112BitModeS(t *testing.T) {
 	if "MLAT" != frame.mode {
 		t.Errorf("Failed to identify frame as Beast AVR")
 	}
+	if 0x016CE3671AA8 != frame.beastTicks {
+		t.Errorf("Failed to decode the 12 digit timestamp, got %X", frame.beastTicks)
+	}
+	if "8D00199A8BB80030A8000628F400" != frame.raw {
+		t.Errorf("Incorrect frame after the timestamp, got %s", frame.raw)
+	}
+	if frame.HasSignalLevel() || frame.IsMlat() {
+		t.Errorf("Did not expect a signal level or mlat marker")
+	}
+}
+
+func TestAvrSignalLevelDecode(t *testing.T) {
+	for _, prefix := range []string{"<", "%"} {
+		raw := prefix + "016CE3671AA8C88D00199A8BB80030A8000628F400;"
+		frame, err := DecodeString(raw, time.Now())
+		if nil != err || nil == frame {
+			t.Errorf("Failed to decode frame %s: %s", raw, err)
+			continue
+		}
+		if 0x016CE3671AA8 != frame.beastTicks {
+			t.Errorf("Failed to decode the timestamp for %s, got %X", raw, frame.beastTicks)
+		}
+		if 0x00199A != frame.Icao() {
+			t.Errorf("Failed to decode the frame after the signal level for %s, got %06X", raw, frame.Icao())
+		}
+		if !frame.HasSignalLevel() {
+			t.Errorf("Expected a signal level for %s", raw)
+		}
+		if "23.0" != fmt.Sprintf("%0.1f", frame.SignalRssi()) {
+			t.Errorf("Incorrect signal level for %s, got %0.1f", raw, frame.SignalRssi())
+		}
+	}
+}
+
+func TestAvrMlatMarker(t *testing.T) {
+	raw := "@FF004D4C41548D00199A8BB80030A8000628F400;"
+	frame, err := DecodeString(raw, time.Now())
+	if nil != err || nil == frame {
+		t.Fatalf("Failed to decode frame: %s", err)
+	}
+	if !frame.IsMlat() {
+		t.Errorf("Expected the MLAT marker to be detected")
+	}
+	if 0 != frame.BeastTicksNs() {
+		t.Errorf("The MLAT marker is not a timestamp, got %s", frame.BeastTicksNs())
+	}
+	if _, ok := AvrTimeStamp(raw); ok {
+		t.Errorf("Did not expect a timestamp from the MLAT marker")
+	}
+}
+
+func TestAvrTimeStamp(t *testing.T) {
+	tests := []struct {
+		line string
+		want time.Duration
+		ok   bool
+	}{
+		{line: "@016CE3671AA88D00199A8BB80030A8000628F400;", want: time.Duration(0x016CE3671AA8 * 500), ok: true},
+		{line: "<016CE3671AA8C88D00199A8BB80030A8000628F400;", want: time.Duration(0x016CE3671AA8 * 500), ok: true},
+		{line: "*8D7C12C35811D278E63B2EBB12CC;", ok: false},
+		{line: "@000000000000", ok: false},
+	}
+	for _, tt := range tests {
+		got, ok := AvrTimeStamp(tt.line)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("AvrTimeStamp(%s) = %s, %t; want %s, %t", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
 }
 
 func Test_calcSurfaceSpeed(t *testing.T) {
@@ -3,6 +3,7 @@ package mode_s
 import (
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"sync"
@@ -15,6 +16,14 @@ const (
 	modesShortMsgBytes = 7
 	modesLongMsgBits   = modesLongMsgBytes * 8
 	modesShortMsgBits  = modesShortMsgBytes * 8
+
+	// avrTimeStampLen is the number of hex digits in a timestamped AVR frames 48bit timestamp
+	avrTimeStampLen = 12
+	// avrSignalLevelLen is the number of hex digits for the signal level in a < or % AVR frame
+	avrSignalLevelLen = 2
+
+	// magicTimestampMLAT is the timestamp MLAT servers use for frames they synthesise ("\xFF\x00MLAT")
+	magicTimestampMLAT = 0xFF004D4C4154
 )
 
 type (
@@ -87,6 +96,35 @@ func (f *Frame) Decode() error {
 	return err
 }
 
+// Address works out which aircraft our frame is for, without decoding the rest of it
+func (f *Frame) Address() (uint32, error) {
+	if nil == f {
+		return 0, nil
+	}
+	f.decodeLock.Lock()
+	defer f.decodeLock.Unlock()
+	if f.hasDecoded {
+		return f.icao, nil
+	}
+	if !f.fromBytes {
+		if err := f.parseIntoRaw(); nil != err {
+			return 0, err
+		}
+		if f.isNoOp() {
+			return 0, ErrNoOp
+		}
+	}
+	if 0 == len(f.message) {
+		return 0, errors.New("cannot find the address of an empty frame")
+	}
+	f.decodeDownLinkFormat()
+	if int(f.getMessageLengthBytes()) != len(f.message) {
+		return 0, fmt.Errorf("cannot parse AVR Frame (DF%d) (%X). Incorrect length %d != %d", f.downLinkFormat, f.message, f.getMessageLengthBytes(), len(f.message))
+	}
+	f.decodeICAO()
+	return f.icao, nil
+}
+
 func (f *Frame) parse() error {
 	var err error
 
@@ -175,24 +213,39 @@ func (f *Frame) parseIntoRaw() error {
 	}
 
 	// determine what type of frame we are dealing with
-	if encodedFrame[0] == '@' {
-		// Beast Timestamp+AVR format
+	frameStart := 0
+	switch encodedFrame[0] {
+	case '@':
+		// Beast Timestamp+AVR format, @ + 12 hex digit timestamp + frame
 		f.mode = "MLAT"
-	} else {
+		frameStart = 1 + avrTimeStampLen
+	case '%', '<':
+		// Timestamp+Signal Level+AVR format, < + 12 hex digit timestamp + 2 hex digit signal level + frame
+		f.mode = "MLAT"
+		frameStart = 1 + avrTimeStampLen + avrSignalLevelLen
+	case '*':
+		f.mode = "NORMAL"
+		frameStart = 1
+	default:
 		f.mode = "NORMAL"
 	}
 
+	if len(encodedFrame) <= frameStart {
+		return fmt.Errorf("frame (%s) too short to be a Mode S frame", f.full)
+	}
+
 	// ensure we have a timestamp
-	frameStart := 0
 	if "MLAT" == f.mode {
-		frameStart = 13
 		// try and use the provided timestamp
-		f.beastTimeStamp = encodedFrame[1:12]
+		f.beastTimeStamp = encodedFrame[1 : 1+avrTimeStampLen]
 		if err := f.parseBeastTimeStamp(); nil != err {
 			return err
 		}
-	} else if "*" == encodedFrame[0:1] {
-		frameStart = 1
+		if frameStart > 1+avrTimeStampLen {
+			if err := f.parseSignalLevel(encodedFrame[1+avrTimeStampLen : frameStart]); nil != err {
+				return err
+			}
+		}
 	}
 	f.raw = encodedFrame[frameStart:]
 
@@ -219,7 +272,7 @@ func (f *Frame) parseRadarcapeTimeStamp() {
 }
 
 func (f *Frame) parseBeastTimeStamp() error {
-	if "" == f.beastTimeStamp || "00000000000" == f.beastTimeStamp {
+	if "" == f.beastTimeStamp || "000000000000" == f.beastTimeStamp {
 		return nil
 	}
 	// MLAT timestamps from Beast AVR are dependent on when the device started ( 500ns intervals / 12mhz)
@@ -233,10 +286,65 @@ func (f *Frame) parseBeastTimeStamp() error {
 	if err != nil {
 		return fmt.Errorf("failed to decode beast avr timestamp: %s", err)
 	}
+	if magicTimestampMLAT == f.beastTicks {
+		// not a real timestamp, this frame was synthesised by an MLAT server
+		f.mlatResult = true
+		f.beastTicks = 0
+		return nil
+	}
 	f.beastTicksNs = f.beastTicks * 500
 	return nil
 }
 
+func (f *Frame) parseSignalLevel(level string) error {
+	signal, err := strconv.ParseUint(level, 16, 8)
+	if nil != err {
+		return fmt.Errorf("failed to decode avr signal level: %s", err)
+	}
+	f.signalLevel = byte(signal)
+	// a zero signal level means the receiver did not give us one
+	f.hasSignalLevel = 0 != signal
+	return nil
+}
+
+// AvrTimeStamp gets the MLAT timestamp from a timestamped AVR line (@, % or < prefixed) without decoding the frame.
+// frames without a timestamp, or with the MLAT marker instead of a timestamp, return false
+func AvrTimeStamp(line string) (time.Duration, bool) {
+	if len(line) <= 1+avrTimeStampLen {
+		return 0, false
+	}
+	switch line[0] {
+	case '@', '%', '<':
+	default:
+		return 0, false
+	}
+	ticks, err := strconv.ParseUint(line[1:1+avrTimeStampLen], 16, 64)
+	if nil != err || 0 == ticks || magicTimestampMLAT == ticks {
+		return 0, false
+	}
+	return time.Duration(ticks * 500), true
+}
+
+// IsMlat tells us if this frame came from an MLAT server (it has the MLAT marker instead of a timestamp)
+func (f *Frame) IsMlat() bool {
+	return f.mlatResult
+}
+
+// HasSignalLevel is true if our AVR frame came with a signal level
+func (f *Frame) HasSignalLevel() bool {
+	return f.hasSignalLevel
+}
+
+// SignalRssi is 10*log10 of the signal level byte of the received frame, same as a beast frames signal level
+func (f *Frame) SignalRssi() float64 {
+	return 10 * math.Log10(float64(f.signalLevel))
+}
+
+// BeastTicks returns the raw 12MHz counter this frame was stamped with, 0 if it did not have one
+func (f *Frame) BeastTicks() uint64 {
+	return f.beastTicks
+}
+
 // BeastTicksNs returns a time.Duration timestamp for this frame
 func (f *Frame) BeastTicksNs() time.Duration {
 	return time.Duration(f.beastTicksNs)
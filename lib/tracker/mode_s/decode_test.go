@@ -251,6 +251,27 @@ func TestCrcDecode(t *testing.T) {
 	}
 }
 
+func TestFrame_Address(t *testing.T) {
+	for _, msg := range []string{"*8D76AA735893E7E3F1FC2A112A9D;", "*00050319AB8C22;", "*210000992F8C48;"} {
+		f := NewFrame(msg, time.Now())
+		icao, err := f.Address()
+		if nil != err {
+			t.Errorf("failed to find the address of %s: %s", msg, err)
+			continue
+		}
+		if err = f.Decode(); nil != err {
+			t.Errorf("failed to decode %s: %s", msg, err)
+			continue
+		}
+		if f.Icao() != icao {
+			t.Errorf("expected %s to be for %06X, got %06X", msg, f.Icao(), icao)
+		}
+	}
+	if _, err := NewFrame("0000000000000000000000000000", time.Now()).Address(); ErrNoOp != err {
+		t.Errorf("expected an empty frame to be a no-op, got %v", err)
+	}
+}
+
 func TestBadFuzz(t *testing.T) {
 	messages := []string{
 		"@00000000000010",
@@ -462,6 +462,12 @@ func (f *Frame) Describe(output io.Writer) {
 	if f.mode == "MLAT" {
 		fprintf(output, "MLAT: Beast Ticks  : %d (@12mhz clock)\n", f.beastTicks)
 		fprintf(output, "MLAT: Beast Uptime  : %s\n", time.Duration(f.beastTicksNs).String())
+		if f.mlatResult {
+			fprintf(output, "MLAT: Synthesised by MLAT Server\n")
+		}
+		if f.hasSignalLevel {
+			fprintf(output, "MLAT: Signal RSSI   : %0.1f dBFS\n", f.SignalRssi())
+		}
 	}
 	// decode the specific DF type
 	switch f.downLinkFormat {
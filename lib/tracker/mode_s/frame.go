@@ -293,6 +293,11 @@ type (
 		// beastTicksNs is the number of nanoseconds since the beast was turned on
 		beastTicksNs   uint64
 		beastAvrUptime time.Duration
+		// signalLevel is the raw signal level from a < or % AVR frame
+		signalLevel    byte
+		hasSignalLevel bool
+		// mlatResult is set when our frame has the MLAT marker instead of a timestamp
+		mlatResult bool
 		// raw is our semi processed string, full is the original string
 		raw, full      string
 		message        []byte
@@ -0,0 +1,75 @@
+package tracker
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// OverflowBlock waits for room in the queue, which slows down whoever is filling it
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest throws away the oldest queued item to make room for the new one
+	OverflowDropOldest
+	// OverflowDropNewest throws away the item we are trying to queue
+	OverflowDropNewest
+)
+
+// OverflowPolicy is what we do with a frame or event when its queue is full
+type OverflowPolicy int
+
+// ParseOverflowPolicy turns block, drop-oldest or drop-newest into an OverflowPolicy
+func ParseOverflowPolicy(policy string) (OverflowPolicy, error) {
+	switch strings.ToLower(policy) {
+	case "", "block":
+		return OverflowBlock, nil
+	case "drop-oldest":
+		return OverflowDropOldest, nil
+	case "drop-newest":
+		return OverflowDropNewest, nil
+	default:
+		return OverflowBlock, fmt.Errorf("unknown overflow policy {%s}, expected block, drop-oldest or drop-newest", policy)
+	}
+}
+
+func (op OverflowPolicy) String() string {
+	switch op {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowDropNewest:
+		return "drop-newest"
+	default:
+		return "unknown"
+	}
+}
+
+// offer puts item on our queue, following our policy if it is full. It tells us if item was queued, and how many
+// older items were thrown away to make room for it
+func offer[T any](queue chan T, item T, policy OverflowPolicy) (queued bool, evicted int) {
+	switch policy {
+	case OverflowDropNewest:
+		select {
+		case queue <- item:
+			return true, 0
+		default:
+			return false, 0
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case queue <- item:
+				return true, evicted
+			default:
+				select {
+				case <-queue:
+					evicted++
+				default:
+				}
+			}
+		}
+	default:
+		queue <- item
+		return true, 0
+	}
+}
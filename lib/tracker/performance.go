@@ -0,0 +1,139 @@
+package tracker
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	// defaultMaxVerticalRate (feet/minute) is faster than anything without a category climbs or descends
+	defaultMaxVerticalRate = 60_000
+	// altitudeJumpMargin (feet) allows for the resolution of altitude reports on top of a planes vertical rate
+	altitudeJumpMargin = 300
+	// altitudeConfirmMaxAge is how long an altitude that did not fit waits for another to agree with it
+	altitudeConfirmMaxAge = 30 * time.Second
+)
+
+type (
+	// Performance is how fast a plane can go, from which we decide if its positions and altitudes are believable
+	Performance struct {
+		// MaxSpeed is in metres/second over the ground, so allows for a tail wind
+		MaxSpeed float64
+		// MaxVerticalRate is in feet/minute, 0 for no limit
+		MaxVerticalRate int
+	}
+)
+
+var (
+	defaultPerformance = Performance{MaxSpeed: maxPlausibleSpeed, MaxVerticalRate: defaultMaxVerticalRate}
+
+	// categoryPerformance is what we expect of each emitter category (see mode_s aircraftCategory)
+	categoryPerformance = map[string]Performance{
+		"0/1": {MaxSpeed: 300, MaxVerticalRate: 8_000},    // light
+		"0/2": {MaxSpeed: 350, MaxVerticalRate: 10_000},   // small
+		"0/3": {MaxSpeed: 380, MaxVerticalRate: 12_000},   // large
+		"0/4": {MaxSpeed: 380, MaxVerticalRate: 12_000},   // high vortex large
+		"0/5": {MaxSpeed: 380, MaxVerticalRate: 12_000},   // heavy
+		"0/6": {MaxSpeed: 1_000, MaxVerticalRate: 80_000}, // high performance
+		"0/7": {MaxSpeed: 120, MaxVerticalRate: 6_000},    // rotorcraft
+		"1/1": {MaxSpeed: 120, MaxVerticalRate: 6_000},    // glider
+		"1/2": {MaxSpeed: 80, MaxVerticalRate: 3_000},     // lighter than air
+		"1/3": {MaxSpeed: 100, MaxVerticalRate: 15_000},   // parachutist
+		"1/4": {MaxSpeed: 80, MaxVerticalRate: 3_000},     // ultralight
+		"1/6": {MaxSpeed: 400, MaxVerticalRate: 15_000},   // unmanned
+		"1/7": {MaxSpeed: 8_000},                          // space
+		"2/1": {MaxSpeed: 50, MaxVerticalRate: 2_000},     // emergency vehicle
+		"2/2": {MaxSpeed: 50, MaxVerticalRate: 2_000},     // service vehicle
+		"2/3": {MaxSpeed: 20, MaxVerticalRate: 2_000},     // point obstacle
+		"2/4": {MaxSpeed: 20, MaxVerticalRate: 2_000},     // cluster obstacle
+		"2/5": {MaxSpeed: 20, MaxVerticalRate: 2_000},     // line obstacle
+	}
+)
+
+// WithPerformanceOverrides sets how fast planes can go, keyed by ICAO (e.g. 7CF9C1) for a single aircraft or by emitter
+// category (e.g. 0/6) in place of what we expect of that category
+func WithPerformanceOverrides(overrides map[string]Performance) Option {
+	return func(t *Tracker) {
+		t.performance = make(map[string]Performance, len(overrides))
+		for key, performance := range overrides {
+			t.performance[strings.ToUpper(key)] = performance
+		}
+	}
+}
+
+// LoadPerformanceOverrides reads our overrides for WithPerformanceOverrides from a JSON file, e.g. one exported from an
+// aircraft type database, of the form {"7CF9C1": {"MaxSpeed": 900, "MaxVerticalRate": 50000}}
+func LoadPerformanceOverrides(path string) (map[string]Performance, error) {
+	buf, err := os.ReadFile(path)
+	if nil != err {
+		return nil, err
+	}
+	overrides := map[string]Performance{}
+	if err = jsoniter.ConfigFastest.Unmarshal(buf, &overrides); nil != err {
+		return nil, fmt.Errorf("could not read performance overrides from %s: %w", path, err)
+	}
+	for key, performance := range overrides {
+		if performance.MaxSpeed <= 0 {
+			return nil, fmt.Errorf("performance override for %s needs a MaxSpeed", key)
+		}
+	}
+	return overrides, nil
+}
+
+// performance is how fast we believe our plane can go, must be called with our lock held
+func (p *Plane) performance() Performance {
+	if nil != p.tracker {
+		if performance, ok := p.tracker.performance[p.icao]; ok {
+			return performance
+		}
+		if performance, ok := p.tracker.performance[p.airframe.categoryType]; ok {
+			return performance
+		}
+	}
+	if performance, ok := categoryPerformance[p.airframe.categoryType]; ok {
+		return performance
+	}
+	return defaultPerformance
+}
+
+// isPlausibleAltitude tells us if our plane could have climbed or descended to altitude since its last one. An altitude
+// that does not fit is held back until another agrees with it, so that we are not stuck on a bad one. Must be called
+// with our lock held
+func (p *Plane) isPlausibleAltitude(altitude int32, altitudeUnits string, ts time.Time) bool {
+	maxRate := p.performance().MaxVerticalRate
+	if 0 == maxRate || p.location.altitudeTs.IsZero() || p.location.altitudeUnits != altitudeUnits {
+		return true
+	}
+	if altitudeFits(p.location.altitude, p.location.altitudeTs, altitude, altitudeUnits, ts, maxRate) {
+		p.pendingAltitude = nil
+		return true
+	}
+	pending := p.pendingAltitude
+	if nil != pending && ts.Sub(pending.altitudeTs) <= altitudeConfirmMaxAge &&
+		altitudeFits(pending.altitude, pending.altitudeTs, altitude, altitudeUnits, ts, maxRate) {
+		p.pendingAltitude = nil
+		return true
+	}
+	p.pendingAltitude = &PlaneLocation{altitude: altitude, altitudeUnits: altitudeUnits, altitudeTs: ts}
+	return false
+}
+
+// altitudeFits tells us if a plane climbing or descending at no more than maxRate (feet/minute) could go from one
+// altitude to the other in time
+func altitudeFits(from int32, fromTs time.Time, to int32, units string, ts time.Time, maxRate int) bool {
+	allowed := (1+ts.Sub(fromTs).Abs().Seconds())*float64(maxRate)/60 + altitudeJumpMargin
+	if "metres" == units {
+		allowed *= 0.3048
+	}
+	return float64(altitudeChange(from, to)) <= allowed
+}
+
+// isPlausibleVerticalRate tells us if our plane can climb or descend at rate (feet/minute), must be called with our lock held
+func (p *Plane) isPlausibleVerticalRate(rate int) bool {
+	maxRate := p.performance().MaxVerticalRate
+	return 0 == maxRate || (rate <= maxRate && rate >= -maxRate)
+}
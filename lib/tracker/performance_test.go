@@ -0,0 +1,109 @@
+package tracker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPlane_PerformanceSpeedLimits(t *testing.T) {
+	trk := NewTracker(WithPerformanceOverrides(map[string]Performance{"7c0042": {MaxSpeed: 900, MaxVerticalRate: 50_000}}))
+	t.Cleanup(trk.Finish)
+	now := time.Now()
+	lat, lon := -31.95, 115.86
+
+	tests := []struct {
+		name     string
+		icao     uint32
+		category string
+		// metres travelled in a second, and do we believe it
+		moved    float64
+		accepted bool
+	}{
+		{name: "helicopter at airliner speed", icao: 0x7C0040, category: "0/7", moved: 600, accepted: false},
+		{name: "helicopter", icao: 0x7C0041, category: "0/7", moved: 150, accepted: true},
+		{name: "unknown category at mach 2", icao: 0x7C0043, category: "", moved: 1300, accepted: true},
+		{name: "airliner at mach 2", icao: 0x7C0044, category: "0/3", moved: 1300, accepted: false},
+		{name: "fast jet", icao: 0x7C0045, category: "0/6", moved: 1800, accepted: true},
+		{name: "overridden fast jet", icao: 0x7C0042, category: "0/3", moved: 1700, accepted: true},
+		{name: "surface vehicle", icao: 0x7C0046, category: "2/2", moved: 200, accepted: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := trk.GetPlane(tt.icao)
+			p.setAirFrameCategoryType(tt.category)
+			_ = p.addLatLong(lat, lon, now)
+			movedLat, movedLon := offsetMetres(lat, lon, tt.moved, 0)
+			_ = p.addLatLong(movedLat, movedLon, now.Add(time.Second))
+			if accepted := movedLat == p.Lat(); accepted != tt.accepted {
+				t.Errorf("expected a move of %0.0fm in a second to be accepted=%t", tt.moved, tt.accepted)
+			}
+		})
+	}
+}
+
+func TestPlane_PerformanceAltitude(t *testing.T) {
+	trk := NewTracker()
+	t.Cleanup(trk.Finish)
+	p := trk.GetPlane(0x7C0047)
+	p.setAirFrameCategoryType("0/3")
+	now := time.Now()
+
+	p.setAltitude(10000, "feet", now)
+	p.setAltitude(10200, "feet", now.Add(time.Second))
+	if 10200 != p.Altitude() {
+		t.Errorf("expected a small climb to be accepted, got %d", p.Altitude())
+	}
+
+	// a bad decode
+	p.setAltitude(30200, "feet", now.Add(2*time.Second))
+	if 10200 != p.Altitude() {
+		t.Errorf("expected a 20,000ft jump in a second to be discarded, got %d", p.Altitude())
+	}
+	p.setAltitude(10300, "feet", now.Add(3*time.Second))
+	if 10300 != p.Altitude() {
+		t.Errorf("expected to carry on after a bad altitude, got %d", p.Altitude())
+	}
+
+	// a jump that the plane then agrees with, e.g. after we missed a lot of frames
+	p.setAltitude(4000, "feet", now.Add(4*time.Second))
+	p.setAltitude(3950, "feet", now.Add(5*time.Second))
+	if 3950 != p.Altitude() {
+		t.Errorf("expected a confirmed altitude to be accepted, got %d", p.Altitude())
+	}
+
+	p.setVerticalRate(-1500, now)
+	p.setVerticalRate(-40000, now)
+	if -1500 != p.VerticalRate() {
+		t.Errorf("expected an impossible vertical rate to be discarded, got %d", p.VerticalRate())
+	}
+
+	// a plane that is not being tracked has nowhere to log the altitude it discards
+	untracked := newPlane(0x7C0048)
+	untracked.setAltitude(10000, "feet", now)
+	if untracked.setAltitude(30000, "feet", now.Add(time.Second)) || 10000 != untracked.Altitude() {
+		t.Errorf("expected a 20,000ft jump in a second to be discarded, got %d", untracked.Altitude())
+	}
+}
+
+func TestLoadPerformanceOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "performance.json")
+	if err := os.WriteFile(path, []byte(`{"7CF9C1": {"MaxSpeed": 900, "MaxVerticalRate": 50000}, "0/7": {"MaxSpeed": 150}}`), 0600); nil != err {
+		t.Fatal(err)
+	}
+	overrides, err := LoadPerformanceOverrides(path)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 900 != overrides["7CF9C1"].MaxSpeed || 50000 != overrides["7CF9C1"].MaxVerticalRate || 150 != overrides["0/7"].MaxSpeed {
+		t.Errorf("unexpected overrides %v", overrides)
+	}
+
+	if err = os.WriteFile(path, []byte(`{"7CF9C1": {"MaxVerticalRate": 50000}}`), 0600); nil != err {
+		t.Fatal(err)
+	}
+	if _, err = LoadPerformanceOverrides(path); nil == err {
+		t.Errorf("expected an override without a MaxSpeed to be an error")
+	}
+}
@@ -35,6 +35,7 @@ type (
 		heading, velocity    float64
 		onGround, hasHeading bool
 		hasLatLon            bool
+		mlat                 bool // our position was worked out by multilateration, not reported by the plane
 		distanceTravelled    float64
 		durationTravelled    float64
 		TrackFinished        bool
@@ -55,6 +56,12 @@ type (
 		statusId   byte
 
 		flightStatusTs time.Time
+
+		// id identifies this flight, startedAt is when it started and landed is set once it is back on the ground
+		id        string
+		startedAt time.Time
+		startSeen bool
+		landed    bool
 	}
 
 	airframe struct {
@@ -75,17 +82,38 @@ type (
 		icao            string
 		squawk          uint32
 		flight          flight
-		locationHistory []*PlaneLocation
+		locationHistory locationHistory
 		location        *PlaneLocation
 		cprLocation     CprLocation
+		track           *trackFilter
+		alternate       *trackHypothesis
 		special         map[string]string
 		msgCount        uint64
 		airframe        airframe
 
+		// firstFix is a position waiting for a second one to confirm it, before we say the plane is there
+		firstFix *PlaneLocation
+		// anomalies are the reasons we have to doubt this plane is a single, honest aircraft
+		anomalies map[string]*anomaly
+		// ground weighs up what our frames tell us about the plane being on the ground
+		ground airGround
+		// pendingAltitude is an altitude that did not fit, waiting for another to agree with it
+		pendingAltitude *PlaneLocation
+		// globalFixTs is when our last position from a global (even/odd pair) airborne CPR decode was
+		globalFixTs time.Time
+
 		squawkTs  time.Time
 		specialTs time.Time
 
 		signalLevel *float64 // RSSI dBFS
+		signalLost  bool
+
+		// the emergency (if any) our plane is telling us about, either from its squawk or its status messages
+		squawkEmergency string
+		statusEmergency string
+
+		// pendingEvents are sent once we have finished handling a frame
+		pendingEvents []Event
 
 		rwLock sync.RWMutex
 	}
@@ -205,6 +233,11 @@ func (p *Plane) LastSeen() time.Time {
 func (p *Plane) setLastSeen(lastSeen time.Time) {
 	p.rwLock.Lock()
 	defer p.rwLock.Unlock()
+	if p.signalLost {
+		p.signalLost = false
+		p.queueEvent(&SignalEvent{lifecycleEvent: lifecycleEvent{p: p, at: lastSeen}, silentFor: lastSeen.Sub(p.lastSeen)})
+	}
+	p.checkFlightGap(lastSeen)
 	p.lastSeen = lastSeen
 }
 
@@ -244,7 +277,7 @@ func (p *Plane) setIcaoIdentifier(icaoIdentifier uint32) {
 func (p *Plane) resetLocationHistory() {
 	p.rwLock.Lock()
 	defer p.rwLock.Unlock()
-	p.locationHistory = make([]*PlaneLocation, 0)
+	p.locationHistory.reset()
 }
 
 // setSpecial allows us to set any special status this plane is transmitting
@@ -382,6 +415,12 @@ func (p *Plane) String() string {
 func (p *Plane) setAltitude(altitude int32, altitudeUnits string, ts time.Time) bool {
 	p.rwLock.Lock()
 	defer p.rwLock.Unlock()
+	if !p.isPlausibleAltitude(altitude, altitudeUnits, ts) {
+		if nil != p.tracker {
+			p.tracker.log.Debug().Str("ICAO", p.icao).Int32("From", p.location.altitude).Int32("To", altitude).Msg("Discarding an altitude the plane cannot climb or descend to in time")
+		}
+		return false
+	}
 	// set the current altitude
 	var hasChanged bool
 	if p.location.altitude != altitude {
@@ -421,7 +460,7 @@ func (p *Plane) AltitudeUnits() string {
 }
 
 // setGroundStatus puts our plane on the ground (or not). Use carefully, planes do not like being put on
-// the ground suddenly.
+// the ground suddenly. Frames should give us their evidence with groundEvidence instead
 func (p *Plane) setGroundStatus(onGround bool, ts time.Time) bool {
 	defer func() {
 		if onGround {
@@ -430,9 +469,22 @@ func (p *Plane) setGroundStatus(onGround bool, ts time.Time) bool {
 	}()
 	p.rwLock.Lock()
 	defer p.rwLock.Unlock()
+	p.ground.evidence = -1
+	if onGround {
+		p.ground.evidence = 1
+	}
+	return p.changeGroundStatus(onGround, ts, ts)
+}
+
+// changeGroundStatus puts our plane on the ground (or not) as of changedAt, must be called with our lock held
+func (p *Plane) changeGroundStatus(onGround bool, changedAt, ts time.Time) bool {
 	hasChanged := p.location.onGround != onGround
+	if hasChanged && !p.location.onGroundTs.IsZero() {
+		p.checkGroundTransition(onGround, changedAt)
+	}
 	p.location.onGround = onGround
 	p.location.onGroundTs = ts
+	p.ground.disputedSince = time.Time{}
 	return hasChanged
 }
 
@@ -496,6 +548,12 @@ func (p *Plane) setFlightNumber(flightIdentifier string) bool {
 	p.rwLock.Lock()
 	defer p.rwLock.Unlock()
 	hasChanged := p.flight.identifier != flightIdentifier
+	from, to := strings.TrimSpace(p.flight.identifier), strings.TrimSpace(flightIdentifier)
+	// the first call sign we hear is not a change
+	if from != to && "" != to && "" != from {
+		p.queueEvent(&CallsignChangedEvent{lifecycleEvent: lifecycleEvent{p: p, at: p.lastSeen}, from: from, to: to})
+		p.startFlight(p.lastSeen, true)
+	}
 	p.flight.identifier = flightIdentifier
 	return hasChanged
 }
@@ -517,6 +575,12 @@ func (p *Plane) setSquawkIdentity(ident uint32, ts time.Time) bool {
 	p.rwLock.Lock()
 	defer p.rwLock.Unlock()
 	hasChanged := p.squawk != ident
+	if hasChanged && !p.squawkTs.IsZero() {
+		p.queueEvent(&SquawkChangedEvent{lifecycleEvent: lifecycleEvent{p: p, at: ts}, from: p.squawk, to: ident})
+	}
+	before := p.currentEmergency()
+	p.squawkEmergency = emergencySquawks[ident]
+	p.checkEmergency(before, ts)
 	p.squawk = ident
 	p.squawkTs = ts
 	return hasChanged
@@ -674,6 +738,9 @@ func (p *Plane) DistanceTravelled() DistanceTravelled {
 func (p *Plane) setVerticalRate(rate int, ts time.Time) bool {
 	p.rwLock.Lock()
 	defer p.rwLock.Unlock()
+	if !p.isPlausibleVerticalRate(rate) {
+		return false
+	}
 	hasChanged := p.location.hasVerticalRate != true || p.location.verticalRate != rate
 	p.location.hasVerticalRate = true
 	p.location.verticalRate = rate
@@ -721,11 +788,12 @@ func (p *Plane) Lon() float64 {
 	return p.location.longitude
 }
 
-func (p *Plane) decodeCprFilledRefLatLon(refLat, refLon *float64, ts time.Time) error {
+func (p *Plane) decodeCprFilledRefLatLon(refLat, refLon *float64, ts time.Time, heardBy *receiverRange) error {
 	if nil == refLat || nil == refLon {
 		// let's see if we can use a past plane location for this decode
 		// all we need for our reference lat/lon is a location within 45 nautical miles
-		for _, loc := range p.locationHistory {
+		for i := 0; i < p.locationHistory.len(); i++ {
+			loc := p.locationHistory.at(i)
 			// assume our aircraft is travelling < mach 4 and that it will not cover > 45mn in 1 minute
 			if nil != loc && loc.hasLatLon && loc.cprDecodedTs.After(time.Now().Add(-time.Minute)) {
 				lat := loc.latitude
@@ -737,7 +805,7 @@ func (p *Plane) decodeCprFilledRefLatLon(refLat, refLon *float64, ts time.Time)
 		}
 	}
 	if nil != refLat && nil != refLon {
-		if err := p.decodeCpr(*refLat, *refLon, ts); nil != err {
+		if err := p.decodeCpr(*refLat, *refLon, ts, heardBy); nil != err {
 			return err
 		}
 	}
@@ -746,24 +814,61 @@ func (p *Plane) decodeCprFilledRefLatLon(refLat, refLon *float64, ts time.Time)
 
 // addLatLong Adds a Lat/Long pair to our location tracking and sets it as the current plane location
 func (p *Plane) addLatLong(lat, lon float64, ts time.Time) (warn error) {
+	return p.addPosition(lat, lon, ts, false, nil)
+}
+
+// addPosition adds a position the plane reported, or one we worked out with MLAT, to our location tracking.
+// heardBy is the range of the receiver that heard the position, nil if we are not checking it
+func (p *Plane) addPosition(lat, lon float64, ts time.Time, mlat bool, heardBy *receiverRange) (warn error) {
 	if lat < -95.0 || lat > 95 || lon < -180 || lon > 180 {
 		return fmt.Errorf("cannot add invalid coordinates {%0.6f, %0.6f}", lat, lon)
 	}
+	var correction *TrackCorrectedEvent
+	defer func() {
+		// only once we have let go of our lock, sinks will want to look at us
+		if nil != correction {
+			p.tracker.AddEvent(correction)
+		}
+	}()
 	p.rwLock.Lock()
 	defer p.rwLock.Unlock()
 
+	if mlat {
+		// checked under the same lock as we add our position, so that a position the plane reports in the meantime
+		// is not replaced by ours
+		if p.hasReportedPosition(ts) {
+			return ErrMlatHasAdsb
+		}
+	} else {
+		if warn = p.checkRange(heardBy, lat, lon); nil != warn {
+			p.noteAnomaly(AnomalyOutOfRange, warn.Error(), ts)
+			if heardBy.reject {
+				return
+			}
+			warn = nil
+		}
+		if nil != p.tracker && nil != p.tracker.ranges && !p.location.hasLatLon && !p.confirmFirstFix(lat, lon, ts) {
+			return
+		}
+	}
+
 	var travelledDistance float64
 	var durationTravelled float64
-	numHistoryItems := len(p.locationHistory)
+	numHistoryItems := p.locationHistory.len()
 	// determine speed?
-	if numHistoryItems > 0 && p.location.latitude != 0 && p.location.longitude != 0 {
-		referenceTime := p.locationHistory[numHistoryItems-1].cprDecodedTs
-		if !referenceTime.IsZero() && referenceTime.Before(ts) {
+	if nil != p.tracker && p.tracker.trackFilter {
+		if warn = p.filterLatLong(lat, lon, ts); nil != warn {
+			correction, warn = p.considerAlternateTrack(lat, lon, ts, mlat, warn)
+			return
+		}
+	} else if numHistoryItems > 0 && p.location.latitude != 0 && p.location.longitude != 0 {
+		referenceTime := p.locationHistory.last().cprDecodedTs
+		if !referenceTime.IsZero() && !referenceTime.After(ts) {
 			durationTravelled = float64(ts.Sub(referenceTime)) / float64(time.Second)
 			if 0.0 == durationTravelled {
 				durationTravelled = 1
 			}
-			acceptableMaxDistance := (1 + durationTravelled) * 686 // mach2 in metres/second seems fast enough...
+			acceptableMaxDistance := (1 + durationTravelled) * p.performance().MaxSpeed
 
 			travelledDistance = distance(lat, lon, p.location.latitude, p.location.longitude)
 
@@ -800,17 +905,23 @@ func (p *Plane) addLatLong(lat, lon float64, ts time.Time) (warn error) {
 					lastTs = f.TimeStamp().UnixNano()
 					return true
 				})
+				correction, warn = p.considerAlternateTrack(lat, lon, ts, mlat, warn)
 				return
 			}
 		}
 	}
 
-	if MaxLocationHistory > 0 && numHistoryItems >= MaxLocationHistory {
-		p.locationHistory = p.locationHistory[1:]
-	}
+	p.supportCurrentTrack(ts)
+	p.setLatLong(lat, lon, ts, mlat)
+	return
+}
+
+// setLatLong makes the given position our current location, must be called with our lock held
+func (p *Plane) setLatLong(lat, lon float64, ts time.Time, mlat bool) {
 	p.location.latitude = lat
 	p.location.longitude = lon
 	p.location.hasLatLon = true
+	p.location.mlat = mlat
 	p.location.cprDecodedTs = ts
 
 	needsLookup := true
@@ -822,8 +933,10 @@ func (p *Plane) addLatLong(lat, lon float64, ts time.Time) (warn error) {
 	if needsLookup {
 		p.location.gridTileLocation = tile_grid.LookupTile(lat, lon)
 	}
-	p.locationHistory = append(p.locationHistory, p.location.Copy())
-	return
+	p.addToHistory(p.location.Copy())
+	if nil != p.tracker && nil != p.tracker.spatial {
+		p.tracker.spatial.move(p, p.icaoIdentifier, lat, lon)
+	}
 }
 
 func (p *Plane) GridTileLocation() string {
@@ -848,22 +961,81 @@ func (p *Plane) setCprOddLocation(lat, lon float64, t time.Time) error {
 }
 
 // decodeCpr decodes the CPR Even and Odd frames and gets our Plane position
-func (p *Plane) decodeCpr(refLat, refLon float64, ts time.Time) error {
+func (p *Plane) decodeCpr(refLat, refLon float64, ts time.Time, heardBy *receiverRange) error {
 	p.cprLocation.refLat = refLat
 	p.cprLocation.refLon = refLon
-	loc, err := p.cprLocation.decode(p.OnGround())
+	surface := p.cprLocation.surface
+	loc, err := p.cprLocation.decode(surface)
 	if nil != err || loc == nil {
 		return err
 	}
 
-	return p.addLatLong(loc.latitude, loc.longitude, loc.cprDecodedTs)
+	if err = p.addPosition(loc.latitude, loc.longitude, loc.cprDecodedTs, false, heardBy); nil != err {
+		return err
+	}
+	if !surface {
+		p.rwLock.Lock()
+		p.globalFixTs = loc.cprDecodedTs
+		p.rwLock.Unlock()
+	}
+	return nil
+}
+
+// hasGlobalFix tells us if our current position came from a global airborne CPR decode, one that did not need a
+// reference to decode
+func (p *Plane) hasGlobalFix() bool {
+	p.rwLock.RLock()
+	defer p.rwLock.RUnlock()
+	return p.location.hasLatLon && !p.globalFixTs.IsZero() && p.globalFixTs.Equal(p.location.cprDecodedTs)
+}
+
+// decodeCprLocal decodes the CPR frame we just got on its own, against where the plane recently was or failing that
+// our receivers reference. We use it when we do not have an even/odd pair to decode
+func (p *Plane) decodeCprLocal(frame *mode_s.Frame, onGround bool, refLat, refLon *float64, heardBy *receiverRange) error {
+	if nil != p.tracker && p.tracker.pairedCprOnly {
+		return nil
+	}
+	ts := frame.TimeStamp()
+	var lat, lon, maxRange float64
+	p.rwLock.RLock()
+	// a position is only a reference when nothing disputes it, otherwise we would hold a plane on a wrong track
+	age := ts.Sub(p.location.cprDecodedTs)
+	trusted := p.location.hasLatLon && !p.location.mlat && !p.location.TrackFinished && nil == p.alternate &&
+		age > -localCprMaxRefAge && age < localCprMaxRefAge
+	if trusted {
+		halfZone := localCprAirborneHalfZone
+		if onGround {
+			halfZone = localCprSurfaceHalfZone
+		}
+		lat, lon = p.location.latitude, p.location.longitude
+		maxRange = math.Min(halfZone*localCprZoneMargin, (1+math.Abs(age.Seconds()))*p.performance().MaxSpeed)
+	}
+	p.rwLock.RUnlock()
+	if !trusted {
+		if nil == refLat || nil == refLon {
+			return nil
+		}
+		lat, lon = *refLat, *refLon
+		if maxRange = localCprRange(onGround, heardBy); maxRange <= 0 {
+			return nil
+		}
+	}
+
+	decodedLat, decodedLon, err := decodeLocalCpr(float64(frame.Latitude()), float64(frame.Longitude()), !frame.IsEven(), onGround, lat, lon)
+	if nil != err {
+		return err
+	}
+	if d := distance(lat, lon, decodedLat, decodedLon); d > maxRange {
+		return fmt.Errorf("the local CPR decode {%0.4f,%0.4f} for %s is %0.0fm from its reference, further than %0.0fm. Discarding", decodedLat, decodedLon, p.icao, d, maxRange)
+	}
+	return p.addPosition(decodedLat, decodedLon, ts, false, heardBy)
 }
 
 // LocationHistory returns the track history of the Plane
 func (p *Plane) LocationHistory() []*PlaneLocation {
 	p.rwLock.RLock()
 	defer p.rwLock.RUnlock()
-	return p.locationHistory
+	return p.locationHistory.slice()
 }
 
 // Distance function returns the distance (in meters) between two points of
@@ -940,6 +1112,7 @@ func (pl *PlaneLocation) Copy() *PlaneLocation {
 		onGround:          pl.onGround,
 		hasHeading:        pl.hasHeading,
 		hasLatLon:         pl.hasLatLon,
+		mlat:              pl.mlat,
 		distanceTravelled: pl.distanceTravelled,
 		durationTravelled: pl.durationTravelled,
 		TrackFinished:     pl.TrackFinished,
@@ -0,0 +1,154 @@
+package tracker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// maxReceiverRange (in metres) is past the radio horizon of a plane at FL600, no receiver hears further than this
+	maxReceiverRange = 600_000.0
+	// rangeBucketSize is how finely (in metres) we learn a sources range
+	rangeBucketSize = 5_000.0
+	// rangeLearnMinPositions is how many positions a source needs to give us before we learn its range from them
+	rangeLearnMinPositions = 200
+	// rangeLearnPercentile is how much of a sources traffic we expect to be inside its usual range
+	rangeLearnPercentile = 0.99
+	// rangeLearnMargin is how much further than its usual range we let a source hear
+	rangeLearnMargin = 1.5
+	// firstFixMaxAge is how long a planes first position waits for a second one to confirm it
+	firstFixMaxAge = 30 * time.Second
+)
+
+type (
+	// receiverRanges learns how far each of our sources can hear, from the positions they give us
+	receiverRanges struct {
+		lock    sync.RWMutex
+		sources map[string]*learnedRange
+	}
+
+	learnedRange struct {
+		// buckets counts our positions by how far they were from the receiver
+		buckets   [int(maxReceiverRange / rangeBucketSize)]int
+		positions int
+		// metres is the range we have learned, 0 until we have enough positions
+		metres float64
+	}
+
+	// receiverRange is where a source is and how far it can hear. Positions outside it are flagged as an anomaly, and
+	// rejected when we are checking ranges
+	receiverRange struct {
+		source   string
+		lat, lon float64
+		metres   float64
+		// known is set when metres is the range the source gave us or one we learned, not just the furthest anyone hears
+		known  bool
+		reject bool
+	}
+)
+
+// WithRangeChecks learns how far each of our sources can hear and rejects positions beyond that. It also holds back a
+// planes first position until a second one agrees with it. A range given to us by a source is always checked
+func WithRangeChecks() Option {
+	return func(t *Tracker) {
+		t.ranges = &receiverRanges{sources: map[string]*learnedRange{}}
+	}
+}
+
+// add includes a position the source heard, metres from the receiver
+func (rr *receiverRanges) add(source string, metres float64) {
+	if metres < 0 || metres >= maxReceiverRange {
+		return
+	}
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+	lr, ok := rr.sources[source]
+	if !ok {
+		lr = &learnedRange{}
+		rr.sources[source] = lr
+	}
+	lr.buckets[int(metres/rangeBucketSize)]++
+	lr.positions++
+	if lr.positions < rangeLearnMinPositions {
+		return
+	}
+	want := int(rangeLearnPercentile * float64(lr.positions))
+	seen := 0
+	for i, count := range lr.buckets {
+		seen += count
+		if seen >= want {
+			lr.metres = float64(i+1) * rangeBucketSize * rangeLearnMargin
+			break
+		}
+	}
+	if lr.metres > maxReceiverRange {
+		lr.metres = maxReceiverRange
+	}
+}
+
+// learned is how far we have learned the source can hear, false until we have enough positions to know
+func (rr *receiverRanges) learned(source string) (float64, bool) {
+	rr.lock.RLock()
+	defer rr.lock.RUnlock()
+	if lr, ok := rr.sources[source]; ok && lr.metres > 0 {
+		return lr.metres, true
+	}
+	return 0, false
+}
+
+// receiverRange is the area the source can hear, nil if we do not know where it is or are not checking. Only a range
+// the source gave us, or WithRangeChecks, rejects positions. Anomaly detection on its own only flags them
+func (t *Tracker) receiverRange(source *FrameSource, refLat, refLon *float64) *receiverRange {
+	if nil == source || nil == refLat || nil == refLon {
+		return nil
+	}
+	reject := source.MaxRange > 0 || nil != t.ranges
+	if !reject && nil == t.anomalies {
+		return nil
+	}
+	metres, known := t.knownRange(source)
+	if !known {
+		metres = maxReceiverRange
+	}
+	return &receiverRange{source: source.Id(), lat: *refLat, lon: *refLon, metres: metres, known: known, reject: reject}
+}
+
+// learnRange adds the position this frame gave us to what we know about how far its source can hear
+func (t *Tracker) learnRange(source *FrameSource, refLat, refLon *float64, plane *Plane, positionBefore time.Time) {
+	if nil == t.ranges || nil == source || nil == refLat || nil == refLon || nil == plane {
+		return
+	}
+	if !plane.HasLocation() || plane.IsMlatLocation() || !plane.LocationUpdatedAt().After(positionBefore) {
+		return
+	}
+	t.ranges.add(source.Id(), distance(*refLat, *refLon, plane.Lat(), plane.Lon()))
+}
+
+// checkRange makes sure the receiver that heard a plane (nil if we are not checking) could have heard it at the
+// given position, must be called with our lock held
+func (p *Plane) checkRange(heardBy *receiverRange, lat, lon float64) error {
+	if nil == heardBy {
+		return nil
+	}
+	if d := distance(lat, lon, heardBy.lat, heardBy.lon); d > heardBy.metres {
+		return fmt.Errorf("the position {%0.4f,%0.4f} for %s is %0.0fkm from %s, further than it can hear (%0.0fkm). Discarding", lat, lon, p.icao, d/1000, heardBy.source, heardBy.metres/1000)
+	}
+	return nil
+}
+
+// confirmFirstFix holds back a planes first position until a second one agrees with it, so that a single bad decode
+// does not put a plane somewhere it is not. Must be called with our lock held
+func (p *Plane) confirmFirstFix(lat, lon float64, ts time.Time) bool {
+	first := p.firstFix
+	if nil != first && ts.Sub(first.cprDecodedTs) <= firstFixMaxAge && first.isPlausibleMove(lat, lon, ts, p.performance().MaxSpeed) {
+		p.firstFix = nil
+		if p.tracker.trackFilter {
+			_ = p.filterLatLong(first.latitude, first.longitude, first.cprDecodedTs)
+		}
+		p.setLatLong(first.latitude, first.longitude, first.cprDecodedTs, false)
+		return true
+	}
+	p.firstFix = &PlaneLocation{latitude: lat, longitude: lon, hasLatLon: true, cprDecodedTs: ts}
+	return false
+}
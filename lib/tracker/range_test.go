@@ -0,0 +1,87 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlane_RangeCheck(t *testing.T) {
+	trk := NewTracker()
+	t.Cleanup(trk.Finish)
+	refLat, refLon := -31.95, 115.86
+	now := time.Now()
+
+	if nil != trk.receiverRange(&FrameSource{Name: "perth", RefLat: &refLat, RefLon: &refLon}, &refLat, &refLon) {
+		t.Errorf("expected no range check without a configured range or WithRangeChecks()")
+	}
+	source := &FrameSource{Name: "perth", RefLat: &refLat, RefLon: &refLon, MaxRange: 300_000}
+	p := trk.GetPlane(0x7C0004)
+	heardBy := trk.receiverRange(source, &refLat, &refLon)
+
+	// a position from the wrong latitude zone, thousands of km away
+	if err := p.addPosition(-25.95, 115.86, now, false, heardBy); nil == err {
+		t.Errorf("expected a position 660km from our receiver to be rejected")
+	}
+	if p.HasLocation() {
+		t.Fatalf("expected our plane to not have a location")
+	}
+	if err := p.addPosition(-31.05, 115.86, now.Add(time.Second), false, heardBy); nil != err {
+		t.Errorf("expected a position 100km from our receiver to be taken, got %s", err)
+	}
+
+	// the range belongs to the frame, not the plane. Another receiver can hear our plane further away
+	if err := p.addPosition(-25.96, 115.86, now.Add(time.Hour), false, nil); nil != err {
+		t.Errorf("expected a position without a receiver range to not be range checked, got %s", err)
+	}
+
+	// MLAT positions do not come from our receiver
+	if err := trk.AddMlatLocation(0x7C0005, -25.95, 115.86, now); nil != err {
+		t.Errorf("expected an MLAT position to not be range checked, got %s", err)
+	}
+}
+
+func TestPlane_ConfirmFirstFix(t *testing.T) {
+	trk := NewTracker(WithRangeChecks())
+	t.Cleanup(trk.Finish)
+	now := time.Now()
+	p := trk.GetPlane(0x7C0006)
+
+	if err := p.addLatLong(-31.95, 115.86, now); nil != err {
+		t.Fatalf("expected our first position to be held, not rejected: %s", err)
+	}
+	if p.HasLocation() {
+		t.Fatalf("expected our first position to wait for a second one")
+	}
+	// somewhere our plane could not have got to, this becomes the position waiting for confirmation
+	_ = p.addLatLong(-35.95, 115.86, now.Add(time.Second))
+	if p.HasLocation() {
+		t.Fatalf("expected a position that does not agree with our first to not confirm it")
+	}
+	lat, lon := offsetMetres(-35.95, 115.86, 250, 0)
+	if err := p.addLatLong(lat, lon, now.Add(2*time.Second)); nil != err {
+		t.Fatalf("expected our second position to be taken, got %s", err)
+	}
+	if !p.HasLocation() || lat != p.Lat() || lon != p.Lon() {
+		t.Fatalf("expected our plane at {%0.4f, %0.4f}, got {%0.4f, %0.4f}", lat, lon, p.Lat(), p.Lon())
+	}
+	if history := p.LocationHistory(); 2 != len(history) || -35.95 != history[0].latitude {
+		t.Errorf("expected our confirmed first position to be in our history, got %d positions", len(history))
+	}
+}
+
+func TestReceiverRanges_Learn(t *testing.T) {
+	rr := &receiverRanges{sources: map[string]*learnedRange{}}
+	if _, ok := rr.learned("perth"); ok {
+		t.Errorf("expected no range for an unknown source")
+	}
+	for i := 0; i < 300; i++ {
+		rr.add("perth", float64(i)*500)
+		if _, ok := rr.learned("perth"); i == rangeLearnMinPositions-2 && ok {
+			t.Errorf("expected no learned range before %d positions", rangeLearnMinPositions)
+		}
+	}
+	// 99% of our traffic is within 150km, with our margin we let it hear to 225km
+	if got, ok := rr.learned("perth"); !ok || 225_000 != got {
+		t.Errorf("expected to learn a 225km range, got %0.0fm", got)
+	}
+}
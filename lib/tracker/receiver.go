@@ -0,0 +1,260 @@
+package tracker
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"plane.watch/lib/tracker/beast"
+	"plane.watch/lib/tracker/mode_s"
+)
+
+const (
+	// receiverEstimateMinPositions is how many positions a source needs to give us before we trust where we think it is
+	receiverEstimateMinPositions = 50
+	// receiverEstimateMaxError (in metres) is how far off our estimate of where a source is can be, for us to use it
+	receiverEstimateMaxError = 5_000.0
+	// receiverEstimateHalfLife is how long it takes for a position to count for half as much, so that our estimate
+	// follows a receiver that moves
+	receiverEstimateHalfLife = 6 * time.Hour
+)
+
+type (
+	// receiverEstimates works out where each of our sources is, from the positions it hears
+	receiverEstimates struct {
+		lock    sync.RWMutex
+		sources map[string]*receiverEstimate
+		// configured are the sources that told us where they are
+		configured map[string]ReceiverLocation
+	}
+
+	// receiverEstimate is the centre of the positions a source has heard, weighted by the square of their signal
+	// power. Signal power drops off with the square of distance, so the nearest aircraft pull the hardest and our
+	// centre converges on the receiver instead of on where the traffic is
+	receiverEstimate struct {
+		// x, y, z is the weighted sum of our positions as unit vectors
+		x, y, z float64
+		// weight is the sum of our weights, weightSq the sum of their squares
+		weight    float64
+		weightSq  float64
+		positions int
+		updated   time.Time
+	}
+
+	// ReceiverLocation is where a source is, either as it told us or as we estimated it
+	ReceiverLocation struct {
+		Source    string
+		Lat, Lon  float64
+		Estimated bool
+		// Positions is how many positions we estimated it from, Error (in metres) is how far off we could be
+		Positions int     `json:",omitempty"`
+		Error     float64 `json:",omitempty"`
+	}
+)
+
+func newReceiverEstimates() *receiverEstimates {
+	return &receiverEstimates{
+		sources:    map[string]*receiverEstimate{},
+		configured: map[string]ReceiverLocation{},
+	}
+}
+
+// add includes a position the source heard, rssi is in dBFS and NaN if the source does not give us signal levels.
+// Without them, we are left with the centre of the traffic the source hears
+func (re *receiverEstimates) add(source string, lat, lon, rssi float64, ts time.Time) {
+	weight := 1.0
+	if !math.IsNaN(rssi) {
+		weight = math.Pow(10, rssi/5)
+	}
+	if weight <= 0 || math.IsInf(weight, 0) {
+		return
+	}
+	la := lat * math.Pi / 180
+	lo := lon * math.Pi / 180
+
+	re.lock.Lock()
+	defer re.lock.Unlock()
+	e, ok := re.sources[source]
+	if !ok {
+		e = &receiverEstimate{}
+		re.sources[source] = e
+	}
+	if !e.updated.IsZero() && ts.After(e.updated) {
+		e.decay(ts.Sub(e.updated))
+	}
+	e.x += weight * math.Cos(la) * math.Cos(lo)
+	e.y += weight * math.Cos(la) * math.Sin(lo)
+	e.z += weight * math.Sin(la)
+	e.weight += weight
+	e.weightSq += weight * weight
+	e.positions++
+	if ts.After(e.updated) {
+		e.updated = ts
+	}
+}
+
+// decay makes our older positions count for less
+func (e *receiverEstimate) decay(age time.Duration) {
+	f := math.Exp2(-age.Seconds() / receiverEstimateHalfLife.Seconds())
+	e.x *= f
+	e.y *= f
+	e.z *= f
+	e.weight *= f
+	e.weightSq *= f * f
+}
+
+// error is how far (in metres) our centre could be from where the source is. It is the spread of our positions around
+// our centre over the square root of how many positions (by weight) we have, so a few strong signals are not enough
+func (e *receiverEstimate) error() float64 {
+	if e.weight <= 0 || e.weightSq <= 0 {
+		return math.Inf(1)
+	}
+	// the mean of our unit vectors gets shorter the more spread out our positions are
+	resultant := math.Min(1, math.Sqrt(e.x*e.x+e.y*e.y+e.z*e.z)/e.weight)
+	spread := 6378100 * math.Sqrt(2*(1-resultant))
+	positions := e.weight * e.weight / e.weightSq
+	return spread / math.Sqrt(positions)
+}
+
+// usable tells us if we have enough positions, close enough together, to believe our estimate
+func (e *receiverEstimate) usable() bool {
+	return e.positions >= receiverEstimateMinPositions && e.error() <= receiverEstimateMaxError
+}
+
+// configure notes where a source told us it is
+func (re *receiverEstimates) configure(source string, lat, lon float64) {
+	re.lock.RLock()
+	known, ok := re.configured[source]
+	re.lock.RUnlock()
+	if ok && known.Lat == lat && known.Lon == lon {
+		return
+	}
+	re.lock.Lock()
+	re.configured[source] = ReceiverLocation{Source: source, Lat: lat, Lon: lon}
+	re.lock.Unlock()
+}
+
+// location is where we think the source is, once it has given us enough positions
+func (re *receiverEstimates) location(source string) (lat, lon float64, ok bool) {
+	re.lock.RLock()
+	defer re.lock.RUnlock()
+	e, found := re.sources[source]
+	if !found || !e.usable() {
+		return 0, 0, false
+	}
+	lat, lon = e.centre()
+	return lat, lon, true
+}
+
+// centre is the lat/lon of our weighted centre
+func (e *receiverEstimate) centre() (lat, lon float64) {
+	lat = math.Atan2(e.z, math.Hypot(e.x, e.y)) * 180 / math.Pi
+	lon = math.Atan2(e.y, e.x) * 180 / math.Pi
+	return lat, lon
+}
+
+// reference is where the given source is, as it told us or as we have estimated it. An estimate is good enough to
+// check positions against, but not to decode them with, estimated tells us which one we have
+func (t *Tracker) reference(source *FrameSource) (refLat, refLon *float64, estimated bool) {
+	if nil == source {
+		return nil, nil, false
+	}
+	if nil != source.RefLat && nil != source.RefLon {
+		t.receivers.configure(source.Id(), *source.RefLat, *source.RefLon)
+		return source.RefLat, source.RefLon, false
+	}
+	if lat, lon, ok := t.receivers.location(source.Id()); ok {
+		return &lat, &lon, true
+	}
+	return nil, nil, false
+}
+
+// estimateReceiver adds the position this frame gave us to our estimate of where its source is. We only use
+// globally decoded airborne positions, the ones that do not need a reference to decode, so that our estimate does
+// not feed on itself
+func (t *Tracker) estimateReceiver(source *FrameSource, frame Frame, plane *Plane, positionBefore time.Time) {
+	if nil == source || nil == plane {
+		return
+	}
+	m := modeSFrame(frame)
+	if nil == m || !isAirbornePosition(m) {
+		return
+	}
+	if !plane.HasLocation() || plane.IsMlatLocation() || !plane.LocationUpdatedAt().After(positionBefore) || !plane.hasGlobalFix() {
+		return
+	}
+	t.receivers.add(source.Id(), plane.Lat(), plane.Lon(), frameRssi(frame), plane.LocationUpdatedAt())
+}
+
+// ReceiverLocations tells us where each of our sources is, as it told us or as we have estimated it
+func (t *Tracker) ReceiverLocations() []ReceiverLocation {
+	t.receivers.lock.RLock()
+	out := make([]ReceiverLocation, 0, len(t.receivers.sources))
+	for source, e := range t.receivers.sources {
+		if _, ok := t.receivers.configured[source]; ok || !e.usable() {
+			// a source that tells us where it is, knows better than we do
+			continue
+		}
+		lat, lon := e.centre()
+		out = append(out, ReceiverLocation{Source: source, Lat: lat, Lon: lon, Estimated: true, Positions: e.positions, Error: e.error()})
+	}
+	for _, configured := range t.receivers.configured {
+		out = append(out, configured)
+	}
+	t.receivers.lock.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Source < out[j].Source
+	})
+	return out
+}
+
+// ReceiverLocationsHandler serves where each of our sources is as JSON
+func (t *Tracker) ReceiverLocationsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveJson(w, t.ReceiverLocations())
+	})
+}
+
+// modeSFrame gets the Mode S frame out of our frame, if it has one
+func modeSFrame(frame Frame) *mode_s.Frame {
+	switch f := frame.(type) {
+	case *beast.Frame:
+		return f.AvrFrame()
+	case *mode_s.Frame:
+		return f
+	}
+	return nil
+}
+
+// frameRssi is the signal level (in dBFS) our frame was received with, NaN if we do not know it
+func frameRssi(frame Frame) float64 {
+	switch f := frame.(type) {
+	case *beast.Frame:
+		return signalDbfs(f.SignalRssi())
+	case *mode_s.Frame:
+		if f.HasSignalLevel() {
+			return signalDbfs(f.SignalRssi())
+		}
+	}
+	return math.NaN()
+}
+
+// signalDbfs turns a frames SignalRssi, 10*log10 of its signal level byte, into dBFS. The signal level byte is the
+// square root of the signal power, with 255 as full scale
+func signalDbfs(rssi float64) float64 {
+	return 2*rssi - 20*math.Log10(255)
+}
+
+func isAirbornePosition(frame *mode_s.Frame) bool {
+	switch frame.DownLinkType() {
+	case 17, 18:
+		switch frame.MessageTypeString() {
+		case mode_s.DF17FrameAirPositionBarometric, mode_s.DF17FrameAirPositionGnss:
+			return true
+		}
+	}
+	return false
+}
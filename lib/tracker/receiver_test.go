@@ -0,0 +1,130 @@
+package tracker
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"plane.watch/lib/tracker/mode_s"
+)
+
+func TestReceiverEstimates_Converge(t *testing.T) {
+	trk := NewTracker()
+	t.Cleanup(trk.Finish)
+	receiverLat, receiverLon := -31.95, 115.86
+	source := &FrameSource{Name: "no-location"}
+	rnd := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 2000; i++ {
+		if i == receiverEstimateMinPositions-1 {
+			if _, _, ok := trk.receivers.location(source.Id()); ok {
+				t.Fatalf("expected no estimate until we have %d positions", receiverEstimateMinPositions)
+			}
+		}
+		// most of our traffic is off to the north east, and the further away it is the weaker it is
+		bearing := rnd.Float64() * 180
+		if rnd.Float64() < 0.2 {
+			bearing += 180
+		}
+		metres := 5_000 + rnd.Float64()*295_000
+		lat, lon := offsetMetres(receiverLat, receiverLon, metres*math.Cos(bearing*math.Pi/180), metres*math.Sin(bearing*math.Pi/180))
+		rssi := -20 * math.Log10(metres/1000)
+		trk.receivers.add(source.Id(), lat, lon, rssi, time.Now())
+	}
+
+	refLat, refLon, estimated := trk.reference(source)
+	if nil == refLat || nil == refLon || !estimated {
+		t.Fatalf("expected our estimate to be used as the reference for our source")
+	}
+	if miss := distance(receiverLat, receiverLon, *refLat, *refLon); miss > receiverEstimateMaxError {
+		t.Errorf("expected our estimate to be within 5km of our receiver, it is %0.0fm away at {%0.4f, %0.4f}", miss, *refLat, *refLon)
+	}
+
+	// a source that tells us where it is, is believed
+	configuredLat, configuredLon := -32.0, 116.0
+	source.RefLat, source.RefLon = &configuredLat, &configuredLon
+	if refLat, refLon, estimated = trk.reference(source); estimated || *refLat != configuredLat || *refLon != configuredLon {
+		t.Errorf("expected the configured location to be our reference, got {%0.4f, %0.4f}", *refLat, *refLon)
+	}
+	locations := trk.ReceiverLocations()
+	if 1 != len(locations) || locations[0].Estimated {
+		t.Errorf("expected the configured location for our source, got %+v", locations)
+	}
+}
+
+func TestReceiverEstimates_NotSureEnough(t *testing.T) {
+	trk := NewTracker()
+	t.Cleanup(trk.Finish)
+	receiverLat, receiverLon := -31.95, 115.86
+	source := &FrameSource{Name: "no-signal-levels"}
+	rnd := rand.New(rand.NewSource(1))
+
+	// without signal levels, all we have is the middle of the traffic, which could be anywhere near our receiver
+	for i := 0; i < 2*receiverEstimateMinPositions; i++ {
+		bearing := rnd.Float64() * 2 * math.Pi
+		metres := 5_000 + rnd.Float64()*295_000
+		lat, lon := offsetMetres(receiverLat, receiverLon, metres*math.Cos(bearing), metres*math.Sin(bearing))
+		trk.receivers.add(source.Id(), lat, lon, math.NaN(), time.Now())
+	}
+	if refLat, refLon, _ := trk.reference(source); nil != refLat || nil != refLon {
+		t.Errorf("expected no reference from positions that far apart, got {%0.4f, %0.4f}", *refLat, *refLon)
+	}
+	if 0 != len(trk.ReceiverLocations()) {
+		t.Errorf("expected no estimated location for our source, got %+v", trk.ReceiverLocations())
+	}
+}
+
+func TestTracker_EstimateReceiverGlobalOnly(t *testing.T) {
+	trk := NewTracker()
+	t.Cleanup(trk.Finish)
+	source := &FrameSource{Name: "no-location"}
+	refLat, refLon := 52.258, 3.918
+	now := time.Now()
+
+	even, err := mode_s.DecodeString("*8D40621D58C382D690C8AC2863A7;", now)
+	if nil != err {
+		t.Fatalf("failed to decode our even frame: %s", err)
+	}
+	odd, err := mode_s.DecodeString("*8D40621D58C386435CC412692AD6;", now.Add(time.Second))
+	if nil != err {
+		t.Fatalf("failed to decode our odd frame: %s", err)
+	}
+
+	// a single frame decoded against a reference does not count
+	local := trk.GetPlane(even.Icao())
+	before := local.LocationUpdatedAt()
+	local.HandleModeSFrame(even, &refLat, &refLon)
+	if !local.HasLocation() {
+		t.Fatalf("expected a local decode of our frame")
+	}
+	trk.estimateReceiver(source, even, local, before)
+	if _, ok := trk.receivers.sources[source.Id()]; ok {
+		t.Errorf("expected a local decode to not be used to estimate where our receiver is")
+	}
+
+	// an even/odd pair does
+	trk = NewTracker()
+	t.Cleanup(trk.Finish)
+	global := trk.GetPlane(even.Icao())
+	global.HandleModeSFrame(even, nil, nil)
+	before = global.LocationUpdatedAt()
+	global.HandleModeSFrame(odd, nil, nil)
+	trk.estimateReceiver(source, odd, global, before)
+	if e, ok := trk.receivers.sources[source.Id()]; !ok || 1 != e.positions {
+		t.Errorf("expected our global decode to be used to estimate where our receiver is")
+	}
+}
+
+func TestReceiverEstimates_Decay(t *testing.T) {
+	re := newReceiverEstimates()
+	now := time.Now()
+	re.add("moved", -31.95, 115.86, -20, now)
+	re.add("moved", -31.95, 115.86, -20, now.Add(receiverEstimateHalfLife))
+
+	// our first position only counts for half as much as our second
+	e := re.sources["moved"]
+	if weight := math.Pow(10, -20.0/5); math.Abs(e.weight-1.5*weight) > 1e-9 {
+		t.Errorf("expected our first position to have decayed to half its weight, got %0.6f want %0.6f", e.weight, 1.5*weight)
+	}
+}
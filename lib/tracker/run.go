@@ -0,0 +1,122 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultShutdownTimeout is how long we give ourselves to hand on everything we have before we give up
+const defaultShutdownTimeout = 30 * time.Second
+
+var ErrShutdownTimeout = errors.New("timed out shutting down")
+
+// WithShutdownTimeout sets how long we wait for our producers, decode workers and sinks to finish when we shut down
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(t *Tracker) {
+		if timeout > 0 {
+			t.shutdownTimeout = timeout
+		}
+	}
+}
+
+// Run tracks planes until ctx is cancelled or all of our producers have finished, then shuts down in order.
+// Our producers are stopped and the frames they have read are decoded, then our middlewares are stopped and
+// our sinks are given all of our events before they are stopped.
+// Add your producers before calling Run. It returns ErrShutdownTimeout if shutting down took too long
+func (t *Tracker) Run(ctx context.Context) error {
+	producersDone := make(chan struct{})
+	go func() {
+		t.producerWaiter.Wait()
+		close(producersDone)
+	}()
+	select {
+	case <-ctx.Done():
+		t.log.Debug().Msg("Asked to stop")
+	case <-producersDone:
+		t.log.Debug().Msg("Producers finished")
+	}
+	return t.shutdown()
+}
+
+// shutdown stops everything, once. Anyone else shutting us down waits for the first to finish
+func (t *Tracker) shutdown() error {
+	t.finishOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), t.shutdownTimeout)
+		defer cancel()
+		t.finishErr = t.drain(ctx)
+		if nil != t.finishErr {
+			t.log.Error().Err(t.finishErr).Msg("Did not shut down cleanly")
+		}
+	})
+	return t.finishErr
+}
+
+// drain stops our producers, decode workers and sinks in that order, each one handing on what it has to the next.
+// If ctx is done before one finishes we carry on without it
+func (t *Tracker) drain(ctx context.Context) error {
+	var err error
+	keep := func(e error) {
+		if nil == err {
+			err = e
+		}
+	}
+
+	for _, p := range t.producers {
+		t.log.Debug().Str("producer", p.String()).Msg("Stopping Producer")
+		p.Stop()
+	}
+	if errProducers := t.waitFor(ctx, &t.producerWaiter, "producers"); nil != errProducers {
+		// a producer may still be adding frames, so we leave our queues open rather than wait for it
+		keep(errProducers)
+	} else {
+		t.log.Debug().Msg("Closing Decoding Queues")
+		t.queuesLock.Lock()
+		t.queuesOpen = false
+		for _, queue := range t.decodingQueues {
+			close(queue)
+		}
+		t.queuesLock.Unlock()
+	}
+	keep(t.waitFor(ctx, &t.decodingQueueWaiter, "decode workers"))
+
+	t.finishSnapshots()
+	close(t.signalWatchDone)
+	t.stopMiddlewares()
+	t.planeList.Stop()
+
+	t.log.Debug().Msg("Closing Events Queue")
+	// anything still trying to add an event gives up, instead of holding up closing our queue
+	close(t.eventsClosing)
+	t.eventSync.Lock()
+	t.eventsOpen = false
+	close(t.events)
+	t.eventSync.Unlock()
+	keep(t.waitFor(ctx, &t.eventsWaiter, "sinks"))
+
+	t.sinksLock.RLock()
+	defer t.sinksLock.RUnlock()
+	for _, sq := range t.sinks {
+		t.log.Debug().Str("sink", sq.sink.HealthCheckName()).Msg("Stopping Sink")
+		sq.sink.Stop()
+	}
+	return err
+}
+
+// waitFor waits for the given workers to finish, giving up once ctx is done
+func (t *Tracker) waitFor(ctx context.Context, wg *sync.WaitGroup, what string) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		t.log.Warn().Str("waiting for", what).Msg("Gave up waiting while shutting down")
+		return fmt.Errorf("%w: waiting for %s", ErrShutdownTimeout, what)
+	}
+}
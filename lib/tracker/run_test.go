@@ -0,0 +1,141 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"plane.watch/lib/tracker/mode_s"
+)
+
+// shutdownLog records what happened, in order, as we shut down
+type shutdownLog struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (sl *shutdownLog) add(format string, v ...any) {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	sl.entries = append(sl.entries, fmt.Sprintf(format, v...))
+}
+
+// bufferedProducer has all of its frames waiting to be read, and stops as soon as it is asked to
+type bufferedProducer struct {
+	events chan Event
+	log    *shutdownLog
+}
+
+func (bp *bufferedProducer) Listen() chan Event      { return bp.events }
+func (bp *bufferedProducer) String() string          { return "Buffered Producer" }
+func (bp *bufferedProducer) HealthCheckName() string { return "Buffered Producer" }
+func (bp *bufferedProducer) HealthCheck() bool       { return true }
+func (bp *bufferedProducer) Stop() {
+	bp.log.add("producer stopped")
+	close(bp.events)
+}
+
+// countingMiddleware sends a test event for each frame it sees
+type countingMiddleware struct {
+	trk    *Tracker
+	log    *shutdownLog
+	frames int
+}
+
+func (cm *countingMiddleware) String() string { return "Counting Middleware" }
+func (cm *countingMiddleware) Handle(fe *FrameEvent) *FrameEvent {
+	cm.frames++
+	cm.trk.AddEvent(&testEvent{})
+	return fe
+}
+func (cm *countingMiddleware) Stop() {
+	cm.log.add("middleware stopped after %d frames", cm.frames)
+}
+
+// slowSink takes its time with each event
+type slowSink struct {
+	log    *shutdownLog
+	delay  time.Duration
+	events int
+}
+
+func (ss *slowSink) OnEvent(e Event) {
+	if _, ok := e.(*testEvent); ok {
+		time.Sleep(ss.delay)
+		ss.events++
+	}
+}
+func (ss *slowSink) Stop() {
+	ss.log.add("sink stopped after %d events", ss.events)
+}
+func (ss *slowSink) HealthCheckName() string { return "Slow Sink" }
+func (ss *slowSink) HealthCheck() bool       { return true }
+
+type testEvent struct{}
+
+func (te *testEvent) Type() string   { return "test-event" }
+func (te *testEvent) String() string { return "test event" }
+
+func TestTracker_RunShutsDownInOrder(t *testing.T) {
+	const numFrames = 20
+	log := &shutdownLog{}
+	trk := NewTracker(WithDecodeWorkerCount(2))
+	producer := &bufferedProducer{events: make(chan Event, numFrames), log: log}
+	for i := 0; i < numFrames; i++ {
+		producer.events <- NewFrameEvent(mode_s.NewFrame("*8D7C7F0D581176D7BB8D48CD7714;", time.Now()), &FrameSource{Tag: "test"})
+	}
+	trk.AddMiddleware(&countingMiddleware{trk: trk, log: log})
+	trk.AddSink(&slowSink{log: log, delay: time.Millisecond})
+	trk.AddProducer(producer)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := trk.Run(ctx); nil != err {
+		t.Fatalf("Expected a clean shutdown, got %s", err)
+	}
+
+	expected := []string{
+		"producer stopped",
+		fmt.Sprintf("middleware stopped after %d frames", numFrames),
+		fmt.Sprintf("sink stopped after %d events", numFrames),
+	}
+	if len(expected) != len(log.entries) {
+		t.Fatalf("Expected %v, got %v", expected, log.entries)
+	}
+	for i := range expected {
+		if expected[i] != log.entries[i] {
+			t.Errorf("Expected %v, got %v", expected, log.entries)
+			break
+		}
+	}
+
+	// we can be told to stop more than once
+	trk.Finish()
+	trk.Stop()
+	if 3 != len(log.entries) {
+		t.Errorf("Expected to only shut down once, got %v", log.entries)
+	}
+}
+
+func TestTracker_RunGivesUp(t *testing.T) {
+	trk := NewTracker(WithShutdownTimeout(100 * time.Millisecond))
+	stuck := &stuckSink{handling: make(chan struct{}, 1), release: make(chan struct{})}
+	defer close(stuck.release)
+	trk.AddSink(stuck)
+	trk.AddEvent(NewPlaneLocationEvent(trk.GetPlane(0x7C1234)))
+	<-stuck.handling
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	err := trk.Run(ctx)
+	if !errors.Is(err, ErrShutdownTimeout) {
+		t.Errorf("Expected to time out waiting for our stuck sink, got %v", err)
+	}
+	if taken := time.Since(start); taken > time.Second {
+		t.Errorf("Took too long to give up: %s", taken)
+	}
+}
@@ -73,9 +73,7 @@ func (f *Frame) Parse() error {
 	if nil != err {
 		return err
 	}
-	sTime := bits[sbsRecvDate] + " " + bits[sbsRecvTime]
-	//2016/06/03 00:00:38.350
-	f.Received, err = time.Parse("2006/01/02 15:04:05.999999999", sTime)
+	f.Received, err = parseTimeStamp(bits)
 	if nil != err {
 		f.Received = time.Now()
 	}
@@ -154,6 +152,21 @@ func (f *Frame) Parse() error {
 	return nil
 }
 
+// ParseTimeStamp gets the generated date/time from an SBS1 line without parsing the rest of the line
+func ParseTimeStamp(sbsString string) (time.Time, error) {
+	bits := strings.SplitN(sbsString, ",", sbsRecvTime+2)
+	if len(bits) <= sbsRecvTime {
+		return time.Time{}, fmt.Errorf("not enough fields for a timestamp: %s", sbsString)
+	}
+	return parseTimeStamp(bits)
+}
+
+func parseTimeStamp(bits []string) (time.Time, error) {
+	sTime := bits[sbsRecvDate] + " " + bits[sbsRecvTime]
+	//2016/06/03 00:00:38.350
+	return time.Parse("2006/01/02 15:04:05.999999999", sTime)
+}
+
 func icaoStringToInt(icao string) (uint32, error) {
 	btoi, err := hex.DecodeString(icao)
 	if nil != err {
@@ -162,6 +175,18 @@ func icaoStringToInt(icao string) (uint32, error) {
 	return uint32(btoi[0])<<16 | uint32(btoi[1])<<8 | uint32(btoi[2]), nil
 }
 
+// Address works out which aircraft our frame is for, without parsing the rest of it
+func (f *Frame) Address() (uint32, error) {
+	if nil == f {
+		return 0, nil
+	}
+	bits := strings.SplitN(f.original, ",", sbsIcaoField+2)
+	if len(bits) <= sbsIcaoField {
+		return 0, fmt.Errorf("Failed to Parse Input - not enough parameters: %s", f.original)
+	}
+	return icaoStringToInt(bits[sbsIcaoField])
+}
+
 func (f *Frame) Icao() uint32 {
 	if nil == f {
 		return 0
@@ -13,3 +13,17 @@ func TestIcaoStringToInt(t *testing.T) {
 		t.Errorf("Expected %s to decode to %d, but got %d", sut, expected, icaoAddr)
 	}
 }
+
+func TestFrame_Address(t *testing.T) {
+	f := NewFrame("MSG,3,111,11111,7C1BE8,111111,2016/06/03,00:00:38.350,2016/06/03,00:00:38.350,,2000,,,-31.95,115.86,,,0,0,0,0")
+	icao, err := f.Address()
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 0x7C1BE8 != icao {
+		t.Errorf("expected our frame to be for 7C1BE8, got %06X", icao)
+	}
+	if 0 != f.Icao() {
+		t.Errorf("expected finding our address to leave the rest of our frame alone")
+	}
+}
@@ -0,0 +1,158 @@
+package tracker
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const defaultSinkQueueSize = 10000
+
+type (
+	// SinkOption changes how events are delivered to a sink
+	SinkOption func(*sinkQueue)
+
+	// sinkQueue delivers events to a single sink from its own goroutine, so that a slow sink does not hold up the others
+	sinkQueue struct {
+		sink   Sink
+		size   int
+		policy OverflowPolicy
+		events chan queuedEvent
+		done   chan struct{}
+
+		// onlyTypes, if set, are the only event types this sink wants. skipTypes are the event types it does not want
+		onlyTypes map[string]bool
+		skipTypes map[string]bool
+
+		depth   prometheus.Gauge
+		lag     prometheus.Gauge
+		dropped prometheus.Counter
+	}
+
+	queuedEvent struct {
+		event  Event
+		queued time.Time
+	}
+)
+
+// WithSinkQueue sets how many events can be waiting for this sink, and what to do when there is no more room
+func WithSinkQueue(size int, policy OverflowPolicy) SinkOption {
+	return func(sq *sinkQueue) {
+		if size > 0 {
+			sq.size = size
+		}
+		sq.policy = policy
+	}
+}
+
+// WithSinkEventTypes only sends this sink events of the given types
+func WithSinkEventTypes(eventTypes ...string) SinkOption {
+	return func(sq *sinkQueue) {
+		sq.onlyTypes = map[string]bool{}
+		for _, eventType := range eventTypes {
+			sq.onlyTypes[eventType] = true
+		}
+	}
+}
+
+// WithoutSinkEventTypes stops this sink getting events of the given types, e.g. FrameEventType
+func WithoutSinkEventTypes(eventTypes ...string) SinkOption {
+	return func(sq *sinkQueue) {
+		sq.skipTypes = map[string]bool{}
+		for _, eventType := range eventTypes {
+			sq.skipTypes[eventType] = true
+		}
+	}
+}
+
+// WithSinkCounters lets us see, for each sink, how many events are waiting, how far behind (in seconds) it is
+// and how many events we have had to drop. Each is labelled with the sinks name
+func WithSinkCounters(depth, lag *prometheus.GaugeVec, dropped *prometheus.CounterVec) Option {
+	return func(t *Tracker) {
+		t.stats.sinkDepth = depth
+		t.stats.sinkLag = lag
+		t.stats.sinkDropped = dropped
+	}
+}
+
+func (t *Tracker) newSinkQueue(s Sink, opts ...SinkOption) *sinkQueue {
+	sq := &sinkQueue{
+		sink: s,
+		size: defaultSinkQueueSize,
+		// a sink that has fallen behind loses its oldest events, rather than holding up every other sink
+		policy: OverflowDropOldest,
+		done:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(sq)
+	}
+	sq.events = make(chan queuedEvent, sq.size)
+
+	name := s.HealthCheckName()
+	if nil != t.stats.sinkDepth {
+		sq.depth = t.stats.sinkDepth.WithLabelValues(name)
+	}
+	if nil != t.stats.sinkLag {
+		sq.lag = t.stats.sinkLag.WithLabelValues(name)
+	}
+	if nil != t.stats.sinkDropped {
+		sq.dropped = t.stats.sinkDropped.WithLabelValues(name)
+	}
+
+	go sq.run()
+	return sq
+}
+
+// wants tells us if our sink is interested in this event
+func (sq *sinkQueue) wants(e Event) bool {
+	eventType := sinkEventType(e)
+	if nil != sq.onlyTypes && !sq.onlyTypes[eventType] {
+		return false
+	}
+	return !sq.skipTypes[eventType]
+}
+
+// sinkEventType is the type we filter our event by, frame events share their Type() with plane location events
+func sinkEventType(e Event) string {
+	if _, ok := e.(*FrameEvent); ok {
+		return FrameEventType
+	}
+	return e.Type()
+}
+
+// add queues our event for the sink, following our overflow policy if the sink has fallen behind
+func (sq *sinkQueue) add(e Event) {
+	if !sq.wants(e) {
+		return
+	}
+	queued, evicted := offer(sq.events, queuedEvent{event: e, queued: time.Now()}, sq.policy)
+	dropped := evicted
+	if !queued {
+		dropped++
+	} else if nil != sq.depth {
+		sq.depth.Add(float64(1 - evicted))
+	}
+	if nil != sq.dropped && dropped > 0 {
+		sq.dropped.Add(float64(dropped))
+	}
+}
+
+// run sends our sink its events until our queue is closed
+func (sq *sinkQueue) run() {
+	defer close(sq.done)
+	for qe := range sq.events {
+		if nil != sq.depth {
+			sq.depth.Dec()
+		}
+		if nil != sq.lag {
+			sq.lag.Set(time.Since(qe.queued).Seconds())
+		}
+		sq.sink.OnEvent(qe.event)
+	}
+}
+
+// close waits for our sink to get all of its queued events
+func (sq *sinkQueue) close() {
+	close(sq.events)
+	<-sq.done
+}
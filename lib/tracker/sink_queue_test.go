@@ -0,0 +1,110 @@
+package tracker
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// stuckSink does not handle any events until it is released
+type stuckSink struct {
+	handling chan struct{}
+	release  chan struct{}
+	mu       sync.Mutex
+	events   []Event
+}
+
+func (ss *stuckSink) OnEvent(e Event) {
+	select {
+	case ss.handling <- struct{}{}:
+	default:
+	}
+	<-ss.release
+	ss.mu.Lock()
+	ss.events = append(ss.events, e)
+	ss.mu.Unlock()
+}
+func (ss *stuckSink) Stop()                   {}
+func (ss *stuckSink) HealthCheckName() string { return "Stuck Sink" }
+func (ss *stuckSink) HealthCheck() bool       { return true }
+
+func TestTracker_SlowSinkDoesNotBlockOthers(t *testing.T) {
+	trk := NewTracker()
+	stuck := &stuckSink{handling: make(chan struct{}, 1), release: make(chan struct{})}
+	catcher := &eventCatcher{events: make(chan Event, 100)}
+	trk.AddSink(stuck, WithSinkQueue(2, OverflowDropNewest))
+	trk.AddSink(catcher)
+
+	plane := trk.GetPlane(0x7C1234)
+	trk.AddEvent(NewPlaneLocationEvent(plane))
+	<-stuck.handling
+	for i := 1; i < 10; i++ {
+		trk.AddEvent(NewPlaneLocationEvent(plane))
+	}
+	for i := 0; i < 10; i++ {
+		select {
+		case <-catcher.events:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected our other sink to get all its events, only got %d", i)
+		}
+	}
+
+	close(stuck.release)
+	trk.Finish()
+	stuck.mu.Lock()
+	defer stuck.mu.Unlock()
+	// the first event is being handled, two are waiting and the rest are dropped
+	if 3 != len(stuck.events) {
+		t.Errorf("Expected our stuck sink to get 3 events, got %d", len(stuck.events))
+	}
+}
+
+func TestTracker_StuckSinkDropsByDefault(t *testing.T) {
+	trk := NewTracker()
+	stuck := &stuckSink{handling: make(chan struct{}, 1), release: make(chan struct{})}
+	trk.AddSink(stuck)
+
+	plane := trk.GetPlane(0x7C1234)
+	sent := make(chan struct{})
+	go func() {
+		// more than both our event queue and the sinks queue can hold
+		for i := 0; i < 3*defaultSinkQueueSize; i++ {
+			trk.AddEvent(NewPlaneLocationEvent(plane))
+		}
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a stuck sink to not hold up our events once its queue is full")
+	}
+	close(stuck.release)
+	trk.Finish()
+}
+
+func TestTracker_SinkEventTypes(t *testing.T) {
+	trk := NewTracker()
+	noFrames := &eventCatcher{events: make(chan Event, 10)}
+	onlyFrames := &eventCatcher{events: make(chan Event, 10)}
+	trk.AddSink(noFrames, WithoutSinkEventTypes(FrameEventType))
+	trk.AddSink(onlyFrames, WithSinkEventTypes(FrameEventType))
+
+	trk.AddEvent(NewFrameEvent(nil, nil))
+	trk.AddEvent(NewPlaneLocationEvent(trk.GetPlane(0x7C1234)))
+	trk.Finish()
+
+	if 1 != len(noFrames.events) {
+		t.Fatalf("Expected only the plane location event, got %d events", len(noFrames.events))
+	}
+	if _, ok := (<-noFrames.events).(*PlaneLocationEvent); !ok {
+		t.Errorf("Expected only the plane location event")
+	}
+	if 1 != len(onlyFrames.events) {
+		t.Fatalf("Expected only the frame event, got %d events", len(onlyFrames.events))
+	}
+	if e := <-onlyFrames.events; PlaneLocationEventType != e.Type() {
+		t.Errorf("Expected our frame event to keep its type, got %s", e.Type())
+	} else if _, ok := e.(*FrameEvent); !ok {
+		t.Errorf("Expected only the frame event")
+	}
+}
@@ -0,0 +1,406 @@
+package tracker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const snapshotVersion = 1
+
+type (
+	// trackerSnapshot is everything we need to pick up tracking where we left off
+	trackerSnapshot struct {
+		Version int
+		Taken   time.Time
+		Planes  []planeSnapshot
+	}
+
+	planeSnapshot struct {
+		Icao         uint32
+		TrackedSince time.Time
+		LastSeen     time.Time
+		MsgCount     uint64
+
+		Squawk    uint32
+		SquawkTs  time.Time
+		Special   map[string]string
+		SpecialTs time.Time
+
+		FlightIdentifier string
+		FlightStatus     string
+		FlightStatusId   byte
+		FlightStatusTs   time.Time
+		FlightId         string
+		FlightStartedAt  time.Time
+		FlightStartSeen  bool
+		FlightLanded     bool
+
+		Category     string
+		CategoryType string
+		Width        *float32
+		Length       *float32
+		Registration *string
+
+		SignalLevel *float64
+		SignalLost  bool
+
+		SquawkEmergency string
+		StatusEmergency string
+
+		GroundEvidence      float64
+		GroundDisputedSince time.Time
+
+		Location locationSnapshot
+		History  []locationSnapshot
+		Cpr      cprSnapshot
+	}
+
+	locationSnapshot struct {
+		Lat, Lon          float64
+		Altitude          int32
+		AltitudeUnits     string
+		HasVerticalRate   bool
+		VerticalRate      int
+		HasVelocity       bool
+		Velocity          float64
+		HasHeading        bool
+		Heading           float64
+		OnGround          bool
+		HasLatLon         bool
+		Mlat              bool
+		DistanceTravelled float64
+		DurationTravelled float64
+		TrackFinished     bool
+		GridTile          string
+
+		CprDecodedTs   time.Time
+		AltitudeTs     time.Time
+		HeadingTs      time.Time
+		VelocityTs     time.Time
+		OnGroundTs     time.Time
+		VerticalRateTs time.Time
+	}
+
+	cprSnapshot struct {
+		EvenLat, EvenLon, OddLat, OddLon float64
+		EvenTs, OddTs                    time.Time
+		EvenFrame, OddFrame              bool
+		Surface                          bool
+	}
+)
+
+// WithSnapshot saves the state of all our planes to the given file every interval and when we finish.
+// The snapshot is loaded when the tracker starts, so that a restart does not lose track of our planes
+func WithSnapshot(path string, interval time.Duration) Option {
+	return func(t *Tracker) {
+		t.snapshotPath = path
+		t.snapshotInterval = interval
+	}
+}
+
+// startSnapshots restores our last snapshot and periodically saves a new one
+func (t *Tracker) startSnapshots() {
+	if "" == t.snapshotPath {
+		return
+	}
+	if err := t.LoadSnapshot(t.snapshotPath); nil != err && !errors.Is(err, os.ErrNotExist) {
+		t.log.Error().Err(err).Str("file", t.snapshotPath).Msg("Failed to restore tracker snapshot")
+	}
+
+	t.snapshotDone = make(chan struct{})
+	if t.snapshotInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(t.snapshotInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.snapshotDone:
+				return
+			case <-ticker.C:
+				if err := t.SaveSnapshot(t.snapshotPath); nil != err {
+					t.log.Error().Err(err).Str("file", t.snapshotPath).Msg("Failed to save tracker snapshot")
+				}
+			}
+		}
+	}()
+}
+
+// finishSnapshots stops our periodic snapshots and takes a final one
+func (t *Tracker) finishSnapshots() {
+	if "" == t.snapshotPath {
+		return
+	}
+	close(t.snapshotDone)
+	if err := t.SaveSnapshot(t.snapshotPath); nil != err {
+		t.log.Error().Err(err).Str("file", t.snapshotPath).Msg("Failed to save tracker snapshot")
+	}
+}
+
+// SaveSnapshot writes the state of all our planes to the given file
+func (t *Tracker) SaveSnapshot(path string) error {
+	snapshot := trackerSnapshot{
+		Version: snapshotVersion,
+		Taken:   time.Now(),
+		Planes:  make([]planeSnapshot, 0, t.numPlanes()),
+	}
+	t.EachPlane(func(p *Plane) bool {
+		snapshot.Planes = append(snapshot.Planes, p.snapshot())
+		return true
+	})
+
+	buf, err := jsoniter.ConfigFastest.Marshal(&snapshot)
+	if nil != err {
+		return err
+	}
+
+	// write to a temp file first, so we never leave a half written snapshot behind
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if nil != err {
+		return err
+	}
+	if _, err = tmpFile.Write(buf); nil != err {
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpFile.Name())
+		return err
+	}
+	if err = tmpFile.Close(); nil != err {
+		_ = os.Remove(tmpFile.Name())
+		return err
+	}
+	if err = os.Rename(tmpFile.Name(), path); nil != err {
+		_ = os.Remove(tmpFile.Name())
+		return err
+	}
+	t.log.Debug().Int("planes", len(snapshot.Planes)).Str("file", path).Msg("Saved tracker snapshot")
+	return nil
+}
+
+// LoadSnapshot restores the planes from the given file. Planes that we would have already pruned are ignored
+func (t *Tracker) LoadSnapshot(path string) error {
+	buf, err := os.ReadFile(path)
+	if nil != err {
+		return err
+	}
+	var snapshot trackerSnapshot
+	if err = jsoniter.ConfigFastest.Unmarshal(buf, &snapshot); nil != err {
+		return err
+	}
+	if snapshotVersion != snapshot.Version {
+		return fmt.Errorf("unsupported snapshot version %d", snapshot.Version)
+	}
+
+	oldest := time.Now().Add(-t.pruneAfter)
+	restored := 0
+	for _, ps := range snapshot.Planes {
+		if 0 == ps.Icao || ps.LastSeen.Before(oldest) {
+			continue
+		}
+		if _, ok := t.planeList.Load(ps.Icao); ok {
+			continue
+		}
+		p := newPlane(ps.Icao)
+		p.tracker = t
+		p.restore(ps)
+		t.planeList.Store(ps.Icao, p)
+		if ps.Location.HasLatLon {
+			t.spatial.move(p, ps.Icao, ps.Location.Lat, ps.Location.Lon)
+		}
+		if nil != t.stats.currentPlanes {
+			t.stats.currentPlanes.Inc()
+		}
+		restored++
+	}
+	t.log.Info().
+		Int("restored", restored).
+		Int("snapshot", len(snapshot.Planes)).
+		Time("taken", snapshot.Taken).
+		Msg("Restored tracker snapshot")
+	return nil
+}
+
+// snapshot takes a copy of all the things we know about this plane
+func (p *Plane) snapshot() planeSnapshot {
+	p.rwLock.RLock()
+	defer p.rwLock.RUnlock()
+
+	ps := planeSnapshot{
+		Icao:                p.icaoIdentifier,
+		TrackedSince:        p.trackedSince,
+		LastSeen:            p.lastSeen,
+		MsgCount:            p.MsgCount(),
+		Squawk:              p.squawk,
+		SquawkTs:            p.squawkTs,
+		Special:             make(map[string]string, len(p.special)),
+		SpecialTs:           p.specialTs,
+		FlightIdentifier:    p.flight.identifier,
+		FlightStatus:        p.flight.status,
+		FlightStatusId:      p.flight.statusId,
+		FlightStatusTs:      p.flight.flightStatusTs,
+		FlightId:            p.flight.id,
+		FlightStartedAt:     p.flight.startedAt,
+		FlightStartSeen:     p.flight.startSeen,
+		FlightLanded:        p.flight.landed,
+		Category:            p.airframe.category,
+		CategoryType:        p.airframe.categoryType,
+		Width:               p.airframe.width,
+		Length:              p.airframe.length,
+		Registration:        p.airframe.registration,
+		SignalLevel:         p.signalLevel,
+		SignalLost:          p.signalLost,
+		SquawkEmergency:     p.squawkEmergency,
+		StatusEmergency:     p.statusEmergency,
+		GroundEvidence:      p.ground.evidence,
+		GroundDisputedSince: p.ground.disputedSince,
+		Location:            p.location.snapshot(),
+		History:             make([]locationSnapshot, p.locationHistory.len()),
+		Cpr:                 p.cprLocation.snapshot(),
+	}
+	for k, v := range p.special {
+		ps.Special[k] = v
+	}
+	for i := range ps.History {
+		ps.History[i] = p.locationHistory.at(i).snapshot()
+	}
+	return ps
+}
+
+// restore puts our plane back the way it was when the snapshot was taken
+func (p *Plane) restore(ps planeSnapshot) {
+	p.rwLock.Lock()
+	defer p.rwLock.Unlock()
+
+	p.trackedSince = ps.TrackedSince
+	p.lastSeen = ps.LastSeen
+	p.msgCount = ps.MsgCount
+	p.squawk = ps.Squawk
+	p.squawkTs = ps.SquawkTs
+	if nil != ps.Special {
+		p.special = ps.Special
+	}
+	p.specialTs = ps.SpecialTs
+	p.flight = flight{
+		identifier:     ps.FlightIdentifier,
+		status:         ps.FlightStatus,
+		statusId:       ps.FlightStatusId,
+		flightStatusTs: ps.FlightStatusTs,
+		id:             ps.FlightId,
+		startedAt:      ps.FlightStartedAt,
+		startSeen:      ps.FlightStartSeen,
+		landed:         ps.FlightLanded,
+	}
+	p.airframe = airframe{
+		category:     ps.Category,
+		categoryType: ps.CategoryType,
+		width:        ps.Width,
+		length:       ps.Length,
+		registration: ps.Registration,
+	}
+	p.signalLevel = ps.SignalLevel
+	p.signalLost = ps.SignalLost
+	p.squawkEmergency = ps.SquawkEmergency
+	p.statusEmergency = ps.StatusEmergency
+	p.ground = airGround{evidence: ps.GroundEvidence, disputedSince: ps.GroundDisputedSince}
+	p.location = ps.Location.restore()
+
+	p.locationHistory.reset()
+	maxPoints, maxAge, _ := p.historyLimits()
+	for _, loc := range ps.History {
+		p.locationHistory.push(loc.restore(), maxPoints, maxAge)
+	}
+	p.cprLocation.restore(ps.Cpr)
+}
+
+func (pl *PlaneLocation) snapshot() locationSnapshot {
+	pl.rwlock.RLock()
+	defer pl.rwlock.RUnlock()
+	return locationSnapshot{
+		Lat:               pl.latitude,
+		Lon:               pl.longitude,
+		Altitude:          pl.altitude,
+		AltitudeUnits:     pl.altitudeUnits,
+		HasVerticalRate:   pl.hasVerticalRate,
+		VerticalRate:      pl.verticalRate,
+		HasVelocity:       pl.hasVelocity,
+		Velocity:          pl.velocity,
+		HasHeading:        pl.hasHeading,
+		Heading:           pl.heading,
+		OnGround:          pl.onGround,
+		HasLatLon:         pl.hasLatLon,
+		Mlat:              pl.mlat,
+		DistanceTravelled: pl.distanceTravelled,
+		DurationTravelled: pl.durationTravelled,
+		TrackFinished:     pl.TrackFinished,
+		GridTile:          pl.gridTileLocation,
+		CprDecodedTs:      pl.cprDecodedTs,
+		AltitudeTs:        pl.altitudeTs,
+		HeadingTs:         pl.headingTs,
+		VelocityTs:        pl.velocityTs,
+		OnGroundTs:        pl.onGroundTs,
+		VerticalRateTs:    pl.verticalRateTs,
+	}
+}
+
+func (ls locationSnapshot) restore() *PlaneLocation {
+	return &PlaneLocation{
+		latitude:          ls.Lat,
+		longitude:         ls.Lon,
+		altitude:          ls.Altitude,
+		altitudeUnits:     ls.AltitudeUnits,
+		hasVerticalRate:   ls.HasVerticalRate,
+		verticalRate:      ls.VerticalRate,
+		hasVelocity:       ls.HasVelocity,
+		velocity:          ls.Velocity,
+		hasHeading:        ls.HasHeading,
+		heading:           ls.Heading,
+		onGround:          ls.OnGround,
+		hasLatLon:         ls.HasLatLon,
+		mlat:              ls.Mlat,
+		distanceTravelled: ls.DistanceTravelled,
+		durationTravelled: ls.DurationTravelled,
+		TrackFinished:     ls.TrackFinished,
+		gridTileLocation:  ls.GridTile,
+		cprDecodedTs:      ls.CprDecodedTs,
+		altitudeTs:        ls.AltitudeTs,
+		headingTs:         ls.HeadingTs,
+		velocityTs:        ls.VelocityTs,
+		onGroundTs:        ls.OnGroundTs,
+		verticalRateTs:    ls.VerticalRateTs,
+	}
+}
+
+func (cpr *CprLocation) snapshot() cprSnapshot {
+	cpr.rwLock.RLock()
+	defer cpr.rwLock.RUnlock()
+	return cprSnapshot{
+		EvenLat:   cpr.evenLat,
+		EvenLon:   cpr.evenLon,
+		OddLat:    cpr.oddLat,
+		OddLon:    cpr.oddLon,
+		EvenTs:    cpr.time0,
+		OddTs:     cpr.time1,
+		EvenFrame: cpr.evenFrame,
+		OddFrame:  cpr.oddFrame,
+		Surface:   cpr.surface,
+	}
+}
+
+func (cpr *CprLocation) restore(cs cprSnapshot) {
+	cpr.rwLock.Lock()
+	defer cpr.rwLock.Unlock()
+	cpr.evenLat = cs.EvenLat
+	cpr.evenLon = cs.EvenLon
+	cpr.oddLat = cs.OddLat
+	cpr.oddLon = cs.OddLon
+	cpr.time0 = cs.EvenTs
+	cpr.time1 = cs.OddTs
+	cpr.evenFrame = cs.EvenFrame
+	cpr.oddFrame = cs.OddFrame
+	cpr.surface = cs.Surface
+}
@@ -0,0 +1,87 @@
+package tracker
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTracker_SnapshotRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tracker.snapshot")
+	now := time.Now()
+
+	trk := NewTracker(WithSnapshot(path, 0))
+	plane := trk.GetPlane(0x7C12C3)
+	plane.setLastSeen(now)
+	plane.setFlightNumber("QFA123")
+	plane.setSquawkIdentity(7700, now)
+	plane.setEmergencyStatus(true, "General emergency", now)
+	plane.setAltitude(35000, "feet", now)
+	_ = plane.addLatLong(-31.9, 115.9, now)
+	_ = plane.setCprEvenLocation(83068, 15070, now)
+	trackedSince := plane.TrackedSince()
+
+	quiet := trk.GetPlane(0x7C4321)
+	quiet.setLastSeen(now.Add(-2 * time.Minute))
+	if nil == quiet.markSignalLost(now, time.Minute) {
+		t.Fatalf("Expected our quiet plane to lose signal")
+	}
+
+	taxiing := trk.GetPlane(0x7C5678)
+	taxiing.setLastSeen(now)
+	taxiing.groundEvidence(groundVerticalStatus, false, now)
+	taxiing.groundEvidence(groundVerticalStatus, true, now.Add(time.Second))
+	taxiing.groundEvidence(groundVerticalStatus, true, now.Add(2*time.Second))
+	if taxiing.ground.disputedSince.IsZero() {
+		t.Fatalf("Expected our ground state to be in dispute")
+	}
+	evidence, disputedSince := taxiing.ground.evidence, taxiing.ground.disputedSince
+
+	stale := trk.GetPlane(0x7C1B17)
+	stale.setLastSeen(now.Add(-time.Hour))
+
+	trk.Finish()
+
+	restored := NewTracker(WithSnapshot(path, 0))
+	defer restored.Finish()
+	if 3 != restored.numPlanes() {
+		t.Fatalf("Expected 3 planes to be restored, got %d", restored.numPlanes())
+	}
+	p := restored.GetPlane(0x7C12C3)
+	if "QFA123" != p.FlightNumber() {
+		t.Errorf("Expected our flight number to be restored, got %s", p.FlightNumber())
+	}
+	if 7700 != p.SquawkIdentity() || 35000 != p.Altitude() {
+		t.Errorf("Expected squawk and altitude to be restored, got %d and %d", p.SquawkIdentity(), p.Altitude())
+	}
+	if !p.HasLocation() || -31.9 != p.Lat() || 115.9 != p.Lon() {
+		t.Errorf("Expected our location to be restored, got %0.4f,%0.4f", p.Lat(), p.Lon())
+	}
+	if 1 != len(p.LocationHistory()) {
+		t.Errorf("Expected our location history to be restored, got %d entries", len(p.LocationHistory()))
+	}
+	if !p.TrackedSince().Equal(trackedSince) {
+		t.Errorf("Expected tracked since to be kept, got %s want %s", p.TrackedSince(), trackedSince)
+	}
+	if !p.cprLocation.evenFrame || 83068 != p.cprLocation.evenLat {
+		t.Errorf("Expected our CPR state to be restored")
+	}
+	if "General emergency (squawk 7700)" != p.squawkEmergency || "General emergency" != p.statusEmergency {
+		t.Errorf("Expected our emergency to be restored, got %q and %q", p.squawkEmergency, p.statusEmergency)
+	}
+	// the emergency carries on, so there is nothing new to declare
+	p.setEmergencyStatus(true, "General emergency", now)
+	if 0 != len(p.pendingEvents) {
+		t.Errorf("Expected no events for an emergency we already knew about, got %d", len(p.pendingEvents))
+	}
+	if tp := restored.GetPlane(0x7C5678); math.Abs(evidence-tp.ground.evidence) > 1e-6 || !disputedSince.Equal(tp.ground.disputedSince) || tp.OnGround() {
+		t.Errorf("Expected our ground evidence to be restored, got %0.2f since %s", tp.ground.evidence, tp.ground.disputedSince)
+	}
+	if !restored.GetPlane(0x7C4321).signalLost {
+		t.Errorf("Expected our lost signal to be restored")
+	}
+	if p.tracker != restored {
+		t.Errorf("Expected our restored plane to belong to the new tracker")
+	}
+}
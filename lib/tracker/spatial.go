@@ -0,0 +1,254 @@
+package tracker
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+const (
+	// spatialCellSize is the size (in degrees) of each cell in our spatial index
+	spatialCellSize = 0.5
+	// metresPerDegree is roughly how far one degree of latitude is
+	metresPerDegree = 111_320.0
+)
+
+type (
+	// BoundingBox is an area defined by its south-west and north-east corners.
+	// If MinLon is greater than MaxLon, the box crosses the anti-meridian
+	BoundingBox struct {
+		MinLat, MinLon float64
+		MaxLat, MaxLon float64
+	}
+
+	// QueryFilter narrows down the planes returned from a spatial query
+	QueryFilter func(*Plane) bool
+
+	// PlaneDistance is a plane and how far away (in metres) it is from our query point
+	PlaneDistance struct {
+		Plane  *Plane
+		Metres float64
+	}
+
+	spatialCell struct {
+		lat, lon int32
+	}
+
+	spatialEntry struct {
+		plane    *Plane
+		lat, lon float64
+		cell     spatialCell
+	}
+
+	// spatialIndex is a lat/lon grid of planes that lets us find planes without looking at every plane we track
+	spatialIndex struct {
+		mu     sync.RWMutex
+		cells  map[spatialCell]map[uint32]*spatialEntry
+		planes map[uint32]*spatialEntry
+	}
+)
+
+func newSpatialIndex() *spatialIndex {
+	return &spatialIndex{
+		cells:  map[spatialCell]map[uint32]*spatialEntry{},
+		planes: map[uint32]*spatialEntry{},
+	}
+}
+
+func cellFor(lat, lon float64) spatialCell {
+	return spatialCell{
+		lat: int32(math.Floor(lat / spatialCellSize)),
+		lon: int32(math.Floor(normaliseLon(lon) / spatialCellSize)),
+	}
+}
+
+func normaliseLon(lon float64) float64 {
+	for lon >= 180 {
+		lon -= 360
+	}
+	for lon < -180 {
+		lon += 360
+	}
+	return lon
+}
+
+// move puts our plane at the given location in the index
+func (si *spatialIndex) move(p *Plane, icao uint32, lat, lon float64) {
+	cell := cellFor(lat, lon)
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	entry, ok := si.planes[icao]
+	if !ok {
+		entry = &spatialEntry{plane: p, cell: cell}
+		si.planes[icao] = entry
+	} else if entry.cell != cell {
+		si.removeFromCell(icao, entry.cell)
+		entry.cell = cell
+	}
+	entry.lat = lat
+	entry.lon = lon
+	if nil == si.cells[cell] {
+		si.cells[cell] = map[uint32]*spatialEntry{}
+	}
+	si.cells[cell][icao] = entry
+}
+
+// remove takes a plane out of our index
+func (si *spatialIndex) remove(icao uint32) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	if entry, ok := si.planes[icao]; ok {
+		si.removeFromCell(icao, entry.cell)
+		delete(si.planes, icao)
+	}
+}
+
+func (si *spatialIndex) removeFromCell(icao uint32, cell spatialCell) {
+	delete(si.cells[cell], icao)
+	if 0 == len(si.cells[cell]) {
+		delete(si.cells, cell)
+	}
+}
+
+// within gives us all the planes inside the given box, along with where the index thinks they are
+func (si *spatialIndex) within(box BoundingBox) []spatialEntry {
+	minCell := cellFor(box.MinLat, box.MinLon)
+	maxCell := cellFor(box.MaxLat, box.MaxLon)
+	lonCells := int32(360 / spatialCellSize)
+
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+	found := make([]spatialEntry, 0)
+	numLonCells := maxCell.lon - minCell.lon
+	if numLonCells < 0 {
+		// crossing the anti-meridian
+		numLonCells += lonCells
+	}
+	if numLonCells >= lonCells || (box.MinLon <= -180 && box.MaxLon >= 180) {
+		// the whole way around the world
+		minCell.lon = -lonCells / 2
+		numLonCells = lonCells - 1
+	}
+	for latCell := minCell.lat; latCell <= maxCell.lat; latCell++ {
+		for i := int32(0); i <= numLonCells; i++ {
+			lonCell := minCell.lon + i
+			if lonCell >= lonCells/2 {
+				lonCell -= lonCells
+			}
+			for _, entry := range si.cells[spatialCell{lat: latCell, lon: lonCell}] {
+				if box.Contains(entry.lat, entry.lon) {
+					found = append(found, *entry)
+				}
+			}
+		}
+	}
+	return found
+}
+
+func (si *spatialIndex) len() int {
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+	return len(si.planes)
+}
+
+// Contains tells us if the given point is inside our box
+func (bb BoundingBox) Contains(lat, lon float64) bool {
+	if lat < bb.MinLat || lat > bb.MaxLat {
+		return false
+	}
+	if bb.MinLon <= bb.MaxLon {
+		return lon >= bb.MinLon && lon <= bb.MaxLon
+	}
+	return lon >= bb.MinLon || lon <= bb.MaxLon
+}
+
+// boxAround gives us a bounding box that contains everything within radius metres of our point
+func boxAround(lat, lon, radius float64) BoundingBox {
+	latDelta := radius / metresPerDegree
+	box := BoundingBox{
+		MinLat: math.Max(-90, lat-latDelta),
+		MaxLat: math.Min(90, lat+latDelta),
+		MinLon: -180,
+		MaxLon: 180,
+	}
+	cosLat := math.Cos(math.Max(math.Abs(box.MinLat), math.Abs(box.MaxLat)) * math.Pi / 180)
+	if cosLat > 0.01 {
+		lonDelta := latDelta / cosLat
+		if lonDelta < 180 {
+			box.MinLon = normaliseLon(lon - lonDelta)
+			box.MaxLon = normaliseLon(lon + lonDelta)
+		}
+	}
+	return box
+}
+
+// WithinAltitude only returns planes that are between min and max altitude (inclusive)
+func WithinAltitude(min, max int32) QueryFilter {
+	return func(p *Plane) bool {
+		if !p.HasAltitude() {
+			return false
+		}
+		alt := p.Altitude()
+		return alt >= min && alt <= max
+	}
+}
+
+// OnGroundOnly only returns planes that are on the ground, or in the air if onGround is false
+func OnGroundOnly(onGround bool) QueryFilter {
+	return func(p *Plane) bool {
+		return p.HasOnGround() && p.OnGround() == onGround
+	}
+}
+
+func matches(p *Plane, filters []QueryFilter) bool {
+	for _, f := range filters {
+		if !f(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// PlanesWithin gives us all the planes inside our bounding box
+func (t *Tracker) PlanesWithin(box BoundingBox, filters ...QueryFilter) []*Plane {
+	planes := make([]*Plane, 0)
+	for _, entry := range t.spatial.within(box) {
+		if matches(entry.plane, filters) {
+			planes = append(planes, entry.plane)
+		}
+	}
+	return planes
+}
+
+// PlanesNear gives us all the planes within radius metres of our point, closest first
+func (t *Tracker) PlanesNear(lat, lon, radius float64, filters ...QueryFilter) []PlaneDistance {
+	planes := make([]PlaneDistance, 0)
+	for _, entry := range t.spatial.within(boxAround(lat, lon, radius)) {
+		d := distance(lat, lon, entry.lat, entry.lon)
+		if d <= radius && matches(entry.plane, filters) {
+			planes = append(planes, PlaneDistance{Plane: entry.plane, Metres: d})
+		}
+	}
+	sort.Slice(planes, func(i, j int) bool {
+		return planes[i].Metres < planes[j].Metres
+	})
+	return planes
+}
+
+// NearestPlanes gives us the n closest planes to our point, closest first
+func (t *Tracker) NearestPlanes(lat, lon float64, n int, filters ...QueryFilter) []PlaneDistance {
+	if n <= 0 || 0 == t.spatial.len() {
+		return []PlaneDistance{}
+	}
+	// keep doubling our search radius until we have enough planes, or we have searched the whole world
+	maxRadius := math.Pi * 6378100
+	for radius := spatialCellSize * metresPerDegree; ; radius *= 2 {
+		planes := t.PlanesNear(lat, lon, radius, filters...)
+		if len(planes) >= n {
+			return planes[:n]
+		}
+		if radius >= maxRadius {
+			return planes
+		}
+	}
+}
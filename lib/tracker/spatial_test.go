@@ -0,0 +1,93 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func newSpatialTestTracker(t *testing.T) *Tracker {
+	trk := NewTracker()
+	t.Cleanup(trk.Finish)
+	planes := []struct {
+		icao     uint32
+		lat, lon float64
+		alt      int32
+	}{
+		{icao: 1, lat: -31.95, lon: 115.86, alt: 1000},  // Perth
+		{icao: 2, lat: -31.94, lon: 115.97, alt: 35000}, // Perth Airport
+		{icao: 3, lat: -33.87, lon: 151.21, alt: 5000},  // Sydney
+		{icao: 4, lat: -16.5, lon: 179.9, alt: 20000},   // Fiji, just west of the anti-meridian
+		{icao: 5, lat: -16.5, lon: -179.9, alt: 20000},  // just east of the anti-meridian
+	}
+	for _, p := range planes {
+		plane := trk.GetPlane(p.icao)
+		plane.setAltitude(p.alt, "feet", time.Now())
+		if err := plane.addLatLong(p.lat, p.lon, time.Now()); nil != err {
+			t.Fatal(err)
+		}
+	}
+	return trk
+}
+
+func TestTracker_PlanesWithin(t *testing.T) {
+	trk := newSpatialTestTracker(t)
+
+	if got := trk.PlanesWithin(BoundingBox{MinLat: -32.5, MinLon: 115, MaxLat: -31.5, MaxLon: 116.5}); 2 != len(got) {
+		t.Errorf("Expected 2 planes around Perth, got %d", len(got))
+	}
+	got := trk.PlanesWithin(BoundingBox{MinLat: -32.5, MinLon: 115, MaxLat: -31.5, MaxLon: 116.5}, WithinAltitude(0, 10000))
+	if 1 != len(got) || 1 != got[0].IcaoIdentifier() {
+		t.Errorf("Expected only the low plane around Perth, got %d planes", len(got))
+	}
+	if got = trk.PlanesWithin(BoundingBox{MinLat: -17, MinLon: 179, MaxLat: -16, MaxLon: -179}); 2 != len(got) {
+		t.Errorf("Expected 2 planes across the anti-meridian, got %d", len(got))
+	}
+}
+
+func TestTracker_PlanesNear(t *testing.T) {
+	trk := newSpatialTestTracker(t)
+
+	got := trk.PlanesNear(-31.95, 115.86, 20_000)
+	if 2 != len(got) {
+		t.Fatalf("Expected 2 planes within 20km of Perth, got %d", len(got))
+	}
+	if 1 != got[0].Plane.IcaoIdentifier() || got[0].Metres > got[1].Metres {
+		t.Errorf("Expected the closest plane first")
+	}
+	if got = trk.PlanesNear(-31.95, 115.86, 1_000); 1 != len(got) {
+		t.Errorf("Expected 1 plane within 1km of Perth, got %d", len(got))
+	}
+}
+
+func TestTracker_NearestPlanes(t *testing.T) {
+	trk := newSpatialTestTracker(t)
+
+	got := trk.NearestPlanes(-33.8, 151.0, 3)
+	if 3 != len(got) {
+		t.Fatalf("Expected 3 planes, got %d", len(got))
+	}
+	if 3 != got[0].Plane.IcaoIdentifier() {
+		t.Errorf("Expected Sydney to be closest, got %06X", got[0].Plane.IcaoIdentifier())
+	}
+	if got = trk.NearestPlanes(-33.8, 151.0, 10); 5 != len(got) {
+		t.Errorf("Expected all 5 planes when asking for more than we have, got %d", len(got))
+	}
+	if got = trk.NearestPlanes(-33.8, 151.0, 1, WithinAltitude(30000, 40000)); 1 != len(got) || 2 != got[0].Plane.IcaoIdentifier() {
+		t.Errorf("Expected the high plane at Perth")
+	}
+}
+
+func TestTracker_SpatialIndexFollowsPlanes(t *testing.T) {
+	trk := newSpatialTestTracker(t)
+	plane := trk.GetPlane(1)
+	// move it a little further east, still within the speed limits
+	_ = plane.addLatLong(-31.95, 115.87, time.Now().Add(time.Second))
+	if got := trk.PlanesNear(-31.95, 115.87, 100); 1 != len(got) {
+		t.Errorf("Expected the index to follow our plane")
+	}
+
+	trk.spatial.remove(1)
+	if got := trk.PlanesNear(-31.95, 115.87, 100); 0 != len(got) {
+		t.Errorf("Expected the plane to be gone from the index")
+	}
+}
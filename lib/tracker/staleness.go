@@ -0,0 +1,147 @@
+package tracker
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	FieldLocation     = "location"
+	FieldAltitude     = "altitude"
+	FieldVelocity     = "velocity"
+	FieldHeading      = "heading"
+	FieldVerticalRate = "verticalRate"
+	FieldOnGround     = "onGround"
+	FieldFlightStatus = "flightStatus"
+	FieldSquawk       = "squawk"
+	FieldSpecial      = "special"
+)
+
+var (
+	// Fields are the values we can expire, in the order we report them
+	Fields = []string{FieldLocation, FieldAltitude, FieldVelocity, FieldHeading, FieldVerticalRate, FieldOnGround, FieldFlightStatus, FieldSquawk, FieldSpecial}
+
+	// DefaultFieldMaxAges are how long a plane can go without updating each of its values before we stop trusting it
+	DefaultFieldMaxAges = map[string]time.Duration{
+		FieldLocation:     time.Minute,
+		FieldAltitude:     time.Minute,
+		FieldVelocity:     time.Minute,
+		FieldHeading:      time.Minute,
+		FieldVerticalRate: time.Minute,
+		FieldOnGround:     5 * time.Minute,
+		FieldFlightStatus: 5 * time.Minute,
+		FieldSquawk:       5 * time.Minute,
+		FieldSpecial:      5 * time.Minute,
+	}
+)
+
+// WithFieldMaxAges expires a planes values once it has gone longer than their max age without updating them, while
+// still hearing from it. Expired values are reported by StaleFields. Fields without a max age never expire
+func WithFieldMaxAges(maxAges map[string]time.Duration) Option {
+	return func(t *Tracker) {
+		t.fieldMaxAges = make(map[string]time.Duration, len(maxAges))
+		for field, maxAge := range maxAges {
+			t.fieldMaxAges[field] = maxAge
+		}
+	}
+}
+
+// ParseFieldMaxAges turns a list like location=60s,squawk=5m into max ages for WithFieldMaxAges. default gives us
+// DefaultFieldMaxAges, and fields given alongside it override those defaults
+func ParseFieldMaxAges(list string) (map[string]time.Duration, error) {
+	maxAges := map[string]time.Duration{}
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if "" == item {
+			continue
+		}
+		if "default" == item {
+			for field, maxAge := range DefaultFieldMaxAges {
+				maxAges[field] = maxAge
+			}
+			continue
+		}
+		field, age, found := strings.Cut(item, "=")
+		if !found || !isField(field) {
+			return nil, fmt.Errorf("unknown field max age {%s}, expected one of %s=<duration> or default", item, strings.Join(Fields, ","))
+		}
+		maxAge, err := time.ParseDuration(age)
+		if nil != err {
+			return nil, fmt.Errorf("invalid max age for %s: %w", field, err)
+		}
+		maxAges[field] = maxAge
+	}
+	return maxAges, nil
+}
+
+func isField(field string) bool {
+	for _, f := range Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldUpdatedAt is when we last updated the given field, zero if we never have. Must be called with our lock held
+func (p *Plane) fieldUpdatedAt(field string) time.Time {
+	switch field {
+	case FieldLocation:
+		if !p.location.hasLatLon {
+			return time.Time{}
+		}
+		return p.location.cprDecodedTs
+	case FieldAltitude:
+		return p.location.altitudeTs
+	case FieldVelocity:
+		return p.location.velocityTs
+	case FieldHeading:
+		return p.location.headingTs
+	case FieldVerticalRate:
+		return p.location.verticalRateTs
+	case FieldOnGround:
+		return p.location.onGroundTs
+	case FieldFlightStatus:
+		return p.flight.flightStatusTs
+	case FieldSquawk:
+		return p.squawkTs
+	case FieldSpecial:
+		return p.specialTs
+	}
+	return time.Time{}
+}
+
+// isStale tells us that we have a value for field, but have heard from our plane without it being updated for longer
+// than its max age. Must be called with our lock held
+func (p *Plane) isStale(field string) bool {
+	if nil == p.tracker {
+		return false
+	}
+	maxAge := p.tracker.fieldMaxAges[field]
+	if maxAge <= 0 {
+		return false
+	}
+	updatedAt := p.fieldUpdatedAt(field)
+	return !updatedAt.IsZero() && p.lastSeen.Sub(updatedAt) > maxAge
+}
+
+// IsStale tells us the planes value for field (one of the Field* constants) is too old to be trusted
+func (p *Plane) IsStale(field string) bool {
+	p.rwLock.RLock()
+	defer p.rwLock.RUnlock()
+	return p.isStale(field)
+}
+
+// StaleFields are the fields whose values are too old to be trusted, empty if we trust them all
+func (p *Plane) StaleFields() []string {
+	p.rwLock.RLock()
+	defer p.rwLock.RUnlock()
+	var stale []string
+	for _, field := range Fields {
+		if p.isStale(field) {
+			stale = append(stale, field)
+		}
+	}
+	return stale
+}
@@ -0,0 +1,65 @@
+package tracker
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPlane_StaleFields(t *testing.T) {
+	trk := NewTracker(WithFieldMaxAges(map[string]time.Duration{FieldLocation: time.Minute, FieldSquawk: 5 * time.Minute}))
+	t.Cleanup(trk.Finish)
+	p := trk.GetPlane(0x7C0020)
+	now := time.Now()
+
+	p.setLastSeen(now)
+	if 0 != len(p.StaleFields()) {
+		t.Errorf("expected nothing to be stale before we have any values, got %v", p.StaleFields())
+	}
+	_ = p.addLatLong(-31.95, 115.86, now)
+	p.setSquawkIdentity(7700, now)
+	p.setAltitude(10000, "feet", now)
+
+	// still hearing altitudes, but no positions
+	for _, after := range []time.Duration{30 * time.Second, 2 * time.Minute, 10 * time.Minute} {
+		p.setLastSeen(now.Add(after))
+		p.setAltitude(10000, "feet", now.Add(after))
+	}
+	if stale := p.StaleFields(); !reflect.DeepEqual([]string{FieldLocation, FieldSquawk}, stale) {
+		t.Errorf("expected location and squawk to be stale, got %v", stale)
+	}
+	if p.IsStale(FieldAltitude) {
+		t.Errorf("expected our altitude to not be stale")
+	}
+
+	_ = p.addLatLong(-31.95, 115.86, now.Add(10*time.Minute))
+	if p.IsStale(FieldLocation) {
+		t.Errorf("expected a new position to not be stale")
+	}
+
+	// fields without a max age never go stale
+	other := NewTracker()
+	t.Cleanup(other.Finish)
+	p = other.GetPlane(0x7C0021)
+	p.setSquawkIdentity(7700, now)
+	p.setLastSeen(now.Add(time.Hour))
+	if p.IsStale(FieldSquawk) {
+		t.Errorf("expected our squawk to not go stale without a max age")
+	}
+}
+
+func TestParseFieldMaxAges(t *testing.T) {
+	maxAges, err := ParseFieldMaxAges("default, squawk=10m,altitude=30s")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 10*time.Minute != maxAges[FieldSquawk] || 30*time.Second != maxAges[FieldAltitude] || time.Minute != maxAges[FieldLocation] {
+		t.Errorf("expected our defaults with overrides, got %v", maxAges)
+	}
+	if _, err = ParseFieldMaxAges("colour=1m"); nil == err {
+		t.Errorf("expected an unknown field to be an error")
+	}
+	if _, err = ParseFieldMaxAges("squawk=soon"); nil == err {
+		t.Errorf("expected a bad duration to be an error")
+	}
+}
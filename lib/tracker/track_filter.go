@@ -0,0 +1,266 @@
+package tracker
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	// trackPositionNoise is how far out (in metres) we expect a decoded position to be
+	trackPositionNoise = 30.0
+	// trackVelocityNoise is how far out (in metres/second) we expect a reported ground speed to be
+	trackVelocityNoise = 5.0
+	// trackProcessNoise is how much (in m²/s³) we expect a plane to change its speed and direction between updates
+	trackProcessNoise = 9.0
+	// trackInitialVelocity is how fast (in metres/second) a plane could be going when we know nothing about it
+	trackInitialVelocity = 300.0
+	// trackOutlierGate is the normalised residual (chi squared, 2 degrees of freedom) above which a position is an outlier
+	trackOutlierGate = 28.0
+	// trackOutlierMinMetres stops us flagging small jumps as outliers when we are very sure of where the plane is
+	trackOutlierMinMetres = 500.0
+	// trackMaxGap is how long we can go without a position before we stop trusting our track
+	trackMaxGap = time.Minute
+	// trackMaxVelocityAge is how old a reported velocity can be and still be used to update our track
+	trackMaxVelocityAge = 10 * time.Second
+	// trackRebaseMetres is how far we let a plane move from our local origin before we move the origin
+	trackRebaseMetres = 100_000.0
+)
+
+type (
+	// axisFilter is a constant velocity Kalman filter for a single axis
+	axisFilter struct {
+		pos, vel float64
+		// covariance of our position and velocity
+		pp, pv, vv float64
+	}
+
+	// trackFilter smooths the positions we decode for a plane and predicts where it will be.
+	// It works in metres north and east of an origin near the plane.
+	trackFilter struct {
+		originLat, originLon float64
+		metresPerLonDegree   float64
+		north, east          axisFilter
+		ts                   time.Time
+		initialised          bool
+
+		velocityTs time.Time
+		outliers   int
+	}
+
+	// TrackPrediction is where our track filter thinks a plane is at a given time
+	TrackPrediction struct {
+		Lat, Lon float64
+		// UncertaintyMetres is the standard deviation of our position
+		UncertaintyMetres float64
+		// VelocityNorth and VelocityEast are in metres/second
+		VelocityNorth, VelocityEast float64
+		Altitude                    int32
+		HasAltitude                 bool
+		At                          time.Time
+	}
+)
+
+// WithTrackFilter smooths plane positions with a track filter, and uses it to flag bad positions instead of a fixed speed limit
+func WithTrackFilter() Option {
+	return func(t *Tracker) {
+		t.trackFilter = true
+	}
+}
+
+func (af *axisFilter) reset(pos, posVariance, vel, velVariance float64) {
+	af.pos, af.vel = pos, vel
+	af.pp, af.pv, af.vv = posVariance, 0, velVariance
+}
+
+// predict moves our filter forward by dt seconds
+func (af *axisFilter) predict(dt float64) {
+	af.pos += af.vel * dt
+	af.pp += 2*dt*af.pv + dt*dt*af.vv + trackProcessNoise*dt*dt*dt/3
+	af.pv += dt*af.vv + trackProcessNoise*dt*dt/2
+	af.vv += trackProcessNoise * dt
+}
+
+// predicted gives us our position and its variance dt seconds from now, without changing our filter
+func (af axisFilter) predicted(dt float64) (float64, float64) {
+	af.predict(dt)
+	return af.pos, af.pp
+}
+
+func (af *axisFilter) updatePosition(z, variance float64) {
+	s := af.pp + variance
+	kp, kv := af.pp/s, af.pv/s
+	residual := z - af.pos
+	af.pos += kp * residual
+	af.vel += kv * residual
+	af.vv -= kv * af.pv
+	af.pv -= kp * af.pv
+	af.pp -= kp * af.pp
+}
+
+func (af *axisFilter) updateVelocity(z, variance float64) {
+	s := af.vv + variance
+	kp, kv := af.pv/s, af.vv/s
+	residual := z - af.vel
+	af.pos += kp * residual
+	af.vel += kv * residual
+	af.pp -= kp * af.pv
+	af.pv -= kp * af.vv
+	af.vv -= kv * af.vv
+}
+
+// velocityFromTrack turns a ground speed (knots) and track (degrees) into metres/second north and east
+func velocityFromTrack(knots, track float64) (float64, float64) {
+	metresPerSecond := knots * 0.514444
+	rad := track * math.Pi / 180
+	return metresPerSecond * math.Cos(rad), metresPerSecond * math.Sin(rad)
+}
+
+func (tf *trackFilter) setOrigin(lat, lon float64) {
+	tf.originLat = lat
+	tf.originLon = lon
+	tf.metresPerLonDegree = metresPerDegree * math.Max(0.01, math.Cos(lat*math.Pi/180))
+}
+
+func (tf *trackFilter) toLocal(lat, lon float64) (float64, float64) {
+	return (lat - tf.originLat) * metresPerDegree, normaliseLon(lon-tf.originLon) * tf.metresPerLonDegree
+}
+
+func (tf *trackFilter) toLatLon(north, east float64) (float64, float64) {
+	return tf.originLat + north/metresPerDegree, normaliseLon(tf.originLon + east/tf.metresPerLonDegree)
+}
+
+// reset starts our track again at the given position
+func (tf *trackFilter) reset(lat, lon float64, ts time.Time) {
+	tf.setOrigin(lat, lon)
+	tf.north.reset(0, trackPositionNoise*trackPositionNoise, 0, trackInitialVelocity*trackInitialVelocity)
+	tf.east.reset(0, trackPositionNoise*trackPositionNoise, 0, trackInitialVelocity*trackInitialVelocity)
+	tf.ts = ts
+	tf.velocityTs = time.Time{}
+	tf.initialised = true
+}
+
+// rebase moves our origin to where the plane is, so that our flat earth stays (mostly) flat
+func (tf *trackFilter) rebase() {
+	if math.Abs(tf.north.pos) < trackRebaseMetres && math.Abs(tf.east.pos) < trackRebaseMetres {
+		return
+	}
+	tf.setOrigin(tf.toLatLon(tf.north.pos, tf.east.pos))
+	tf.north.pos = 0
+	tf.east.pos = 0
+}
+
+// addVelocity updates our track with the planes reported ground speed and track, if we have not already used it
+func (tf *trackFilter) addVelocity(knots, track float64, ts time.Time) {
+	if !ts.After(tf.velocityTs) {
+		return
+	}
+	tf.velocityTs = ts
+	velNorth, velEast := velocityFromTrack(knots, track)
+	tf.north.updateVelocity(velNorth, trackVelocityNoise*trackVelocityNoise)
+	tf.east.updateVelocity(velEast, trackVelocityNoise*trackVelocityNoise)
+}
+
+// addPosition runs our track forward to ts and updates it with our decoded position.
+// A position too far from where we expect the plane to be is flagged as an outlier and not used
+func (tf *trackFilter) addPosition(lat, lon float64, ts time.Time) (isOutlier bool, residual float64) {
+	if !tf.initialised || ts.Sub(tf.ts) > trackMaxGap {
+		tf.reset(lat, lon, ts)
+		return false, 0
+	}
+	if ts.After(tf.ts) {
+		dt := ts.Sub(tf.ts).Seconds()
+		tf.north.predict(dt)
+		tf.east.predict(dt)
+		tf.ts = ts
+	}
+	tf.rebase()
+
+	north, east := tf.toLocal(lat, lon)
+	dn, de := north-tf.north.pos, east-tf.east.pos
+	residual = math.Sqrt(dn*dn + de*de)
+	variance := trackPositionNoise * trackPositionNoise
+	chiSquared := dn*dn/(tf.north.pp+variance) + de*de/(tf.east.pp+variance)
+	if chiSquared > trackOutlierGate && residual > trackOutlierMinMetres {
+		tf.outliers++
+		return true, residual
+	}
+	tf.north.updatePosition(north, variance)
+	tf.east.updatePosition(east, variance)
+	return false, residual
+}
+
+// predict gives us where we think the plane will be at the given time
+func (tf *trackFilter) predict(at time.Time) TrackPrediction {
+	if at.Before(tf.ts) {
+		at = tf.ts
+	}
+	dt := at.Sub(tf.ts).Seconds()
+	north, northVariance := tf.north.predicted(dt)
+	east, eastVariance := tf.east.predicted(dt)
+	lat, lon := tf.toLatLon(north, east)
+	return TrackPrediction{
+		Lat:               lat,
+		Lon:               lon,
+		UncertaintyMetres: math.Sqrt(northVariance + eastVariance),
+		VelocityNorth:     tf.north.vel,
+		VelocityEast:      tf.east.vel,
+		At:                at,
+	}
+}
+
+// filterLatLong checks our new position against our track, must be called with our lock held
+func (p *Plane) filterLatLong(lat, lon float64, ts time.Time) error {
+	if nil == p.track {
+		p.track = &trackFilter{}
+	}
+	isOutlier, residual := p.track.addPosition(lat, lon, ts)
+	if isOutlier {
+		p.location.TrackFinished = true
+		p.tracker.log.Debug().
+			Str("ICAO", p.icao).
+			Float64("Residual", residual).
+			Floats64("This Lat/Lon", []float64{lat, lon}).
+			Msg("Position does not fit our track")
+		return fmt.Errorf("the position {%0.4f,%0.4f} is %0.2fm from where we expect %s to be. Discarding", lat, lon, residual, p.icao)
+	}
+	age := ts.Sub(p.location.velocityTs)
+	if p.location.hasVelocity && p.location.hasHeading && age > -trackMaxVelocityAge && age < trackMaxVelocityAge {
+		p.track.addVelocity(p.location.velocity, p.location.heading, p.location.velocityTs)
+	}
+	return nil
+}
+
+// PredictPosition tells us where our track filter thinks the plane is (or will be) at the given time
+func (p *Plane) PredictPosition(at time.Time) (TrackPrediction, bool) {
+	p.rwLock.RLock()
+	defer p.rwLock.RUnlock()
+	if nil == p.track || !p.track.initialised {
+		return TrackPrediction{}, false
+	}
+	prediction := p.track.predict(at)
+	if !p.location.altitudeTs.IsZero() {
+		prediction.Altitude = p.location.altitude
+		prediction.HasAltitude = true
+		if p.location.hasVerticalRate && prediction.At.After(p.location.altitudeTs) {
+			minutes := prediction.At.Sub(p.location.altitudeTs).Minutes()
+			prediction.Altitude += int32(float64(p.location.verticalRate) * minutes)
+		}
+	}
+	return prediction, true
+}
+
+// SmoothedPosition is our track filters best guess of where the plane was at its last position update
+func (p *Plane) SmoothedPosition() (TrackPrediction, bool) {
+	return p.PredictPosition(time.Time{})
+}
+
+// PositionOutliers is how many positions have not fit our track for this plane
+func (p *Plane) PositionOutliers() int {
+	p.rwLock.RLock()
+	defer p.rwLock.RUnlock()
+	if nil == p.track {
+		return 0
+	}
+	return p.track.outliers
+}
@@ -0,0 +1,107 @@
+package tracker
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// offsetMetres moves our lat/lon the given number of metres north and east
+func offsetMetres(lat, lon, north, east float64) (float64, float64) {
+	return lat + north/metresPerDegree, lon + east/(metresPerDegree*math.Cos(lat*math.Pi/180))
+}
+
+// flyStraight sends our plane north east at 200m/s with a little noise on each position
+func flyStraight(t *testing.T, plane *Plane, start time.Time, seconds int) (float64, float64) {
+	const lat, lon = -31.95, 115.86
+	velNorth, velEast := velocityFromTrack(388.77, 45)
+	var trueLat, trueLon float64
+	for i := 0; i <= seconds; i++ {
+		ts := start.Add(time.Duration(i) * time.Second)
+		trueLat, trueLon = offsetMetres(lat, lon, velNorth*float64(i), velEast*float64(i))
+		noise := 20.0
+		if 0 == i%2 {
+			noise = -20.0
+		}
+		plane.setVelocity(388.77, ts)
+		plane.setHeading(45, ts)
+		noisyLat, noisyLon := offsetMetres(trueLat, trueLon, noise, -noise)
+		if err := plane.addLatLong(noisyLat, noisyLon, ts); nil != err {
+			t.Fatalf("Position %d should be accepted: %s", i, err)
+		}
+	}
+	return trueLat, trueLon
+}
+
+func TestTrackFilter_Smooths(t *testing.T) {
+	trk := NewTracker(WithTrackFilter())
+	defer trk.Finish()
+	plane := trk.GetPlane(0x7C1234)
+	start := time.Now().Add(-time.Minute)
+
+	trueLat, trueLon := flyStraight(t, plane, start, 30)
+
+	smoothed, ok := plane.SmoothedPosition()
+	if !ok {
+		t.Fatalf("Expected a smoothed position")
+	}
+	rawError := distance(trueLat, trueLon, plane.Lat(), plane.Lon())
+	smoothedError := distance(trueLat, trueLon, smoothed.Lat, smoothed.Lon)
+	if smoothedError >= rawError {
+		t.Errorf("Expected the smoothed position (%0.2fm out) to be better than the raw one (%0.2fm out)", smoothedError, rawError)
+	}
+	if smoothed.UncertaintyMetres <= 0 || smoothed.UncertaintyMetres > 50 {
+		t.Errorf("Unexpected uncertainty %0.2fm", smoothed.UncertaintyMetres)
+	}
+
+	at := start.Add(40 * time.Second)
+	predicted, _ := plane.PredictPosition(at)
+	velNorth, velEast := velocityFromTrack(388.77, 45)
+	expectedLat, expectedLon := offsetMetres(-31.95, 115.86, velNorth*40, velEast*40)
+	if d := distance(expectedLat, expectedLon, predicted.Lat, predicted.Lon); d > 100 {
+		t.Errorf("Expected our prediction 10 seconds ahead to be close, it is %0.2fm out", d)
+	}
+	if predicted.UncertaintyMetres <= smoothed.UncertaintyMetres {
+		t.Errorf("Expected us to be less sure of where the plane will be")
+	}
+}
+
+func TestTrackFilter_Outliers(t *testing.T) {
+	trk := NewTracker(WithTrackFilter())
+	defer trk.Finish()
+	plane := trk.GetPlane(0x7C1234)
+	start := time.Now().Add(-time.Minute)
+	flyStraight(t, plane, start, 10)
+	lat, lon := plane.Lat(), plane.Lon()
+
+	ts := start.Add(11 * time.Second)
+	badLat, badLon := offsetMetres(lat, lon, 5000, 0)
+	if err := plane.addLatLong(badLat, badLon, ts); nil == err {
+		t.Errorf("Expected a position 5km off our track to be an outlier")
+	}
+	if 1 != plane.PositionOutliers() {
+		t.Errorf("Expected 1 outlier, got %d", plane.PositionOutliers())
+	}
+	if plane.Lat() != lat || plane.Lon() != lon {
+		t.Errorf("An outlier should not move our plane")
+	}
+
+	// keep getting the same story, our track must be wrong
+	_ = plane.addLatLong(badLat, badLon, ts.Add(time.Second))
+	if err := plane.addLatLong(badLat, badLon, ts.Add(2*time.Second)); nil != err {
+		t.Errorf("Expected our track to restart after too many outliers: %s", err)
+	}
+	if plane.Lat() != badLat {
+		t.Errorf("Expected our plane to have moved to its new track")
+	}
+}
+
+func TestTrackFilter_Disabled(t *testing.T) {
+	trk := NewTracker()
+	defer trk.Finish()
+	plane := trk.GetPlane(0x7C1234)
+	_ = plane.addLatLong(-31.95, 115.86, time.Now())
+	if _, ok := plane.PredictPosition(time.Now()); ok {
+		t.Errorf("Expected no prediction without a track filter")
+	}
+}
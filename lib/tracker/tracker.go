@@ -17,6 +17,8 @@ import (
 type (
 	Tracker struct {
 		planeList *forgetfulmap.ForgetfulSyncMap
+		// spatial lets us find planes by where they are
+		spatial *spatialIndex
 
 		// pruneTick is how long between pruning attempts
 		// pruneAfter is how long we wait from the last message before we remove it from the tracker
@@ -25,26 +27,84 @@ type (
 		// Input Handling
 		producers   []Producer
 		middlewares []Middleware
-		sinks       []Sink
+		// sinks each get their own queue of events
+		sinks     []*sinkQueue
+		sinksLock sync.RWMutex
 
-		producerWaiter   sync.WaitGroup
-		middlewareWaiter sync.WaitGroup
+		producerWaiter sync.WaitGroup
 
+		// each decode worker has its own queue and looks after its own set of planes, so a planes frames stay in order
 		decodeWorkerCount   int
-		decodingQueue       chan *FrameEvent
+		decodeQueueSize     int
+		overflowPolicy      OverflowPolicy
+		decodingQueues      []chan *FrameEvent
 		decodingQueueWaiter sync.WaitGroup
+		// queuesOpen is false once we have closed our decoding queues
+		queuesLock sync.RWMutex
+		queuesOpen bool
 
 		eventSync    sync.RWMutex
 		eventsOpen   bool
-		finishDone   bool
 		events       chan Event
 		eventsWaiter sync.WaitGroup
+		// eventsClosing is closed just before we close our events queue
+		eventsClosing chan struct{}
+
+		// shutdownTimeout is how long we wait for things to finish when we are stopped
+		shutdownTimeout time.Duration
+		finishOnce      sync.Once
+		finishErr       error
 
 		startTime time.Time
 
+		// snapshotPath is where we save our planes so that we can pick up where we left off after a restart
+		snapshotPath     string
+		snapshotInterval time.Duration
+		snapshotDone     chan struct{}
+
+		// signalLostAfter is how long we go without hearing from a plane before we say we have lost it
+		signalLostAfter time.Duration
+		signalWatchDone chan struct{}
+
+		// flightGap is how long we go without hearing from a plane before we say it is on a new flight
+		flightGap time.Duration
+
+		// trackFilter smooths positions and flags the ones that do not fit a planes track
+		trackFilter bool
+
+		// pairedCprOnly stops us placing a plane from a single CPR frame decoded against a reference
+		pairedCprOnly bool
+
+		// historyBounded is set when we have been told how much history to keep for each plane, rather than MaxLocationHistory
+		historyBounded   bool
+		historyMaxPoints int
+		historyMaxAge    time.Duration
+		// historyTolerance (metres) is how far off its neighbours line a position can be before we keep it, 0 keeps everything
+		historyTolerance float64
+
+		// performance overrides how fast we believe planes can go, by ICAO or emitter category
+		performance map[string]Performance
+
+		// fieldMaxAges is how long each of a planes values lasts without an update before we call it stale
+		fieldMaxAges map[string]time.Duration
+
+		// coverage keeps statistics on what each of our sources can hear
+		coverage *coverage
+		// receivers works out where our sources are, for the ones that do not tell us
+		receivers *receiverEstimates
+		// ranges learns how far our sources can hear, nil if we are not checking
+		ranges *receiverRanges
+		// anomalies flags planes that do not look like a single, honest aircraft, nil if we are not looking
+		anomalies *anomalies
+
 		stats struct {
 			currentPlanes prometheus.Gauge
 			decodedFrames prometheus.Counter
+			queuedFrames  prometheus.Gauge
+			droppedFrames prometheus.Counter
+			sinkDepth     *prometheus.GaugeVec
+			sinkLag       *prometheus.GaugeVec
+			sinkDropped   *prometheus.CounterVec
 		}
 
 		log zerolog.Logger
@@ -59,9 +119,16 @@ func NewTracker(opts ...Option) *Tracker {
 		decodeWorkerCount: 5,
 		pruneTick:         10 * time.Second,
 		pruneAfter:        5 * time.Minute,
-		decodingQueue:     make(chan *FrameEvent, 1000), // a nice deep buffer
+		signalLostAfter:   defaultSignalLostAfter,
+		flightGap:         defaultFlightGap,
+		decodeQueueSize:   1000, // a nice deep buffer
 		events:            make(chan Event, 10000),
+		eventsClosing:     make(chan struct{}),
 		eventsOpen:        true,
+		queuesOpen:        true,
+		shutdownTimeout:   defaultShutdownTimeout,
+		spatial:           newSpatialIndex(),
+		receivers:         newReceiverEstimates(),
 
 		startTime: time.Now(),
 
@@ -80,6 +147,7 @@ func NewTracker(opts ...Option) *Tracker {
 			}
 
 			if plane, ok := value.(*Plane); ok {
+				t.spatial.remove(plane.IcaoIdentifier())
 				// now send an event
 				t.AddEvent(newPlaneActionEvent(plane, false, true))
 			}
@@ -107,12 +175,17 @@ func NewTracker(opts ...Option) *Tracker {
 		}),
 	)
 
+	t.makeDecodingQueues()
+	t.startSnapshots()
+	t.startSignalWatch()
+
 	// Process our event queue and send them to all the Sinks that are currently listening to us
+	t.eventsWaiter.Add(1)
 	go t.processEvents()
 
 	t.decodingQueueWaiter.Add(t.decodeWorkerCount)
-	for i := 0; i < t.decodeWorkerCount; i++ {
-		go t.decodeQueue()
+	for _, queue := range t.decodingQueues {
+		go t.decodeQueue(queue)
 	}
 
 	return t
@@ -149,6 +222,12 @@ func (t *Tracker) EachPlane(pi PlaneIterator) {
 }
 
 func (p *Plane) HandleModeSFrame(frame *mode_s.Frame, refLat, refLon *float64) {
+	p.handleModeSFrame(frame, refLat, refLon, nil)
+}
+
+// handleModeSFrame updates our plane from the frame, checking any position it gives us against the range of the
+// receiver that heard it (nil if we are not checking)
+func (p *Plane) handleModeSFrame(frame *mode_s.Frame, refLat, refLon *float64, heardBy *receiverRange) {
 	if nil == frame {
 		return
 	}
@@ -193,13 +272,13 @@ func (p *Plane) HandleModeSFrame(frame *mode_s.Frame, refLat, refLon *float64) {
 			hasChanged = p.setAltitude(alt, frame.AltitudeUnits(), frame.TimeStamp()) || hasChanged
 		}
 		if frame.VerticalStatusValid() {
-			hasChanged = p.setGroundStatus(frame.MustOnGround(), frame.TimeStamp()) || hasChanged
+			hasChanged = p.groundEvidence(groundVerticalStatus, frame.MustOnGround(), frame.TimeStamp()) || hasChanged
 		}
 		debugMessage(" is at %d %s \033[0m", p.Altitude(), p.AltitudeUnits())
 
 	case 1, 2, 3:
 		if frame.VerticalStatusValid() {
-			hasChanged = p.setGroundStatus(frame.MustOnGround(), frame.TimeStamp()) || hasChanged
+			hasChanged = p.groundEvidence(groundVerticalStatus, frame.MustOnGround(), frame.TimeStamp()) || hasChanged
 		}
 		if frame.Alert() {
 			hasChanged = p.setSpecial("alert", "Alert", frame.TimeStamp()) || hasChanged
@@ -209,11 +288,11 @@ func (p *Plane) HandleModeSFrame(frame *mode_s.Frame, refLat, refLon *float64) {
 		break
 	case 11:
 		if frame.VerticalStatusValid() {
-			hasChanged = p.setGroundStatus(frame.MustOnGround(), frame.TimeStamp()) || hasChanged
+			hasChanged = p.groundEvidence(groundVerticalStatus, frame.MustOnGround(), frame.TimeStamp()) || hasChanged
 		}
 	case 4, 5:
 		if frame.VerticalStatusValid() {
-			hasChanged = p.setGroundStatus(frame.MustOnGround(), frame.TimeStamp()) || hasChanged
+			hasChanged = p.groundEvidence(groundVerticalStatus, frame.MustOnGround(), frame.TimeStamp()) || hasChanged
 		}
 		if frame.Alert() {
 			hasChanged = p.setSpecial("alert", "Alert", frame.TimeStamp()) || hasChanged
@@ -237,7 +316,7 @@ func (p *Plane) HandleModeSFrame(frame *mode_s.Frame, refLat, refLon *float64) {
 			hasChanged = p.setAltitude(alt, frame.AltitudeUnits(), frame.TimeStamp()) || hasChanged
 		}
 		if frame.VerticalStatusValid() {
-			hasChanged = p.setGroundStatus(frame.MustOnGround(), frame.TimeStamp()) || hasChanged
+			hasChanged = p.groundEvidence(groundVerticalStatus, frame.MustOnGround(), frame.TimeStamp()) || hasChanged
 		}
 
 	case 17, 18, 19: // ADS-B
@@ -263,19 +342,23 @@ func (p *Plane) HandleModeSFrame(frame *mode_s.Frame, refLat, refLon *float64) {
 					hasChanged = p.setHeading(frame.MustHeading(), frame.TimeStamp()) || hasChanged
 				}
 				if frame.VelocityValid() {
-					hasChanged = p.setVelocity(frame.MustVelocity(), time.Now()) || hasChanged
-				}
-				if !p.OnGround() {
-					p.zeroCpr()
+					hasChanged = p.setVelocity(frame.MustVelocity(), frame.TimeStamp()) || hasChanged
 				}
-				hasChanged = p.setGroundStatus(true, frame.TimeStamp()) || hasChanged
+				p.cprLocation.setSurface(true)
+				hasChanged = p.groundEvidence(groundSurfaceFrame, true, frame.TimeStamp()) || hasChanged
 
 				if frame.IsEven() {
 					_ = p.setCprEvenLocation(float64(frame.Latitude()), float64(frame.Longitude()), frame.TimeStamp())
 				} else {
 					_ = p.setCprOddLocation(float64(frame.Latitude()), float64(frame.Longitude()), frame.TimeStamp())
 				}
-				if err := p.decodeCprFilledRefLatLon(refLat, refLon, frame.TimeStamp()); nil != err {
+				var err error
+				if p.cprLocation.canDecode() {
+					err = p.decodeCprFilledRefLatLon(refLat, refLon, frame.TimeStamp(), heardBy)
+				} else {
+					err = p.decodeCprLocal(frame, true, refLat, refLon, heardBy)
+				}
+				if nil != err {
 					debugMessage("%s", err)
 				} else {
 					hasChanged = true
@@ -285,11 +368,9 @@ func (p *Plane) HandleModeSFrame(frame *mode_s.Frame, refLat, refLon *float64) {
 				break
 			}
 		case mode_s.DF17FrameAirPositionBarometric, mode_s.DF17FrameAirPositionGnss: // "Airborne Position (with Barometric altitude)"
-			if p.OnGround() {
-				// this is valid since we should only get this type of message when we are off the ground
-				p.zeroCpr()
-			}
-			hasChanged = p.setGroundStatus(false, frame.TimeStamp()) || hasChanged
+			// this is valid since we should only get this type of message when we are off the ground
+			p.cprLocation.setSurface(false)
+			hasChanged = p.groundEvidence(groundAirborneFrame, false, frame.TimeStamp()) || hasChanged
 
 			if frame.IsEven() {
 				_ = p.setCprEvenLocation(float64(frame.Latitude()), float64(frame.Longitude()), frame.TimeStamp())
@@ -299,7 +380,13 @@ func (p *Plane) HandleModeSFrame(frame *mode_s.Frame, refLat, refLon *float64) {
 
 			altitude, _ := frame.Altitude()
 			hasChanged = p.setAltitude(altitude, frame.AltitudeUnits(), frame.TimeStamp()) || hasChanged
-			if err := p.decodeCpr(0, 0, frame.TimeStamp()); nil != err {
+			var err error
+			if p.cprLocation.canDecode() {
+				err = p.decodeCpr(0, 0, frame.TimeStamp(), heardBy)
+			} else {
+				err = p.decodeCprLocal(frame, false, refLat, refLon, heardBy)
+			}
+			if nil != err {
 				debugMessage("%s", err)
 			} else {
 				hasChanged = true
@@ -318,14 +405,14 @@ func (p *Plane) HandleModeSFrame(frame *mode_s.Frame, refLat, refLon *float64) {
 			break
 
 		case mode_s.DF17FrameAirVelocity: // "Airborne velocity"
-			hasChanged = p.setGroundStatus(false, frame.TimeStamp()) || hasChanged
-
 			if frame.HeadingValid() {
 				hasChanged = p.setHeading(frame.MustHeading(), frame.TimeStamp()) || hasChanged
 			}
 			if frame.VelocityValid() {
 				hasChanged = p.setVelocity(frame.MustVelocity(), frame.TimeStamp()) || hasChanged
 			}
+			// weighed after our velocity, so that we know how fast the plane that says it is airborne is going
+			hasChanged = p.groundEvidence(groundAirborneFrame, false, frame.TimeStamp()) || hasChanged
 			if frame.VerticalRateValid() {
 				hasChanged = p.setVerticalRate(frame.MustVerticalRate(), frame.TimeStamp()) || hasChanged
 			}
@@ -350,7 +437,7 @@ func (p *Plane) HandleModeSFrame(frame *mode_s.Frame, refLat, refLon *float64) {
 				break
 			}
 		case mode_s.DF17FrameSurfaceSystemStatus: //, "Surface System status":
-			hasChanged = p.setGroundStatus(true, frame.TimeStamp()) || hasChanged
+			hasChanged = p.groundEvidence(groundSurfaceFrame, true, frame.TimeStamp()) || hasChanged
 			debugMessage("\033[2m Ignoring: DF%d %s\033[0m", frame.DownLinkType(), messageType)
 			break
 
@@ -361,6 +448,7 @@ func (p *Plane) HandleModeSFrame(frame *mode_s.Frame, refLat, refLon *float64) {
 					hasChanged = p.setSpecial("special", frame.Special(), frame.TimeStamp()) || hasChanged
 					hasChanged = p.setSpecial("emergency", frame.Emergency(), frame.TimeStamp()) || hasChanged
 				}
+				p.setEmergencyStatus(frame.Alert(), frame.Emergency(), frame.TimeStamp())
 				hasChanged = p.setSquawkIdentity(frame.SquawkIdentity(), frame.TimeStamp()) || hasChanged
 				break
 			}
@@ -377,7 +465,7 @@ func (p *Plane) HandleModeSFrame(frame *mode_s.Frame, refLat, refLon *float64) {
 		case mode_s.DF17FrameAircraftOperational: //, "Aircraft Operational status Message":
 			{
 				if frame.VerticalStatusValid() {
-					hasChanged = p.setGroundStatus(frame.MustOnGround(), frame.TimeStamp()) || hasChanged
+					hasChanged = p.groundEvidence(groundVerticalStatus, frame.MustOnGround(), frame.TimeStamp()) || hasChanged
 				}
 				hasChanged = p.setAirFrameWidthLength(frame.GetAirplaneLengthWidth()) || hasChanged
 
@@ -404,14 +492,21 @@ func (p *Plane) HandleModeSFrame(frame *mode_s.Frame, refLat, refLon *float64) {
 	if hasChanged {
 		p.tracker.AddEvent(NewPlaneLocationEvent(p))
 	}
+	p.sendEvents()
 }
 
 func (p *Plane) HandleSbs1Frame(frame *sbs1.Frame) {
+	p.handleSbs1Frame(frame, nil)
+}
+
+// handleSbs1Frame updates our plane from the frame, checking its position against the range of the receiver that
+// heard it (nil if we are not checking)
+func (p *Plane) handleSbs1Frame(frame *sbs1.Frame, heardBy *receiverRange) {
 	var hasChanged bool
 	p.setLastSeen(frame.TimeStamp())
 	p.incMsgCount()
 	if frame.HasPosition {
-		if err := p.addLatLong(frame.Lat, frame.Lon, frame.Received); nil != err {
+		if err := p.addPosition(frame.Lat, frame.Lon, frame.Received, false, heardBy); nil != err {
 			p.tracker.log.Warn().Err(err).Send()
 		}
 
@@ -422,4 +517,5 @@ func (p *Plane) HandleSbs1Frame(frame *sbs1.Frame) {
 	if hasChanged {
 		p.tracker.AddEvent(NewPlaneLocationEvent(p))
 	}
+	p.sendEvents()
 }
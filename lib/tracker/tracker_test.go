@@ -227,7 +227,7 @@ func TestTrackingLocationHistory(t *testing.T) {
 			}
 			plane := trk.GetPlane(frame.Icao())
 			plane.HandleModeSFrame(frame, nil, nil)
-			numHistory := len(plane.locationHistory)
+			numHistory := plane.locationHistory.len()
 			if tt.numLocations != numHistory {
 				t.Errorf("Expected plane to have %d history items, actually has %d", tt.numLocations, numHistory)
 			}
@@ -252,8 +252,8 @@ func TestPlane_HasLocation(t *testing.T) {
 	if !p.HasLocation() {
 		t.Error("Did not correctly set plane location has updated flag")
 	}
-	if 1 != len(p.locationHistory) {
-		t.Errorf("Expected plane history to have 1 item. have %d", len(p.locationHistory))
+	if 1 != p.locationHistory.len() {
+		t.Errorf("Expected plane history to have 1 item. have %d", p.locationHistory.len())
 	}
 }
 
@@ -446,7 +446,8 @@ func TestBadLocationUpdateRejected(t *testing.T) {
 		md(mode_s.DecodeString("8D4CA813589183F7CCA0F55734EA", time.Unix(1654071090, 997511392))),
 	}
 
-	tkr := NewTracker()
+	// only our pairs, so that we see what becomes of the busted one
+	tkr := NewTracker(WithPairedCprOnly())
 	p := tkr.GetPlane(0x4CA813)
 
 	for i := 0; i < 4; i++ {
@@ -468,8 +469,46 @@ func TestBadLocationUpdateRejected(t *testing.T) {
 		t.Error("Wrong Longitude")
 	}
 
-	if 1 != len(p.locationHistory) {
-		t.Errorf("Incorrect history, expected: 1, got: %d", len(p.locationHistory))
+	if 1 != p.locationHistory.len() {
+		t.Errorf("Incorrect history, expected: 1, got: %d", p.locationHistory.len())
+	}
+}
+
+func TestBadLocationUpdateLocalDecode(t *testing.T) {
+	var frames []*mode_s.Frame
+	for _, f := range []struct {
+		avr string
+		at  time.Time
+	}{
+		{"8D4CA813589186EF638487A3F9F7", time.Unix(1654071089, 590443635)},
+		{"8D4CA813589183871D80EEE6F328", time.Unix(1654071089, 993928591)},
+		{"8D4CA813589186EFA98497B6EF5A", time.Unix(1654071090, 498070277)},
+		{"8D4CA813589183F7CCA0F55734EA", time.Unix(1654071090, 997511392)},
+	} {
+		frame, err := mode_s.DecodeString(f.avr, f.at)
+		if nil != err {
+			t.Fatal(err)
+		}
+		frames = append(frames, frame)
+	}
+
+	tkr := NewTracker()
+	p := tkr.GetPlane(0x4CA813)
+
+	for i := 0; i < 4; i++ {
+		p.HandleModeSFrame(frames[i], nil, nil)
+	}
+
+	// our good pair gives us our first position, the even frame of our busted pair decodes locally against it and
+	// the busted pair itself is still rejected
+	if 2 != p.locationHistory.len() {
+		t.Fatalf("Incorrect history, expected: 2, got: %d", p.locationHistory.len())
+	}
+	if 53.290813898636124 != p.locationHistory.at(0).latitude || -2.553432688993553 != p.locationHistory.at(0).longitude {
+		t.Errorf("Wrong first position from our good pair")
+	}
+	if 53.29244322695974 != p.location.latitude || -2.5521401798023895 != p.location.longitude {
+		t.Errorf("Wrong local decode, got {%0.15f, %0.15f}", p.location.latitude, p.location.longitude)
 	}
 }
 
@@ -576,3 +615,66 @@ func BenchmarkTracker_AddFrame(b *testing.B) {
 		tp.addMsg()
 	}
 }
+
+type recordingMiddleware struct {
+	started, stopped bool
+	tags             []string
+	drop             bool
+}
+
+func (rm *recordingMiddleware) String() string {
+	return "Recording Middleware"
+}
+func (rm *recordingMiddleware) Start() {
+	rm.started = true
+}
+func (rm *recordingMiddleware) Stop() {
+	rm.stopped = true
+}
+func (rm *recordingMiddleware) Handle(fe *FrameEvent) *FrameEvent {
+	rm.tags = append(rm.tags, fe.Source().Tag)
+	if value, ok := fe.Meta("seen-by"); ok {
+		fe.SetMeta("seen-by", value+","+rm.String())
+	} else {
+		fe.SetMeta("seen-by", rm.String())
+	}
+	if rm.drop {
+		return nil
+	}
+	return fe
+}
+
+func TestTracker_Middleware(t *testing.T) {
+	trk := NewTracker(WithDecodeWorkerCount(1))
+	first := &recordingMiddleware{}
+	second := &recordingMiddleware{drop: true}
+	third := &recordingMiddleware{}
+	trk.AddMiddleware(first)
+	trk.AddMiddleware(second)
+	trk.AddMiddleware(third)
+	if !first.started || !second.started {
+		t.Errorf("Expected our middlewares to be started when they are added")
+	}
+
+	refLat, refLon := -31.9, 115.9
+	source := &FrameSource{Tag: "receiver-1", RefLat: &refLat, RefLon: &refLon}
+	fe := NewFrameEvent(mode_s.NewFrame("*8D7C7F0D581176D7BB8D48CD7714;", time.Now()), source)
+	trk.queueFrame(fe)
+	trk.Finish()
+
+	if !first.stopped || !third.stopped {
+		t.Errorf("Expected our middlewares to be stopped when we finish")
+	}
+	if 1 != len(first.tags) || "receiver-1" != first.tags[0] {
+		t.Errorf("Expected our middleware to see where our frame came from, got %v", first.tags)
+	}
+	if 0 != len(third.tags) {
+		t.Errorf("A dropped frame should not go to the next middleware")
+	}
+	if seenBy, _ := fe.Meta("seen-by"); "Recording Middleware,Recording Middleware" != seenBy {
+		t.Errorf("Unexpected metadata %s", seenBy)
+	}
+	if _, ok := trk.planeList.Load(uint32(0x7C7F0D)); ok {
+		t.Errorf("A dropped frame should not reach our planes")
+	}
+}
@@ -0,0 +1,31 @@
+package ws_protocol
+
+import "plane.watch/lib/tracker"
+
+const (
+	// historyTolerance (metres) and historyAltitudeTolerance (feet) are how far a simplified history can stray from the path
+	historyTolerance         = 50.0
+	historyAltitudeTolerance = 300
+)
+
+// SimplifyHistory thins out a planes location history to no more than maxPoints points, keeping its turns, climbs and descents
+func SimplifyHistory(history []LocationHistory, maxPoints int) []LocationHistory {
+	points := make([]tracker.TrackPoint, len(history))
+	for i, h := range history {
+		points[i] = tracker.TrackPoint{Lat: h.Lat, Lon: h.Lon, Heading: h.Heading, Velocity: h.Velocity}
+		if nil != h.Altitude {
+			points[i].Altitude = *h.Altitude
+			points[i].HasAltitude = true
+		}
+	}
+	simplified := tracker.SimplifyTrack(points, historyTolerance, historyAltitudeTolerance, maxPoints)
+	out := make([]LocationHistory, len(simplified))
+	for i, point := range simplified {
+		out[i] = LocationHistory{Lat: point.Lat, Lon: point.Lon, Heading: point.Heading, Velocity: point.Velocity}
+		if point.HasAltitude {
+			altitude := point.Altitude
+			out[i].Altitude = &altitude
+		}
+	}
+	return out
+}
@@ -26,6 +26,7 @@ type (
 		GridTile string `json:"gridTile"`
 		Icao     string `json:"icao,omitempty"`
 		CallSign string `json:"callSign,omitempty"`
+		FlightId string `json:"flightId,omitempty"`
 	}
 	LocationHistory struct {
 		Lat, Lon          float64
@@ -41,6 +42,7 @@ type (
 
 		Icao     string            `json:"icao,omitempty"`
 		CallSign string            `json:"callSign,omitempty"`
+		FlightId string            `json:"flightId,omitempty"`
 		History  []LocationHistory `json:"history,omitempty"`
 	}
 )